@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrAccountExpired     = errors.New("аккаунт выведен недействителен")
+	ErrEmailNotVerified   = errors.New("аккаунт не активирован: подтвердите email по ссылке из письма")
+	ErrAccountDisabled    = errors.New("аккаунт отключен администратором")
+	ErrCredentialsExpired = errors.New("срок действия пароля истек, войдите и смените пароль")
+	ErrAccountUnavailable = errors.New("аккаунт недоступен")
+)
+
+// accountStateColumns - столбцы users, из которых читается accountState
+const accountStateColumns = "account_non_expired, account_non_locked, enabled, email_verified_at IS NOT NULL, credentials_non_expired, locked_until, password_changed_at"
+
+// accountState - состояние учетной записи, которое проверяется при входе и при обновлении токенов
+type accountState struct {
+	accountNonExpired     bool
+	accountNonLocked      bool
+	enabled               bool
+	emailVerified         bool // Регистрация подтверждена по ссылке из письма
+	credentialsNonExpired bool
+	lockedUntil           sql.NullTime // Пусто у заблокированного аккаунта - до разблокировки администратором
+	passwordChangedAt     time.Time
+}
+
+// scanArgs возвращает адреса полей в порядке accountStateColumns
+func (st *accountState) scanArgs() []interface{} {
+	return []interface{}{&st.accountNonExpired, &st.accountNonLocked, &st.enabled, &st.emailVerified, &st.credentialsNonExpired,
+		&st.lockedUntil, &st.passwordChangedAt}
+}
+
+// lockActive сообщает, действует ли блокировка аккаунта. Истекшая блокировка снимается при следующем входе,
+// а до этого уже не считается действующей.
+func (st *accountState) lockActive() bool {
+	return !st.accountNonLocked && (!st.lockedUntil.Valid || st.lockedUntil.Time.After(time.Now()))
+}
+
+// check возвращает ошибку, если аккаунтом нельзя пользоваться. Срок действия пароля проверяется отдельно.
+func (st *accountState) check() error {
+	if !st.accountNonExpired {
+		return ErrAccountExpired
+	}
+	if st.lockActive() {
+		if st.lockedUntil.Valid {
+			return fmt.Errorf("%w до %s", ErrAccountLocked, st.lockedUntil.Time.Format(time.RFC3339))
+		}
+		return ErrAccountLocked
+	}
+	if !st.enabled {
+		if !st.emailVerified {
+			return ErrEmailNotVerified
+		}
+		return ErrAccountDisabled
+	}
+	return nil
+}
+
+// CheckAccount проверяет аккаунт email так же, как при входе: аккаунт действует, не заблокирован,
+// подтвержден, не отключен, а его пароль не истек. Нулевой passwordMaxAge - пароль не истекает.
+// Ошибки состояния аккаунта оборачивают ErrAccountUnavailable вместе с конкретной причиной.
+// Используется доступом без сеанса, например лентами календаря по токену.
+func CheckAccount(db *sql.DB, email string, passwordMaxAge time.Duration) error {
+	var state accountState
+	err := db.QueryRow(`SELECT `+accountStateColumns+` FROM users WHERE email = $1`, email).Scan(state.scanArgs()...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %w", ErrAccountUnavailable, ErrUserNotFound)
+		}
+		return fmt.Errorf("ошибка при поиске пользователя: %v", err)
+	}
+
+	if err := state.check(); err != nil {
+		return fmt.Errorf("%w: %w", ErrAccountUnavailable, err)
+	}
+	if !state.credentialsNonExpired || (passwordMaxAge > 0 && time.Since(state.passwordChangedAt) > passwordMaxAge) {
+		return fmt.Errorf("%w: %w", ErrAccountUnavailable, ErrCredentialsExpired)
+	}
+	return nil
+}
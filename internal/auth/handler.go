@@ -7,7 +7,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
+
+	"github.com/gorilla/mux"
 )
 
 type Handler struct {
@@ -70,13 +73,20 @@ func (ah *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Пытаемся авторизовать пользователя
-	response, err := ah.AuthService.LoginUser(req.Email, req.Password)
+	response, err := ah.AuthService.LoginUser(req.Email, req.Password, clientIP(r))
 	if err != nil {
 		// Если произошла ошибка, отправляем ошибочный ответ с сообщением
 		response = &models.Response{
 			Message: err.Error(),
 		}
-		mw.SendJSONResponse(w, response, http.StatusUnauthorized)
+		switch {
+		case errors.Is(err, ErrAccountLocked):
+			mw.SendJSONResponse(w, response, http.StatusLocked) // 423
+		case errors.Is(err, ErrTooManyAttempts):
+			mw.SendJSONResponse(w, response, http.StatusTooManyRequests) // 429
+		default:
+			mw.SendJSONResponse(w, response, http.StatusUnauthorized)
+		}
 		return
 	}
 
@@ -84,22 +94,217 @@ func (ah *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	mw.SendJSONResponse(w, response, http.StatusOK)
 }
 
-func (as *Service) Refresh(refreshToken string) (*models.Response, error) {
-	// Проверяем валидность refresh токена
-	email, err := mw.ValidateToken(refreshToken, "refresh") // Передаем "refresh" в качестве типа токена
+// clientIP возвращает адрес клиента без порта
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
-		return nil, fmt.Errorf("передан невалидный refresh токен")
+		return r.RemoteAddr
 	}
+	return host
+}
 
-	// Генерируем новый accessToken
-	accessToken, _, err := mw.GenerateTokens(email)
+// Refresh выдает новую пару токенов. Переданный refresh токен после этого больше не действует.
+func (as *Service) Refresh(refreshToken string) (*models.Response, error) {
+	accessToken, newRefreshToken, err := as.RotateRefreshToken(refreshToken)
 	if err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) || errors.Is(err, ErrRefreshTokenReused) ||
+			errors.Is(err, ErrAccountLocked) || errors.Is(err, ErrAccountExpired) ||
+			errors.Is(err, ErrAccountDisabled) || errors.Is(err, ErrEmailNotVerified) || errors.Is(err, ErrCredentialsExpired) {
+			return nil, err
+		}
 		return nil, fmt.Errorf("ошибка обновления токена")
 	}
 
-	// Возвращаем успешный ответ с новым токеном
+	// Возвращаем успешный ответ с новыми токенами
 	return &models.Response{
 		Message: "Токен обновлен",
-		Data:    map[string]string{"accessToken": accessToken},
+		Data:    map[string]string{"accessToken": accessToken, "refreshToken": newRefreshToken},
 	}, nil
 }
+
+// Logout завершает текущий сеанс: refresh токен из заголовка Refresh-Token и все токены, полученные из него, отзываются
+func (ah *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	email, ok := r.Context().Value("email").(string)
+	if !ok {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Unauthorized",
+		}, http.StatusUnauthorized)
+		return
+	}
+
+	refreshToken := r.Header.Get("Refresh-Token")
+	if refreshToken == "" {
+		mw.SendJSONResponse(w, &models.Response{Message: "Refresh-Token не найден в заголовках"}, http.StatusBadRequest)
+		return
+	}
+
+	if err := ah.AuthService.Logout(email, refreshToken); err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) {
+			mw.SendJSONResponse(w, &models.Response{Message: err.Error()}, http.StatusBadRequest)
+			return
+		}
+		mw.SendJSONResponse(w, &models.Response{Message: "Внутренняя ошибка сервера: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{Message: "Выход выполнен"}, http.StatusOK)
+}
+
+// LogoutAll завершает все сеансы пользователя на всех устройствах
+func (ah *Handler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	email, ok := r.Context().Value("email").(string)
+	if !ok {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Unauthorized",
+		}, http.StatusUnauthorized)
+		return
+	}
+
+	if err := ah.AuthService.RevokeAllSessions(email); err != nil {
+		mw.SendJSONResponse(w, &models.Response{Message: "Внутренняя ошибка сервера: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{Message: "Выполнен выход со всех устройств"}, http.StatusOK)
+}
+
+// sendTokenError отправляет ответ с кодом, соответствующим ошибке проверки одноразового токена
+func sendTokenError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidActionToken), errors.Is(err, ErrActionTokenUsed):
+		mw.SendJSONResponse(w, &models.Response{Message: err.Error()}, http.StatusBadRequest) // 400
+	case errors.Is(err, ErrActionTokenExpired):
+		mw.SendJSONResponse(w, &models.Response{Message: err.Error()}, http.StatusGone) // 410
+	case errors.Is(err, ErrResendTooSoon):
+		mw.SendJSONResponse(w, &models.Response{Message: err.Error()}, http.StatusTooManyRequests) // 429
+	default:
+		mw.SendJSONResponse(w, &models.Response{Message: "Внутренняя ошибка сервера: " + err.Error()}, http.StatusInternalServerError) // 500
+	}
+}
+
+// VerifyEmail подтверждает email. Токен передается параметром token (ссылка из письма) или в теле {"token": "..."}.
+func (ah *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" && r.Method == http.MethodPost {
+		var req struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			mw.SendJSONResponse(w, &models.Response{Message: "Некорректный JSON"}, http.StatusBadRequest)
+			return
+		}
+		token = req.Token
+	}
+	if token == "" {
+		mw.SendJSONResponse(w, &models.Response{Message: ErrInvalidActionToken.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	email, err := ah.AuthService.VerifyEmail(token)
+	if err != nil {
+		sendTokenError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Email подтвержден, теперь можно войти",
+		Data:    map[string]string{"email": email},
+	}, http.StatusOK)
+}
+
+// ResendVerification повторно отправляет письмо с подтверждением email. Тело запроса - {"email": "..."}.
+func (ah *Handler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	if err := ah.AuthService.ResendVerification(req.Email); err != nil {
+		sendTokenError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Если аккаунт ожидает подтверждения, письмо отправлено повторно",
+	}, http.StatusOK)
+}
+
+// RequestPasswordReset отправляет на email токен для сброса пароля. Тело запроса - {"email": "..."}.
+func (ah *Handler) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	if err := ah.AuthService.RequestPasswordReset(req.Email); err != nil {
+		sendTokenError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Если аккаунт с таким email существует, на него отправлено письмо для сброса пароля",
+	}, http.StatusOK)
+}
+
+// ConfirmPasswordReset задает новый пароль. Тело запроса - {"token": "...", "newPassword": "..."}.
+func (ah *Handler) ConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"newPassword"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	if err := ah.AuthService.ConfirmPasswordReset(req.Token, req.NewPassword); err != nil {
+		if errors.Is(err, ErrInvalidPassword) {
+			mw.SendJSONResponse(w, &models.Response{Message: err.Error()}, http.StatusBadRequest)
+			return
+		}
+		sendTokenError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Пароль изменен, все сеансы завершены, войдите с новым паролем",
+	}, http.StatusOK)
+}
+
+// GetLockStatus возвращает администратору состояние блокировки аккаунта и число недавних неудачных попыток входа
+func (ah *Handler) GetLockStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := ah.AuthService.GetLockStatus(mux.Vars(r)["email"])
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			mw.SendJSONResponse(w, &models.Response{Message: err.Error()}, http.StatusNotFound)
+			return
+		}
+		mw.SendJSONResponse(w, &models.Response{Message: "Внутренняя ошибка сервера: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Состояние блокировки получено",
+		Data:    map[string]LockStatus{"lock": *status},
+	}, http.StatusOK)
+}
+
+// UnlockAccount снимает блокировку аккаунта и сбрасывает счетчик неудачных попыток входа
+func (ah *Handler) UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	if err := ah.AuthService.UnlockAccount(mux.Vars(r)["email"]); err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			mw.SendJSONResponse(w, &models.Response{Message: err.Error()}, http.StatusNotFound)
+			return
+		}
+		mw.SendJSONResponse(w, &models.Response{Message: "Внутренняя ошибка сервера: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{Message: "Аккаунт разблокирован"}, http.StatusOK)
+}
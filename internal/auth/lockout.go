@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// LockoutPolicy задает блокировку после неудачных попыток входа
+type LockoutPolicy struct {
+	MaxAttempts   int           // Неудачных попыток входа в аккаунт до блокировки, 0 - не блокировать
+	MaxIPAttempts int           // Неудачных попыток с одного IP до временного отказа во входе, 0 - не ограничивать
+	Window        time.Duration // Период, за который считаются неудачные попытки
+	Duration      time.Duration // Срок блокировки аккаунта, 0 - до разблокировки администратором
+}
+
+// DefaultLockoutPolicy - блокировка по умолчанию: 5 неудачных попыток за 15 минут блокируют аккаунт на 15 минут,
+// 20 неудачных попыток с одного IP временно запрещают вход с него
+var DefaultLockoutPolicy = LockoutPolicy{
+	MaxAttempts:   5,
+	MaxIPAttempts: 20,
+	Window:        15 * time.Minute,
+	Duration:      15 * time.Minute,
+}
+
+var (
+	ErrAccountLocked   = errors.New("аккаунт заблокирован")
+	ErrTooManyAttempts = errors.New("слишком много неудачных попыток входа с этого адреса, попробуйте позже")
+	ErrUserNotFound    = errors.New("пользователь не найден")
+)
+
+// LockStatus - состояние блокировки аккаунта
+type LockStatus struct {
+	Email          string     `json:"email"`
+	Locked         bool       `json:"locked"`
+	LockedUntil    *time.Time `json:"lockedUntil,omitempty"` // Пусто у заблокированного аккаунта - до разблокировки администратором
+	FailedAttempts int        `json:"failedAttempts"`        // Неудачные попытки входа за последний период
+}
+
+// checkIPAllowed возвращает ErrTooManyAttempts, если с адреса ip было слишком много неудачных попыток входа
+func (as *Service) checkIPAllowed(ip string) error {
+	if as.Lockout.MaxIPAttempts <= 0 || ip == "" {
+		return nil
+	}
+
+	var attempts int
+	err := as.DB.QueryRow(`SELECT count(*) FROM failed_login WHERE ip = $1 AND attempted_at > $2`,
+		ip, time.Now().Add(-as.Lockout.Window)).Scan(&attempts)
+	if err != nil {
+		return fmt.Errorf("ошибка при проверке попыток входа: %v", err)
+	}
+	if attempts >= as.Lockout.MaxIPAttempts {
+		return ErrTooManyAttempts
+	}
+	return nil
+}
+
+// recordFailedLogin запоминает неудачную попытку входа и блокирует аккаунт, если попыток стало слишком много.
+// Блокировка завершает все сеансы пользователя.
+// Возвращает true, если аккаунт заблокирован этой попыткой.
+func (as *Service) recordFailedLogin(email, ip string) (bool, error) {
+	since := time.Now().Add(-as.Lockout.Window)
+	// Попытки старше периода подсчета больше не нужны
+	if _, err := as.DB.Exec(`DELETE FROM failed_login WHERE attempted_at <= $1`, since); err != nil {
+		return false, fmt.Errorf("не удалось удалить устаревшие попытки входа: %v", err)
+	}
+	if _, err := as.DB.Exec(`INSERT INTO failed_login (email, ip) VALUES ($1, $2)`, email, ip); err != nil {
+		return false, fmt.Errorf("не удалось сохранить попытку входа: %v", err)
+	}
+	if as.Lockout.MaxAttempts <= 0 {
+		return false, nil
+	}
+
+	var attempts int
+	err := as.DB.QueryRow(`SELECT count(*) FROM failed_login WHERE email = $1 AND attempted_at > $2`, email, since).Scan(&attempts)
+	if err != nil {
+		return false, fmt.Errorf("ошибка при подсчете попыток входа: %v", err)
+	}
+	if attempts < as.Lockout.MaxAttempts {
+		return false, nil
+	}
+
+	var lockedUntil sql.NullTime
+	if as.Lockout.Duration > 0 {
+		lockedUntil = sql.NullTime{Time: time.Now().Add(as.Lockout.Duration), Valid: true}
+	}
+
+	tx, err := as.DB.Begin()
+	if err != nil {
+		return false, fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE users SET account_non_locked = false, locked_until = $2 WHERE email = $1 AND account_non_locked
+	`, email, lockedUntil)
+	if err != nil {
+		return false, fmt.Errorf("не удалось заблокировать аккаунт: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return false, nil
+	}
+	// Сеансы, открытые до блокировки, могли быть украдены тем, кто подбирает пароль
+	if err := revokeUserSessions(tx, email); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+	return true, nil
+}
+
+// clearFailedLogins сбрасывает счетчик неудачных попыток входа в аккаунт
+func (as *Service) clearFailedLogins(email string) error {
+	if _, err := as.DB.Exec(`DELETE FROM failed_login WHERE email = $1`, email); err != nil {
+		return fmt.Errorf("не удалось сбросить попытки входа: %v", err)
+	}
+	return nil
+}
+
+// GetLockStatus возвращает состояние блокировки аккаунта
+func (as *Service) GetLockStatus(email string) (*LockStatus, error) {
+	status := LockStatus{Email: email}
+	var state accountState
+	err := as.DB.QueryRow(`
+		SELECT u.account_non_locked, u.locked_until,
+			   (SELECT count(*) FROM failed_login f WHERE f.email = u.email AND f.attempted_at > $2)
+		FROM users u WHERE u.email = $1
+	`, email, time.Now().Add(-as.Lockout.Window)).Scan(&state.accountNonLocked, &state.lockedUntil, &status.FailedAttempts)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("ошибка при получении пользователя: %v", err)
+	}
+
+	status.Locked = state.lockActive()
+	if status.Locked && state.lockedUntil.Valid {
+		status.LockedUntil = &state.lockedUntil.Time
+	}
+	return &status, nil
+}
+
+// UnlockAccount снимает блокировку аккаунта и сбрасывает счетчик неудачных попыток входа
+func (as *Service) UnlockAccount(email string) error {
+	result, err := as.DB.Exec(`UPDATE users SET account_non_locked = true, locked_until = NULL WHERE email = $1`, email)
+	if err != nil {
+		return fmt.Errorf("не удалось разблокировать аккаунт: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrUserNotFound
+	}
+	return as.clearFailedLogins(email)
+}
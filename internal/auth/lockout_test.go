@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLoginLockoutThresholds(t *testing.T) {
+	const ip = "192.0.2.1"
+	tests := []struct {
+		name     string
+		policy   LockoutPolicy
+		failures int    // Неудачных попыток входа перед входом с верным паролем
+		email    string // Email неудачных попыток, по умолчанию testEmail
+		loginIP  string // Адрес входа с верным паролем, по умолчанию ip
+		wantErr  error
+	}{
+		{
+			name:     "below account threshold",
+			policy:   LockoutPolicy{MaxAttempts: 3, Window: time.Minute, Duration: time.Minute},
+			failures: 2,
+		},
+		{
+			name:     "account threshold reached",
+			policy:   LockoutPolicy{MaxAttempts: 3, Window: time.Minute, Duration: time.Minute},
+			failures: 3,
+			wantErr:  ErrAccountLocked,
+		},
+		{
+			name:     "lock until admin unlock",
+			policy:   LockoutPolicy{MaxAttempts: 3, Window: time.Minute},
+			failures: 3,
+			wantErr:  ErrAccountLocked,
+		},
+		{
+			name:     "account lockout disabled",
+			policy:   LockoutPolicy{Window: time.Minute},
+			failures: 10,
+		},
+		{
+			name:     "ip threshold reached",
+			policy:   LockoutPolicy{MaxIPAttempts: 3, Window: time.Minute},
+			failures: 3,
+			email:    "nobody@example.com",
+			wantErr:  ErrTooManyAttempts,
+		},
+		{
+			name:     "ip threshold from another address",
+			policy:   LockoutPolicy{MaxIPAttempts: 3, Window: time.Minute},
+			failures: 3,
+			email:    "nobody@example.com",
+			loginIP:  "192.0.2.2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			as, _ := newTestService(t)
+			as.Lockout = tt.policy
+			email := tt.email
+			if email == "" {
+				email = testEmail
+			}
+			loginIP := tt.loginIP
+			if loginIP == "" {
+				loginIP = ip
+			}
+
+			for i := 0; i < tt.failures; i++ {
+				if _, err := as.LoginUser(email, "wrong-password", ip); err == nil {
+					t.Fatal("LoginUser() with a wrong password succeeded")
+				}
+			}
+
+			_, err := as.LoginUser(testEmail, testPassword, loginIP)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("LoginUser() error = %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("LoginUser() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoginAfterLockExpires(t *testing.T) {
+	as, _ := newTestService(t)
+	as.Lockout = LockoutPolicy{MaxAttempts: 1, Window: time.Minute, Duration: time.Minute}
+
+	if _, err := as.LoginUser(testEmail, "wrong-password", ""); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("LoginUser() error = %v, want %v", err, ErrAccountLocked)
+	}
+	mustExec(t, as.DB, `UPDATE users SET locked_until = now() - interval '1 second' WHERE email = $1`, testEmail)
+
+	if _, err := as.LoginUser(testEmail, testPassword, ""); err != nil {
+		t.Fatalf("LoginUser() after the lock expired: %v", err)
+	}
+	status, err := as.GetLockStatus(testEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Locked || status.FailedAttempts != 0 {
+		t.Errorf("GetLockStatus() = %+v, want unlocked without failed attempts", status)
+	}
+}
+
+func TestLockRevokesSessions(t *testing.T) {
+	as, _ := newTestService(t)
+	as.Lockout = LockoutPolicy{MaxAttempts: 2, Window: time.Minute, Duration: time.Minute}
+
+	_, refreshToken, err := as.startSession(testEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		_, _ = as.LoginUser(testEmail, "wrong-password", "")
+	}
+
+	// Даже после снятия блокировки сеанс, открытый до нее, не возобновляется
+	if err := as.UnlockAccount(testEmail); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := as.RotateRefreshToken(refreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("RotateRefreshToken() error = %v, want %v", err, ErrRefreshTokenReused)
+	}
+}
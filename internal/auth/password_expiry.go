@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// DefaultPasswordMaxAge - срок действия пароля по умолчанию, после которого его нужно сменить
+const DefaultPasswordMaxAge = 90 * 24 * time.Hour
+
+// passwordExpired сообщает, истек ли срок действия пароля, смененного в changedAt. Нулевой PasswordMaxAge - пароль не истекает.
+func (as *Service) passwordExpired(changedAt time.Time) bool {
+	return as.PasswordMaxAge > 0 && time.Since(changedAt) > as.PasswordMaxAge
+}
+
+// expireCredentials помечает учетные данные пользователя истекшими и завершает его сеансы. Снимается пометка сменой пароля.
+func (as *Service) expireCredentials(email string) error {
+	tx, err := as.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := expireCredentialsTx(tx, email); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+	return nil
+}
+
+// expireCredentialsTx помечает учетные данные истекшими в транзакции tx. Сеансы, открытые со старым паролем,
+// отзываются: продлить их можно будет только после смены пароля и нового входа.
+func expireCredentialsTx(tx *sql.Tx, email string) error {
+	if _, err := tx.Exec(`UPDATE users SET credentials_non_expired = false WHERE email = $1`, email); err != nil {
+		return fmt.Errorf("не удалось пометить пароль истекшим: %v", err)
+	}
+	return revokeUserSessions(tx, email)
+}
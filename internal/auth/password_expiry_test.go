@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPasswordExpiryRevokesSessions(t *testing.T) {
+	tests := []struct {
+		name   string
+		expire func(t *testing.T, as *Service, refreshToken string)
+	}{
+		{
+			name: "expired on refresh",
+			expire: func(t *testing.T, as *Service, refreshToken string) {
+				if _, _, err := as.RotateRefreshToken(refreshToken); !errors.Is(err, ErrCredentialsExpired) {
+					t.Fatalf("RotateRefreshToken() error = %v, want %v", err, ErrCredentialsExpired)
+				}
+			},
+		},
+		{
+			name: "expired on login",
+			expire: func(t *testing.T, as *Service, refreshToken string) {
+				response, err := as.LoginUser(testEmail, testPassword, "")
+				if err != nil {
+					t.Fatalf("LoginUser() error = %v", err)
+				}
+				data, _ := response.Data.(map[string]string)
+				if data["passwordChangeToken"] == "" || data["refreshToken"] != "" {
+					t.Fatalf("LoginUser() data = %v, want only passwordChangeToken", response.Data)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			as, _ := newTestService(t)
+			var tokens []string
+			for i := 0; i < 2; i++ {
+				_, refreshToken, err := as.startSession(testEmail)
+				if err != nil {
+					t.Fatal(err)
+				}
+				tokens = append(tokens, refreshToken)
+			}
+			mustExec(t, as.DB, `UPDATE users SET password_changed_at = now() - interval '1 year' WHERE email = $1`, testEmail)
+
+			tt.expire(t, as, tokens[0])
+
+			var credentialsNonExpired bool
+			if err := as.DB.QueryRow(`SELECT credentials_non_expired FROM users WHERE email = $1`, testEmail).Scan(&credentialsNonExpired); err != nil {
+				t.Fatal(err)
+			}
+			if credentialsNonExpired {
+				t.Error("credentials are not marked expired")
+			}
+			if _, _, err := as.RotateRefreshToken(tokens[1]); !errors.Is(err, ErrRefreshTokenReused) {
+				t.Errorf("RotateRefreshToken() of another session error = %v, want %v", err, ErrRefreshTokenReused)
+			}
+		})
+	}
+}
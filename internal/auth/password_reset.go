@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"book_talk/internal/mail"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PurposePasswordReset - назначение одноразового токена для сброса забытого пароля
+const PurposePasswordReset = "password_reset"
+
+// DefaultPasswordResetTTL - срок действия токена для сброса пароля по умолчанию
+const DefaultPasswordResetTTL = time.Hour
+
+// RequestPasswordReset отправляет на email одноразовый токен для сброса пароля.
+// Для неизвестных адресов и слишком частых запросов ничего не делает, чтобы ответ не раскрывал,
+// зарегистрирован ли адрес.
+func (as *Service) RequestPasswordReset(email string) error {
+	var lastSentAt sql.NullTime
+	err := as.DB.QueryRow(`
+		SELECT (SELECT max(created_at) FROM action_token WHERE user_email = u.email AND purpose = $2)
+		FROM users u WHERE u.email = $1
+	`, email, PurposePasswordReset).Scan(&lastSentAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("ошибка при поиске пользователя: %v", err)
+	}
+	if lastSentAt.Valid && time.Since(lastSentAt.Time) < ResendInterval {
+		return nil
+	}
+
+	token, err := as.createActionToken(email, PurposePasswordReset, as.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+	return as.Mailer.Send(mail.Message{
+		To:      email,
+		Subject: "Сброс пароля",
+		Body: "Для вас запрошен сброс пароля. Чтобы задать новый пароль, передайте этот токен " +
+			"в POST /api/v1/auth/password-reset/confirm:\n\n" + token + "\n\n" +
+			fmt.Sprintf("Токен действует %v и может быть использован один раз. ", as.PasswordResetTTL) +
+			"Если вы не запрашивали сброс пароля, просто проигнорируйте это письмо.\n",
+	})
+}
+
+// ConfirmPasswordReset задает новый пароль по токену из письма и завершает все сеансы пользователя
+func (as *Service) ConfirmPasswordReset(token, newPassword string) error {
+	if isValid, errPass := IsValidPassword(newPassword); !isValid {
+		return fmt.Errorf("%w: %v", ErrInvalidPassword, errPass)
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return errors.New("ошибка хеширования пароля")
+	}
+
+	tx, err := as.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	email, err := consumeActionToken(tx, token, PurposePasswordReset)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE users SET password = $1, credentials_non_expired = true, password_changed_at = now() WHERE email = $2
+	`, string(hashedPassword), email)
+	if err != nil {
+		return fmt.Errorf("не удалось обновить пароль: %v", err)
+	}
+	if err := revokeUserSessions(tx, email); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+	return nil
+}
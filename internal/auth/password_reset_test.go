@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"book_talk/internal/mail"
+	"errors"
+	"testing"
+	"time"
+)
+
+const newTestPassword = "Changed-2"
+
+func TestConfirmPasswordReset(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    func(t *testing.T, as *Service, sender *mail.MemorySender) string
+		password string
+		wantErr  error
+	}{
+		{
+			name: "valid token",
+			token: func(t *testing.T, as *Service, sender *mail.MemorySender) string {
+				return lastMailToken(t, sender)
+			},
+		},
+		{
+			name: "used token",
+			token: func(t *testing.T, as *Service, sender *mail.MemorySender) string {
+				token := lastMailToken(t, sender)
+				if err := as.ConfirmPasswordReset(token, "Another-3"); err != nil {
+					t.Fatal(err)
+				}
+				return token
+			},
+			wantErr: ErrActionTokenUsed,
+		},
+		{
+			name: "superseded by a new token",
+			token: func(t *testing.T, as *Service, sender *mail.MemorySender) string {
+				token := lastMailToken(t, sender)
+				if _, err := as.createActionToken(testEmail, PurposePasswordReset, time.Hour); err != nil {
+					t.Fatal(err)
+				}
+				return token
+			},
+			wantErr: ErrInvalidActionToken,
+		},
+		{
+			name: "expired token",
+			token: func(t *testing.T, as *Service, sender *mail.MemorySender) string {
+				token, err := as.createActionToken(testEmail, PurposePasswordReset, -time.Minute)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return token
+			},
+			wantErr: ErrActionTokenExpired,
+		},
+		{
+			name: "email verification token",
+			token: func(t *testing.T, as *Service, sender *mail.MemorySender) string {
+				token, err := as.createActionToken(testEmail, PurposeVerifyEmail, time.Hour)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return token
+			},
+			wantErr: ErrInvalidActionToken,
+		},
+		{
+			name: "weak password",
+			token: func(t *testing.T, as *Service, sender *mail.MemorySender) string {
+				return lastMailToken(t, sender)
+			},
+			password: "short",
+			wantErr:  ErrInvalidPassword,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			as, sender := newTestService(t)
+			if err := as.RequestPasswordReset(testEmail); err != nil {
+				t.Fatal(err)
+			}
+			token := tt.token(t, as, sender)
+			_, refreshToken, err := as.startSession(testEmail)
+			if err != nil {
+				t.Fatal(err)
+			}
+			password := tt.password
+			if password == "" {
+				password = newTestPassword
+			}
+
+			err = as.ConfirmPasswordReset(token, password)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ConfirmPasswordReset() error = %v, want %v", err, tt.wantErr)
+				}
+				if _, err := as.LoginUser(testEmail, password, ""); err == nil {
+					t.Error("password changed by a rejected token")
+				}
+				if _, _, err := as.RotateRefreshToken(refreshToken); err != nil {
+					t.Errorf("session revoked by a rejected token: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ConfirmPasswordReset() error = %v", err)
+			}
+			if _, err := as.LoginUser(testEmail, newTestPassword, ""); err != nil {
+				t.Errorf("LoginUser() with the new password: %v", err)
+			}
+			if _, _, err := as.RotateRefreshToken(refreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+				t.Errorf("RotateRefreshToken() after reset error = %v, want %v", err, ErrRefreshTokenReused)
+			}
+		})
+	}
+}
+
+func TestRequestPasswordReset(t *testing.T) {
+	tests := []struct {
+		name      string
+		email     string
+		requests  int
+		wantMails int
+	}{
+		{name: "registered email", email: testEmail, requests: 1, wantMails: 1},
+		{name: "unknown email", email: "nobody@example.com", requests: 1, wantMails: 0},
+		{name: "repeated request", email: testEmail, requests: 2, wantMails: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			as, sender := newTestService(t)
+			for i := 0; i < tt.requests; i++ {
+				if err := as.RequestPasswordReset(tt.email); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := len(sender.Messages()); got != tt.wantMails {
+				t.Errorf("sent %d messages, want %d", got, tt.wantMails)
+			}
+		})
+	}
+}
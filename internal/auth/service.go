@@ -1,23 +1,42 @@
 package auth
 
 import (
+	"book_talk/internal/mail"
 	"book_talk/internal/models"
 	mw "book_talk/middleware"
 	"database/sql"
 	"errors"
 	"fmt"
 	"golang.org/x/crypto/bcrypt"
+	"log"
 	"net/http"
 	"regexp"
+	"time"
 	"unicode"
 )
 
 type Service struct {
-	DB *sql.DB
+	DB              *sql.DB
+	Mailer          mail.Sender   // Отправка писем со ссылками подтверждения
+	BaseURL         string        // Адрес сервиса, с которого начинаются ссылки в письмах
+	VerificationTTL time.Duration // Срок действия ссылки для подтверждения email
+
+	PasswordResetTTL time.Duration // Срок действия токена для сброса пароля
+	Lockout          LockoutPolicy // Блокировка после неудачных попыток входа
+	PasswordMaxAge   time.Duration // Срок действия пароля, 0 - пароль не истекает
 }
 
 func NewAuthService(db *sql.DB) *Service {
-	return &Service{DB: db}
+	return &Service{
+		DB:              db,
+		Mailer:          mail.NewMemorySender(),
+		BaseURL:         DefaultBaseURL,
+		VerificationTTL: DefaultVerificationTTL,
+
+		PasswordResetTTL: DefaultPasswordResetTTL,
+		Lockout:          DefaultLockoutPolicy,
+		PasswordMaxAge:   DefaultPasswordMaxAge,
+	}
 }
 
 var (
@@ -69,13 +88,20 @@ func (as *Service) RegisterUser(email, password, firstName, lastName string) (*m
 		return nil, errors.New("ошибка хеширования пароля")
 	}
 
-	// Сохраняем пользователя в базе данных
-	_, err = as.DB.Exec("INSERT INTO users (email, password, first_name, last_name) VALUES ($1, $2, $3, $4)",
+	// Сохраняем пользователя в базе данных. Аккаунт активируется после подтверждения email.
+	_, err = as.DB.Exec("INSERT INTO users (email, password, first_name, last_name, enabled) VALUES ($1, $2, $3, $4, false)",
 		email, hashedPassword, firstName, lastName)
 	if err != nil {
 		return nil, errors.New("ошибка сохранения пользователя")
 	}
 
+	message := "Успешно зарегистрирован, подтвердите email по ссылке из письма"
+	if err := as.sendVerification(email); err != nil {
+		// Аккаунт уже создан, письмо можно запросить повторно
+		log.Printf("Не удалось отправить письмо с подтверждением для %s: %v", email, err)
+		message = "Успешно зарегистрирован, но письмо с подтверждением не отправлено, запросите его повторно"
+	}
+
 	// Создаем объект пользователя
 	user := models.ShortUserResponse{
 		Email:     email,
@@ -85,7 +111,7 @@ func (as *Service) RegisterUser(email, password, firstName, lastName string) (*m
 
 	// Возвращаем успешный ответ
 	response := &models.Response{
-		Message: "Успешно зарегистрирован",
+		Message: message,
 		Data:    map[string]models.ShortUserResponse{"user": user},
 	}
 
@@ -132,50 +158,79 @@ func IsValidPassword(password string) (bool, error) {
 	return true, nil
 }
 
-func (as *Service) LoginUser(email, password string) (*models.Response, error) {
-	var (
-		hashedPassword        string
-		credentialsNonExpired bool
-		accountNonExpired     bool
-		accountNonLocked      bool
-		enabled               bool
-	)
+// LoginUser проверяет пароль и выдает токены. ip - адрес клиента, с которого выполняется вход:
+// неудачные попытки считаются и по аккаунту, и по адресу.
+// Если срок действия пароля истек, вместо токенов выдается ограниченный токен, с которым можно только сменить пароль.
+func (as *Service) LoginUser(email, password, ip string) (*models.Response, error) {
+	if err := as.checkIPAllowed(ip); err != nil {
+		return nil, err
+	}
 
 	// Получаем хеш пароля и статус пользователя из базы данных
-	err := as.DB.QueryRow("SELECT password, credentials_non_expired, account_non_expired, account_non_locked, enabled FROM users WHERE email = $1", email).
-		Scan(&hashedPassword, &credentialsNonExpired, &accountNonExpired, &accountNonLocked, &enabled)
+	var hashedPassword string
+	var state accountState
+	err := as.DB.QueryRow("SELECT password, "+accountStateColumns+" FROM users WHERE email = $1", email).
+		Scan(append([]interface{}{&hashedPassword}, state.scanArgs()...)...)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
+			// Попытка с несуществующим email тоже учитывается для адреса
+			if _, err := as.recordFailedLogin(email, ip); err != nil {
+				log.Printf("Не удалось учесть неудачную попытку входа %s: %v", email, err)
+			}
 			return nil, fmt.Errorf("пользователь не найден")
 		}
 		return nil, fmt.Errorf("ошибка при поиске пользователя")
 	}
 
-	// Проверяем, активна ли учетная запись
-	if !credentialsNonExpired {
-		return nil, fmt.Errorf("учетные данные недействительны")
-	}
-
-	if !accountNonExpired {
-		return nil, fmt.Errorf("аккаунт выведен недействителен")
-	}
-
-	if !accountNonLocked {
-		return nil, fmt.Errorf("аккаунт заблокирован")
+	// Блокировка, срок которой истек, снимается
+	if !state.accountNonLocked && !state.lockActive() {
+		if err := as.UnlockAccount(email); err != nil {
+			return nil, err
+		}
+		state.accountNonLocked = true
 	}
 
-	if !enabled {
-		return nil, fmt.Errorf("аккаунт не активирован")
+	// Проверяем, активна ли учетная запись. Истекший пароль проверяется после сверки пароля.
+	if err := state.check(); err != nil {
+		return nil, err
 	}
 
 	// Сравниваем пароли
 	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 	if err != nil {
+		locked, err := as.recordFailedLogin(email, ip)
+		if err != nil {
+			log.Printf("Не удалось учесть неудачную попытку входа %s: %v", email, err)
+		}
+		if locked {
+			return nil, fmt.Errorf("%w после нескольких неудачных попыток входа", ErrAccountLocked)
+		}
 		return nil, fmt.Errorf("неверный пароль")
 	}
 
+	if err := as.clearFailedLogins(email); err != nil {
+		log.Printf("Не удалось сбросить неудачные попытки входа %s: %v", email, err)
+	}
+
+	if state.credentialsNonExpired && as.passwordExpired(state.passwordChangedAt) {
+		if err := as.expireCredentials(email); err != nil {
+			return nil, err
+		}
+		state.credentialsNonExpired = false
+	}
+	if !state.credentialsNonExpired {
+		passwordChangeToken, err := mw.GeneratePasswordChangeToken(email)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при генерации ключей авторизации")
+		}
+		return &models.Response{
+			Message: "Срок действия пароля истек, смените пароль через PUT /api/v1/me/change-password и войдите снова",
+			Data:    map[string]string{"passwordChangeToken": passwordChangeToken},
+		}, nil
+	}
+
 	// Генерация токенов
-	accessToken, refreshToken, err := mw.GenerateTokens(email)
+	accessToken, refreshToken, err := as.startSession(email)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка при генерации ключей авторизации")
 	}
@@ -203,11 +258,15 @@ func (ah *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
 	// Пытаемся обновить токен
 	response, err := ah.AuthService.Refresh(refreshToken)
 	if err != nil {
-		// Если ошибка, отправляем ошибочный ответ с 401
+		// Если ошибка, отправляем ошибочный ответ с 401, для заблокированного аккаунта - с 423, как при входе
 		response = &models.Response{
 			Message: err.Error(),
 		}
-		mw.SendJSONResponse(w, response, http.StatusUnauthorized)
+		status := http.StatusUnauthorized
+		if errors.Is(err, ErrAccountLocked) {
+			status = http.StatusLocked
+		}
+		mw.SendJSONResponse(w, response, status)
 		return
 	}
 
@@ -0,0 +1,187 @@
+package auth
+
+import (
+	mw "book_talk/middleware"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("передан невалидный refresh токен")
+	ErrRefreshTokenReused  = errors.New("refresh токен уже использован, все сеансы этого входа завершены")
+)
+
+// newTokenID возвращает случайный идентификатор токена или семейства токенов
+func newTokenID() (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("ошибка при генерации идентификатора токена: %v", err)
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// issueTokens выпускает access токен и refresh токен семейства family и сохраняет refresh токен.
+// Пустое семейство означает новый вход.
+func issueTokens(db execer, email, family string) (string, string, error) {
+	if family == "" {
+		var err error
+		if family, err = newTokenID(); err != nil {
+			return "", "", err
+		}
+	}
+	jti, err := newTokenID()
+	if err != nil {
+		return "", "", err
+	}
+
+	expiresAt := time.Now().Add(mw.RefreshTokenTTL)
+	_, err = db.Exec(`INSERT INTO refresh_token (jti, family_id, user_email, expires_at) VALUES ($1, $2, $3, $4)`,
+		jti, family, email, expiresAt)
+	if err != nil {
+		return "", "", fmt.Errorf("не удалось сохранить refresh токен: %v", err)
+	}
+
+	accessToken, err := mw.GenerateAccessToken(email)
+	if err != nil {
+		return "", "", err
+	}
+	refreshToken, err := mw.GenerateRefreshToken(email, jti, family, expiresAt)
+	if err != nil {
+		return "", "", err
+	}
+	return accessToken, refreshToken, nil
+}
+
+// startSession выпускает токены нового входа и удаляет истекшие refresh токены пользователя
+func (as *Service) startSession(email string) (string, string, error) {
+	if _, err := as.DB.Exec(`DELETE FROM refresh_token WHERE user_email = $1 AND expires_at < now()`, email); err != nil {
+		return "", "", fmt.Errorf("не удалось удалить истекшие refresh токены: %v", err)
+	}
+	return issueTokens(as.DB, email, "")
+}
+
+// RotateRefreshToken обменивает refresh токен на новую пару токенов того же семейства.
+// Каждый refresh токен действует один раз: повторное предъявление уже использованного
+// или отозванного токена означает его утечку, поэтому отзывается все семейство.
+// Заблокированному, неактивному аккаунту или аккаунту с истекшим паролем токены не выдаются.
+func (as *Service) RotateRefreshToken(refreshToken string) (string, string, error) {
+	claims, err := mw.ParseToken(refreshToken, "refresh")
+	if err != nil || claims.ID == "" {
+		return "", "", ErrInvalidRefreshToken
+	}
+
+	tx, err := as.DB.Begin()
+	if err != nil {
+		return "", "", fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	var email, family string
+	var usedAt, revokedAt sql.NullTime
+	err = tx.QueryRow(`
+		SELECT user_email, family_id, used_at, revoked_at FROM refresh_token
+		WHERE jti = $1 AND expires_at > now()
+		FOR UPDATE
+	`, claims.ID).Scan(&email, &family, &usedAt, &revokedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", "", ErrInvalidRefreshToken
+		}
+		return "", "", fmt.Errorf("ошибка при проверке refresh токена: %v", err)
+	}
+
+	if usedAt.Valid || revokedAt.Valid {
+		if err := revokeFamily(tx, family); err != nil {
+			return "", "", err
+		}
+		if err := tx.Commit(); err != nil {
+			return "", "", fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+		}
+		return "", "", ErrRefreshTokenReused
+	}
+
+	// Аккаунт проверяется так же, как при входе
+	var state accountState
+	err = tx.QueryRow(`SELECT `+accountStateColumns+` FROM users WHERE email = $1 FOR SHARE`, email).Scan(state.scanArgs()...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", "", ErrInvalidRefreshToken
+		}
+		return "", "", fmt.Errorf("ошибка при поиске пользователя: %v", err)
+	}
+	if err := state.check(); err != nil {
+		return "", "", err
+	}
+	if !state.credentialsNonExpired || as.passwordExpired(state.passwordChangedAt) {
+		// Вместе с паролем истекают все сеансы пользователя, не только предъявленный
+		if err := expireCredentialsTx(tx, email); err != nil {
+			return "", "", err
+		}
+		if err := tx.Commit(); err != nil {
+			return "", "", fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+		}
+		return "", "", ErrCredentialsExpired
+	}
+
+	if _, err := tx.Exec(`UPDATE refresh_token SET used_at = now() WHERE jti = $1`, claims.ID); err != nil {
+		return "", "", fmt.Errorf("не удалось обновить refresh токен: %v", err)
+	}
+	accessToken, newRefreshToken, err := issueTokens(tx, email, family)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", "", fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+	return accessToken, newRefreshToken, nil
+}
+
+// revokeFamily отзывает все еще не отозванные токены семейства
+func revokeFamily(db execer, family string) error {
+	_, err := db.Exec(`UPDATE refresh_token SET revoked_at = now() WHERE family_id = $1 AND revoked_at IS NULL`, family)
+	if err != nil {
+		return fmt.Errorf("не удалось отозвать refresh токены: %v", err)
+	}
+	return nil
+}
+
+// Logout завершает сеанс, к которому относится refresh токен пользователя email
+func (as *Service) Logout(email, refreshToken string) error {
+	claims, err := mw.ParseToken(refreshToken, "refresh")
+	if err != nil || claims.Family == "" || claims.Email != email {
+		return ErrInvalidRefreshToken
+	}
+	return revokeFamily(as.DB, claims.Family)
+}
+
+// RevokeAllSessions завершает все сеансы пользователя. Уже выданные access токены действуют до истечения своего срока.
+func (as *Service) RevokeAllSessions(email string) error {
+	return revokeUserSessions(as.DB, email)
+}
+
+// RevokeUserSessions завершает все сеансы пользователя в транзакции tx, например вместе со сменой пароля
+func RevokeUserSessions(tx *sql.Tx, email string) error {
+	return revokeUserSessions(tx, email)
+}
+
+// revokeUserSessions отзывает refresh токены пользователя и токены его лент календаря
+func revokeUserSessions(db execer, email string) error {
+	_, err := db.Exec(`UPDATE refresh_token SET revoked_at = now() WHERE user_email = $1 AND revoked_at IS NULL`, email)
+	if err != nil {
+		return fmt.Errorf("не удалось отозвать refresh токены: %v", err)
+	}
+	_, err = db.Exec(`UPDATE calendar_feed_token SET revoked_at = now() WHERE user_email = $1 AND revoked_at IS NULL`, email)
+	if err != nil {
+		return fmt.Errorf("не удалось отозвать токены календаря: %v", err)
+	}
+	return nil
+}
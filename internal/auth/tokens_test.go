@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"book_talk/internal/database/dbtest"
+	"book_talk/internal/mail"
+	mw "book_talk/middleware"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	testEmail    = "user@example.com"
+	testPassword = "Secret-1"
+)
+
+// newTestService возвращает сервис над отдельной тестовой базой с одним активным подтвержденным пользователем testEmail
+func newTestService(t *testing.T) (*Service, *mail.MemorySender) {
+	t.Helper()
+	database := dbtest.Open(t)
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = database.Exec(`INSERT INTO users (email, password, first_name, last_name, email_verified_at) VALUES ($1, $2, 'Иван', 'Иванов', now())`,
+		testEmail, string(hashedPassword))
+	if err != nil {
+		t.Fatalf("не удалось создать пользователя: %v", err)
+	}
+
+	sender := mail.NewMemorySender()
+	as := NewAuthService(database)
+	as.Mailer = sender
+	return as, sender
+}
+
+func mustExec(t *testing.T, db *sql.DB, query string, args ...interface{}) {
+	t.Helper()
+	if _, err := db.Exec(query, args...); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, as *Service, refreshToken string) string // Возвращает предъявляемый токен
+		wantErr error
+	}{
+		{
+			name:    "valid token",
+			prepare: func(t *testing.T, as *Service, refreshToken string) string { return refreshToken },
+		},
+		{
+			name:    "malformed token",
+			prepare: func(t *testing.T, as *Service, refreshToken string) string { return "not-a-token" },
+			wantErr: ErrInvalidRefreshToken,
+		},
+		{
+			name: "access token instead of refresh",
+			prepare: func(t *testing.T, as *Service, refreshToken string) string {
+				accessToken, err := mw.GenerateAccessToken(testEmail)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return accessToken
+			},
+			wantErr: ErrInvalidRefreshToken,
+		},
+		{
+			name: "logged out",
+			prepare: func(t *testing.T, as *Service, refreshToken string) string {
+				if err := as.Logout(testEmail, refreshToken); err != nil {
+					t.Fatal(err)
+				}
+				return refreshToken
+			},
+			wantErr: ErrRefreshTokenReused,
+		},
+		{
+			name: "locked account",
+			prepare: func(t *testing.T, as *Service, refreshToken string) string {
+				mustExec(t, as.DB, `UPDATE users SET account_non_locked = false WHERE email = $1`, testEmail)
+				return refreshToken
+			},
+			wantErr: ErrAccountLocked,
+		},
+		{
+			name: "expired lock",
+			prepare: func(t *testing.T, as *Service, refreshToken string) string {
+				mustExec(t, as.DB, `UPDATE users SET account_non_locked = false, locked_until = now() - interval '1 minute' WHERE email = $1`, testEmail)
+				return refreshToken
+			},
+		},
+		{
+			name: "disabled account",
+			prepare: func(t *testing.T, as *Service, refreshToken string) string {
+				mustExec(t, as.DB, `UPDATE users SET enabled = false WHERE email = $1`, testEmail)
+				return refreshToken
+			},
+			wantErr: ErrAccountDisabled,
+		},
+		{
+			name: "unverified email",
+			prepare: func(t *testing.T, as *Service, refreshToken string) string {
+				mustExec(t, as.DB, `UPDATE users SET enabled = false, email_verified_at = NULL WHERE email = $1`, testEmail)
+				return refreshToken
+			},
+			wantErr: ErrEmailNotVerified,
+		},
+		{
+			name: "expired account",
+			prepare: func(t *testing.T, as *Service, refreshToken string) string {
+				mustExec(t, as.DB, `UPDATE users SET account_non_expired = false WHERE email = $1`, testEmail)
+				return refreshToken
+			},
+			wantErr: ErrAccountExpired,
+		},
+		{
+			name: "credentials marked expired",
+			prepare: func(t *testing.T, as *Service, refreshToken string) string {
+				mustExec(t, as.DB, `UPDATE users SET credentials_non_expired = false WHERE email = $1`, testEmail)
+				return refreshToken
+			},
+			wantErr: ErrCredentialsExpired,
+		},
+		{
+			name: "password older than max age",
+			prepare: func(t *testing.T, as *Service, refreshToken string) string {
+				mustExec(t, as.DB, `UPDATE users SET password_changed_at = now() - interval '1 year' WHERE email = $1`, testEmail)
+				return refreshToken
+			},
+			wantErr: ErrCredentialsExpired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			as, _ := newTestService(t)
+			_, refreshToken, err := as.startSession(testEmail)
+			if err != nil {
+				t.Fatalf("startSession: %v", err)
+			}
+
+			accessToken, newRefreshToken, err := as.RotateRefreshToken(tt.prepare(t, as, refreshToken))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("RotateRefreshToken() error = %v, want %v", err, tt.wantErr)
+				}
+				if accessToken != "" || newRefreshToken != "" {
+					t.Fatal("RotateRefreshToken() issued tokens together with an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RotateRefreshToken() error = %v", err)
+			}
+			if _, err := mw.ValidateAccessToken(accessToken); err != nil {
+				t.Errorf("issued access token is invalid: %v", err)
+			}
+			if newRefreshToken == refreshToken {
+				t.Error("refresh token was not rotated")
+			}
+		})
+	}
+}
+
+func TestRotateRefreshTokenReuseRevokesFamily(t *testing.T) {
+	as, _ := newTestService(t)
+	_, first, err := as.startSession(testEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, other, err := as.startSession(testEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, second, err := as.RotateRefreshToken(first)
+	if err != nil {
+		t.Fatalf("first rotation: %v", err)
+	}
+
+	// Повторное предъявление использованного токена отзывает все его семейство
+	if _, _, err := as.RotateRefreshToken(first); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reuse error = %v, want %v", err, ErrRefreshTokenReused)
+	}
+	if _, _, err := as.RotateRefreshToken(second); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("token of revoked family: error = %v, want %v", err, ErrRefreshTokenReused)
+	}
+
+	// Сеанс другого входа не затронут
+	if _, _, err := as.RotateRefreshToken(other); err != nil {
+		t.Fatalf("other session: %v", err)
+	}
+}
+
+func TestRevokeAllSessions(t *testing.T) {
+	as, _ := newTestService(t)
+	var tokens []string
+	for i := 0; i < 2; i++ {
+		_, refreshToken, err := as.startSession(testEmail)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, refreshToken)
+	}
+
+	if err := as.RevokeAllSessions(testEmail); err != nil {
+		t.Fatal(err)
+	}
+	for _, refreshToken := range tokens {
+		if _, _, err := as.RotateRefreshToken(refreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+			t.Errorf("RotateRefreshToken() after logout-all error = %v, want %v", err, ErrRefreshTokenReused)
+		}
+	}
+}
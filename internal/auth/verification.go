@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"book_talk/internal/mail"
+	mw "book_talk/middleware"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Назначение одноразовых токенов
+const (
+	PurposeVerifyEmail = "verify_email" // Подтверждение email после регистрации
+)
+
+// Настройки подтверждения email по умолчанию
+const (
+	DefaultVerificationTTL = 24 * time.Hour  // Срок действия ссылки из письма
+	ResendInterval         = 1 * time.Minute // Минимальный интервал между повторными письмами
+	DefaultBaseURL         = "http://localhost:8080"
+)
+
+var (
+	ErrInvalidActionToken = errors.New("ссылка недействительна")
+	ErrActionTokenExpired = errors.New("срок действия ссылки истек, запросите новую")
+	ErrActionTokenUsed    = errors.New("ссылка уже использована")
+	ErrResendTooSoon      = errors.New("письмо уже отправлено, повторить можно через минуту")
+)
+
+// createActionToken выпускает одноразовый токен пользователя для действия purpose.
+// Ранее выпущенные и еще не использованные токены того же назначения перестают действовать.
+func (as *Service) createActionToken(email, purpose string, ttl time.Duration) (string, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+	expiresAt := time.Now().Add(ttl)
+
+	tx, err := as.DB.Begin()
+	if err != nil {
+		return "", fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM action_token WHERE user_email = $1 AND purpose = $2 AND used_at IS NULL`, email, purpose); err != nil {
+		return "", fmt.Errorf("не удалось удалить прежние токены: %v", err)
+	}
+	_, err = tx.Exec(`INSERT INTO action_token (jti, user_email, purpose, expires_at) VALUES ($1, $2, $3, $4)`,
+		jti, email, purpose, expiresAt)
+	if err != nil {
+		return "", fmt.Errorf("не удалось сохранить токен: %v", err)
+	}
+
+	token, err := mw.GenerateActionToken(email, purpose, jti, expiresAt)
+	if err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+	return token, nil
+}
+
+// consumeActionToken проверяет подпись и срок действия токена, помечает его использованным и возвращает email
+func consumeActionToken(tx *sql.Tx, token, purpose string) (string, error) {
+	claims, err := mw.ParseToken(token, purpose)
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return "", ErrActionTokenExpired
+		}
+		return "", ErrInvalidActionToken
+	}
+
+	var email string
+	var usedAt sql.NullTime
+	err = tx.QueryRow(`
+		SELECT user_email, used_at FROM action_token WHERE jti = $1 AND purpose = $2 FOR UPDATE
+	`, claims.ID, purpose).Scan(&email, &usedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// Токен заменен более новым или пользователь удален
+			return "", ErrInvalidActionToken
+		}
+		return "", fmt.Errorf("ошибка при проверке токена: %v", err)
+	}
+	if usedAt.Valid {
+		return "", ErrActionTokenUsed
+	}
+
+	if _, err := tx.Exec(`UPDATE action_token SET used_at = now() WHERE jti = $1`, claims.ID); err != nil {
+		return "", fmt.Errorf("не удалось обновить токен: %v", err)
+	}
+	return email, nil
+}
+
+// sendVerification отправляет пользователю письмо со ссылкой для подтверждения email
+func (as *Service) sendVerification(email string) error {
+	token, err := as.createActionToken(email, PurposeVerifyEmail, as.VerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := as.BaseURL + "/api/v1/auth/verify-email?token=" + url.QueryEscape(token)
+	return as.Mailer.Send(mail.Message{
+		To:      email,
+		Subject: "Подтверждение email",
+		Body: "Чтобы завершить регистрацию, перейдите по ссылке:\n\n" + link + "\n\n" +
+			fmt.Sprintf("Ссылка действует %v. Если вы не регистрировались, просто проигнорируйте это письмо.\n", as.VerificationTTL),
+	})
+}
+
+// VerifyEmail подтверждает email по токену из письма и активирует аккаунт
+func (as *Service) VerifyEmail(token string) (string, error) {
+	tx, err := as.DB.Begin()
+	if err != nil {
+		return "", fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	email, err := consumeActionToken(tx, token, PurposeVerifyEmail)
+	if err != nil {
+		return "", err
+	}
+	// Ссылка активирует только аккаунт, ожидающий подтверждения регистрации,
+	// но не аккаунт, отключенный администратором после нее
+	result, err := tx.Exec(`
+		UPDATE users SET enabled = true, email_verified_at = now() WHERE email = $1 AND email_verified_at IS NULL
+	`, email)
+	if err != nil {
+		return "", fmt.Errorf("не удалось активировать аккаунт: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return "", ErrInvalidActionToken
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+	return email, nil
+}
+
+// ResendVerification повторно отправляет письмо с подтверждением, если регистрация еще не подтверждена.
+// Для неизвестных и уже подтвержденных адресов ничего не делает, чтобы ответ не раскрывал, зарегистрирован ли адрес.
+// Аккаунт, отключенный администратором, тоже считается подтвержденным и письма не получает.
+func (as *Service) ResendVerification(email string) error {
+	var verified bool
+	var lastSentAt sql.NullTime
+	err := as.DB.QueryRow(`
+		SELECT u.email_verified_at IS NOT NULL,
+			   (SELECT max(created_at) FROM action_token WHERE user_email = u.email AND purpose = $2)
+		FROM users u WHERE u.email = $1
+	`, email, PurposeVerifyEmail).Scan(&verified, &lastSentAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("ошибка при поиске пользователя: %v", err)
+	}
+	if verified {
+		return nil
+	}
+	if lastSentAt.Valid && time.Since(lastSentAt.Time) < ResendInterval {
+		return ErrResendTooSoon
+	}
+
+	return as.sendVerification(email)
+}
@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"book_talk/internal/mail"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// lastMailToken возвращает токен из последнего письма: из параметра token ссылки или из отдельной строки письма
+func lastMailToken(t *testing.T, sender *mail.MemorySender) string {
+	t.Helper()
+	messages := sender.Messages()
+	if len(messages) == 0 {
+		t.Fatal("письмо не отправлено")
+	}
+	for _, line := range strings.Split(messages[len(messages)-1].Body, "\n") {
+		if link, err := url.Parse(line); err == nil && link.Query().Get("token") != "" {
+			return link.Query().Get("token")
+		}
+		if strings.Count(line, ".") == 2 && !strings.Contains(line, " ") {
+			return line
+		}
+	}
+	t.Fatal("в письме нет токена")
+	return ""
+}
+
+func TestVerifyEmail(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   func(t *testing.T, as *Service, sender *mail.MemorySender) string
+		wantErr error
+	}{
+		{
+			name: "valid token",
+			token: func(t *testing.T, as *Service, sender *mail.MemorySender) string {
+				return lastMailToken(t, sender)
+			},
+		},
+		{
+			name: "used token",
+			token: func(t *testing.T, as *Service, sender *mail.MemorySender) string {
+				token := lastMailToken(t, sender)
+				if _, err := as.VerifyEmail(token); err != nil {
+					t.Fatal(err)
+				}
+				return token
+			},
+			wantErr: ErrActionTokenUsed,
+		},
+		{
+			name: "superseded by resend",
+			token: func(t *testing.T, as *Service, sender *mail.MemorySender) string {
+				token := lastMailToken(t, sender)
+				if err := as.sendVerification(testEmail); err != nil {
+					t.Fatal(err)
+				}
+				return token
+			},
+			wantErr: ErrInvalidActionToken,
+		},
+		{
+			name: "disabled by admin after verification",
+			token: func(t *testing.T, as *Service, sender *mail.MemorySender) string {
+				token := lastMailToken(t, sender)
+				mustExec(t, as.DB, `UPDATE users SET email_verified_at = now() WHERE email = $1`, testEmail)
+				return token
+			},
+			wantErr: ErrInvalidActionToken,
+		},
+		{
+			name: "expired token",
+			token: func(t *testing.T, as *Service, sender *mail.MemorySender) string {
+				token, err := as.createActionToken(testEmail, PurposeVerifyEmail, -time.Minute)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return token
+			},
+			wantErr: ErrActionTokenExpired,
+		},
+		{
+			name: "password reset token",
+			token: func(t *testing.T, as *Service, sender *mail.MemorySender) string {
+				token, err := as.createActionToken(testEmail, PurposePasswordReset, time.Hour)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return token
+			},
+			wantErr: ErrInvalidActionToken,
+		},
+		{
+			name: "malformed token",
+			token: func(t *testing.T, as *Service, sender *mail.MemorySender) string {
+				return "not-a-token"
+			},
+			wantErr: ErrInvalidActionToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			as, sender := newTestService(t)
+			mustExec(t, as.DB, `UPDATE users SET enabled = false, email_verified_at = NULL WHERE email = $1`, testEmail)
+			if err := as.sendVerification(testEmail); err != nil {
+				t.Fatal(err)
+			}
+			token := tt.token(t, as, sender)
+			mustExec(t, as.DB, `UPDATE users SET enabled = false WHERE email = $1`, testEmail)
+
+			email, err := as.VerifyEmail(token)
+			var enabled bool
+			if err := as.DB.QueryRow(`SELECT enabled FROM users WHERE email = $1`, testEmail).Scan(&enabled); err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("VerifyEmail() error = %v, want %v", err, tt.wantErr)
+				}
+				if enabled {
+					t.Error("account enabled by a rejected token")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyEmail() error = %v", err)
+			}
+			if email != testEmail || !enabled {
+				t.Errorf("VerifyEmail() = %q, enabled = %v; want %q, true", email, enabled, testEmail)
+			}
+		})
+	}
+}
+
+func TestResendVerification(t *testing.T) {
+	tests := []struct {
+		name      string
+		email     string
+		state     string // Изменение пользователя перед запросом
+		wantMails int
+	}{
+		{name: "waiting for verification", email: testEmail, state: "enabled = false, email_verified_at = NULL", wantMails: 1},
+		{name: "already verified", email: testEmail, wantMails: 0},
+		{name: "disabled by admin", email: testEmail, state: "enabled = false", wantMails: 0},
+		{name: "unknown email", email: "nobody@example.com", wantMails: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			as, sender := newTestService(t)
+			if tt.state != "" {
+				mustExec(t, as.DB, `UPDATE users SET `+tt.state+` WHERE email = $1`, testEmail)
+			}
+			if err := as.ResendVerification(tt.email); err != nil {
+				t.Fatal(err)
+			}
+			if got := len(sender.Messages()); got != tt.wantMails {
+				t.Errorf("sent %d messages, want %d", got, tt.wantMails)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package bookings
+
+import (
+	"book_talk/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// DefaultApprovalTTL - сколько бронирование может ожидать согласования, если не задано иное
+const DefaultApprovalTTL = 48 * time.Hour
+
+var (
+	ErrBookingPending  = errors.New("бронирование ожидает согласования")
+	ErrBookingRejected = errors.New("бронирование отклонено")
+	ErrApprovalExpired = errors.New("срок согласования бронирования истек")
+	ErrNotPending      = errors.New("бронирование не ожидает согласования")
+)
+
+// ApprovalDecision - решение по бронированию, ожидающему согласования
+type ApprovalDecision struct {
+	Comment string `json:"comment"` // Комментарий согласующего, сохраняется в истории
+}
+
+// approvalRequiredTx проверяет, требует ли комната согласования бронирований
+func approvalRequiredTx(tx *sql.Tx, roomID int) (bool, error) {
+	var required bool
+	err := tx.QueryRow(`SELECT approval_required FROM room WHERE id = $1`, roomID).Scan(&required)
+	if err != nil {
+		return false, fmt.Errorf("ошибка при получении комнаты: %v", err)
+	}
+	return required, nil
+}
+
+// canApprove проверяет, может ли пользователь согласовывать бронирования комнаты: администратор,
+// обладатель роли из списка согласующих комнаты или сотрудник указанного в нем отдела
+func (s *Service) canApprove(email string, roomID int) (bool, error) {
+	isAdmin, err := s.RoleService.IsAdmin(email)
+	if err != nil || isAdmin {
+		return isAdmin, err
+	}
+
+	var allowed bool
+	err = s.DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM room_approver ra
+			WHERE ra.room_id = $2 AND (
+				ra.authority IN (
+					SELECT r.authority FROM role r
+					WHERE r.user_email = $1 OR r.id IN (SELECT role_id FROM user_role WHERE user_email = $1)
+				)
+				OR ra.department_id = (SELECT department_id FROM users WHERE email = $1)
+			)
+		)
+	`, email, roomID).Scan(&allowed)
+	if err != nil {
+		return false, fmt.Errorf("ошибка при проверке согласующих комнаты: %v", err)
+	}
+	return allowed, nil
+}
+
+// initialStatusTx определяет статус нового или перенесенного бронирования комнаты: PENDING со сроком
+// согласования, если комната требует согласования, а пользователь не может согласовать его сам, иначе ACTIVE.
+// Срок согласования не выходит за начало бронирования.
+func (s *Service) initialStatusTx(tx *sql.Tx, email string, roomID int, start time.Time) (string, sql.NullTime, error) {
+	required, err := approvalRequiredTx(tx, roomID)
+	if err != nil || !required {
+		return models.BookingStatusActive, sql.NullTime{}, err
+	}
+	allowed, err := s.canApprove(email, roomID)
+	if err != nil || allowed {
+		return models.BookingStatusActive, sql.NullTime{}, err
+	}
+
+	expiresAt := time.Now().Add(s.ApprovalTTL)
+	if start.Before(expiresAt) {
+		expiresAt = start
+	}
+	return models.BookingStatusPending, sql.NullTime{Time: expiresAt, Valid: true}, nil
+}
+
+// GetPendingApprovals возвращает бронирования, ожидающие решения пользователя, начиная с самых срочных
+func (s *Service) GetPendingApprovals(email string) ([]models.Booking, error) {
+	isAdmin, err := s.RoleService.IsAdmin(email)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.DB.Query(bookingSelect+`
+		WHERE b.status = $1 AND b.approval_expires_at > now() AND (
+			$2 OR EXISTS (
+				SELECT 1 FROM room_approver ra
+				WHERE ra.room_id = b.room_id AND (
+					ra.authority IN (
+						SELECT ro.authority FROM role ro
+						WHERE ro.user_email = $3 OR ro.id IN (SELECT role_id FROM user_role WHERE user_email = $3)
+					)
+					OR ra.department_id = (SELECT department_id FROM users WHERE email = $3)
+				)
+			)
+		)
+		ORDER BY b.approval_expires_at, b.id
+	`, models.BookingStatusPending, isAdmin, email)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении бронирований на согласование: %v", err)
+	}
+	defer rows.Close()
+
+	bookings := []models.Booking{}
+	for rows.Next() {
+		booking, err := scanBooking(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при обработке бронирований: %v", err)
+		}
+		bookings = append(bookings, booking)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.loadAttendees(bookings); err != nil {
+		return nil, err
+	}
+	return bookings, nil
+}
+
+// ApproveBooking согласует бронирование: оно становится активным
+func (s *Service) ApproveBooking(email string, id int, decision ApprovalDecision) (*models.Booking, error) {
+	return s.decideBooking(email, id, decision, true)
+}
+
+// RejectBooking отклоняет бронирование: оно освобождает комнату, а интервал предлагается листу ожидания
+func (s *Service) RejectBooking(email string, id int, decision ApprovalDecision) (*models.Booking, error) {
+	return s.decideBooking(email, id, decision, false)
+}
+
+func (s *Service) decideBooking(email string, id int, decision ApprovalDecision, approve bool) (*models.Booking, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	var item storedBooking
+	var start, end, expiresAt sql.NullTime
+	err = tx.QueryRow(`
+		SELECT id, room_id, start_time, end_time, status, approval_expires_at
+		FROM booking WHERE id = $1 FOR UPDATE
+	`, id).Scan(&item.id, &item.roomID, &start, &end, &item.status, &expiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrBookingNotFound
+		}
+		return nil, fmt.Errorf("ошибка при получении бронирования: %v", err)
+	}
+	item.start, item.end = start.Time, end.Time
+
+	allowed, err := s.canApprove(email, item.roomID)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ErrForbidden
+	}
+	if item.status != models.BookingStatusPending {
+		return nil, ErrNotPending
+	}
+	if expiresAt.Valid && !expiresAt.Time.After(time.Now()) {
+		return nil, ErrApprovalExpired
+	}
+
+	status, action := models.BookingStatusActive, HistoryApproved
+	if !approve {
+		status, action = models.BookingStatusRejected, HistoryRejected
+	}
+	_, err = tx.Exec(`UPDATE booking SET status = $1, approval_expires_at = NULL WHERE id = $2`, status, id)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось сохранить решение по бронированию: %v", err)
+	}
+	if err := recordHistoryTx(tx, id, email, action, decision.Comment); err != nil {
+		return nil, err
+	}
+	if !approve {
+		if err := s.offerFreedSlotTx(tx, item.roomID, item.start, item.end); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+
+	return s.GetBooking(id)
+}
+
+// ExpireApprovals переводит в статус EXPIRED бронирования, по которым не приняли решение в срок,
+// и предлагает освободившееся время листу ожидания. Возвращает число просроченных бронирований.
+func (s *Service) ExpireApprovals() (int, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		UPDATE booking SET status = $1
+		WHERE status = $2 AND approval_expires_at <= now()
+		RETURNING id, room_id, start_time, end_time
+	`, models.BookingStatusExpired, models.BookingStatusPending)
+	if err != nil {
+		return 0, fmt.Errorf("не удалось обработать просроченные согласования: %v", err)
+	}
+
+	var expired []storedBooking
+	for rows.Next() {
+		var item storedBooking
+		if err := rows.Scan(&item.id, &item.roomID, &item.start, &item.end); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("ошибка при обработке просроченных согласований: %v", err)
+		}
+		expired = append(expired, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, item := range expired {
+		if err := recordHistoryTx(tx, item.id, historySystemActor, HistoryExpired, "решение по бронированию не принято в срок"); err != nil {
+			return 0, err
+		}
+		if err := s.offerFreedSlotTx(tx, item.roomID, item.start, item.end); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+	return len(expired), nil
+}
+
+// RunApprovalExpirer раз в interval закрывает просроченные согласования, пока не отменен ctx
+func (s *Service) RunApprovalExpirer(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		expired, err := s.ExpireApprovals()
+		if err != nil {
+			log.Println("Ошибка при обработке просроченных согласований:", err)
+		} else if expired > 0 {
+			log.Printf("Просрочено бронирований, ожидавших согласования: %d", expired)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
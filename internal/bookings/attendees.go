@@ -0,0 +1,130 @@
+package bookings
+
+import (
+	"book_talk/internal/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrUnknownAttendee  = errors.New("участник не зарегистрирован, пригласите его как гостя")
+	ErrInvalidGuest     = errors.New("у гостя должно быть указано имя")
+	ErrCapacityExceeded = errors.New("число участников превышает вместимость комнаты")
+)
+
+// Guest - внешний гость, не зарегистрированный в системе
+type Guest struct {
+	Name  string `json:"name"`  // Имя гостя
+	Email string `json:"email"` // Email гостя, необязателен
+}
+
+// saveAttendeesTx заменяет участников бронирования. nil означает, что соответствующий список не меняется.
+// Владелец бронирования не считается приглашенным, повторяющиеся адреса сохраняются один раз.
+func saveAttendeesTx(tx *sql.Tx, bookingID int, owner string, emails *[]string, guests *[]Guest) error {
+	if emails != nil {
+		if _, err := tx.Exec(`DELETE FROM booking_attendee WHERE booking_id = $1 AND user_email IS NOT NULL`, bookingID); err != nil {
+			return fmt.Errorf("не удалось обновить участников бронирования: %v", err)
+		}
+
+		seen := map[string]bool{strings.ToLower(owner): true}
+		for _, email := range *emails {
+			key := strings.ToLower(strings.TrimSpace(email))
+			if key == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			var registered string
+			err := tx.QueryRow(`SELECT email FROM users WHERE lower(email) = $1`, key).Scan(&registered)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return fmt.Errorf("%w: %s", ErrUnknownAttendee, strings.TrimSpace(email))
+				}
+				return fmt.Errorf("ошибка при поиске участника: %v", err)
+			}
+			if _, err := tx.Exec(`INSERT INTO booking_attendee (booking_id, user_email) VALUES ($1, $2)`, bookingID, registered); err != nil {
+				return fmt.Errorf("не удалось сохранить участника бронирования: %v", err)
+			}
+		}
+	}
+
+	if guests != nil {
+		if _, err := tx.Exec(`DELETE FROM booking_attendee WHERE booking_id = $1 AND user_email IS NULL`, bookingID); err != nil {
+			return fmt.Errorf("не удалось обновить гостей бронирования: %v", err)
+		}
+
+		for _, guest := range *guests {
+			name := strings.TrimSpace(guest.Name)
+			if name == "" {
+				return ErrInvalidGuest
+			}
+			_, err := tx.Exec(`INSERT INTO booking_attendee (booking_id, guest_name, guest_email) VALUES ($1, $2, NULLIF($3, ''))`,
+				bookingID, name, strings.TrimSpace(guest.Email))
+			if err != nil {
+				return fmt.Errorf("не удалось сохранить гостя бронирования: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkCapacityTx проверяет, что владелец вместе с участниками помещается в комнату
+func checkCapacityTx(tx *sql.Tx, bookingID, roomID int) error {
+	var headcount, capacity int
+	err := tx.QueryRow(`
+		SELECT 1 + (SELECT count(*) FROM booking_attendee WHERE booking_id = $1), capacity
+		FROM room WHERE id = $2
+	`, bookingID, roomID).Scan(&headcount, &capacity)
+	if err != nil {
+		return fmt.Errorf("ошибка при проверке вместимости комнаты: %v", err)
+	}
+	if headcount > capacity {
+		return fmt.Errorf("%w: участников %d, мест %d", ErrCapacityExceeded, headcount, capacity)
+	}
+	return nil
+}
+
+// loadAttendees заполняет участников бронирований: сначала зарегистрированных пользователей, затем гостей
+func (s *Service) loadAttendees(bookings []models.Booking) error {
+	if len(bookings) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(bookings))
+	index := make(map[int]int, len(bookings))
+	for i, booking := range bookings {
+		ids[i] = int64(booking.ID)
+		index[booking.ID] = i
+	}
+
+	rows, err := s.DB.Query(`
+		SELECT a.booking_id, COALESCE(u.email, a.guest_email, ''), COALESCE(u.first_name, ''), COALESCE(u.last_name, ''),
+			   COALESCE(a.guest_name, ''), a.user_email IS NULL
+		FROM booking_attendee a
+		LEFT JOIN users u ON u.email = a.user_email
+		WHERE a.booking_id = ANY($1)
+		ORDER BY a.user_email IS NULL, a.id
+	`, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("ошибка при получении участников бронирований: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bookingID int
+		var attendee models.Attendee
+		err := rows.Scan(&bookingID, &attendee.Email, &attendee.FirstName, &attendee.LastName, &attendee.Name, &attendee.Guest)
+		if err != nil {
+			return fmt.Errorf("ошибка при обработке участников бронирований: %v", err)
+		}
+		booking := &bookings[index[bookingID]]
+		booking.Attendees = append(booking.Attendees, attendee)
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,179 @@
+package bookings
+
+import (
+	"book_talk/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// CheckInOpensBefore - за сколько до начала бронирования можно отметиться о приходе
+const CheckInOpensBefore = 15 * time.Minute
+
+var (
+	ErrAlreadyCheckedIn = errors.New("приход уже отмечен")
+	ErrCheckInTooEarly  = fmt.Errorf("отметиться о приходе можно не раньше чем за %d минут до начала", int(CheckInOpensBefore.Minutes()))
+)
+
+// NoShowStat - число неявок пользователя
+type NoShowStat struct {
+	Email        string     `json:"email"`
+	FirstName    string     `json:"firstName"`
+	LastName     string     `json:"lastName"`
+	Count        int        `json:"count"`        // Сколько бронирований пользователя было освобождено из-за неявки
+	LastNoShowAt *time.Time `json:"lastNoShowAt"` // Когда было освобождено последнее из них
+}
+
+// CheckIn отмечает приход в забронированную комнату
+func (s *Service) CheckIn(email string, id int) (*models.Booking, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	item, err := s.loadBookingTx(tx, id, email)
+	if err != nil {
+		return nil, err
+	}
+	if err := item.checkModifiable(); err != nil {
+		return nil, err
+	}
+	if item.status == models.BookingStatusPending {
+		return nil, ErrBookingPending
+	}
+	if item.checkedIn {
+		return nil, ErrAlreadyCheckedIn
+	}
+	if time.Now().Before(item.start.Add(-CheckInOpensBefore)) {
+		return nil, ErrCheckInTooEarly
+	}
+
+	if _, err := tx.Exec(`UPDATE booking SET checked_in_at = now() WHERE id = $1`, id); err != nil {
+		return nil, fmt.Errorf("не удалось отметить приход: %v", err)
+	}
+	if err := recordHistoryTx(tx, id, email, HistoryCheckedIn, ""); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+
+	return s.GetBooking(id)
+}
+
+// ReleaseNoShows освобождает бронирования, в которых никто не отметился о приходе в течение grace
+// после начала, увеличивает счетчик неявок их владельцев и предлагает освободившееся время листу ожидания.
+// Освобождаются только еще не закончившиеся бронирования: завершившиеся до запуска процесса считаются состоявшимися.
+// Возвращает число освобожденных бронирований.
+func (s *Service) ReleaseNoShows(grace time.Duration) (int, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		UPDATE booking SET status = $1
+		WHERE status = $2 AND checked_in_at IS NULL AND period IS NOT NULL
+		  AND start_time <= now() - make_interval(secs => $3) AND end_time > now()
+		RETURNING id, user_email, room_id, start_time, end_time
+	`, models.BookingStatusNoShow, models.BookingStatusActive, grace.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("не удалось освободить бронирования: %v", err)
+	}
+
+	var released []storedBooking
+	for rows.Next() {
+		var item storedBooking
+		if err := rows.Scan(&item.id, &item.email, &item.roomID, &item.start, &item.end); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("ошибка при обработке освобожденных бронирований: %v", err)
+		}
+		released = append(released, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	comment := fmt.Sprintf("никто не отметился о приходе в течение %v после начала", grace)
+	for _, item := range released {
+		if err := recordHistoryTx(tx, item.id, historySystemActor, HistoryNoShow, comment); err != nil {
+			return 0, err
+		}
+		_, err := tx.Exec(`UPDATE users SET no_show_count = no_show_count + 1, last_no_show_at = now() WHERE email = $1`, item.email)
+		if err != nil {
+			return 0, fmt.Errorf("не удалось обновить счетчик неявок: %v", err)
+		}
+		if err := s.offerFreedSlotTx(tx, item.roomID, item.start, item.end); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+	return len(released), nil
+}
+
+// RunNoShowReleaser раз в interval освобождает неподтвержденные бронирования, пока не отменен ctx
+func (s *Service) RunNoShowReleaser(ctx context.Context, interval, grace time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		released, err := s.ReleaseNoShows(grace)
+		if err != nil {
+			log.Println("Ошибка при освобождении неподтвержденных бронирований:", err)
+		} else if released > 0 {
+			log.Printf("Освобождено неподтвержденных бронирований: %d", released)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// GetNoShowStats возвращает пользователей с неявками, начиная с самых частых.
+// Администратор видит всех пользователей, остальные - только себя.
+func (s *Service) GetNoShowStats(email string) ([]NoShowStat, error) {
+	isAdmin, err := s.RoleService.IsAdmin(email)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT email, first_name, last_name, no_show_count, last_no_show_at
+		FROM users
+		WHERE no_show_count > 0 AND ($1 OR email = $2)
+		ORDER BY no_show_count DESC, email
+	`
+	rows, err := s.DB.Query(query, isAdmin, email)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении статистики неявок: %v", err)
+	}
+	defer rows.Close()
+
+	stats := []NoShowStat{}
+	for rows.Next() {
+		var stat NoShowStat
+		var lastNoShowAt sql.NullTime
+		if err := rows.Scan(&stat.Email, &stat.FirstName, &stat.LastName, &stat.Count, &lastNoShowAt); err != nil {
+			return nil, fmt.Errorf("ошибка при обработке статистики неявок: %v", err)
+		}
+		if lastNoShowAt.Valid {
+			stat.LastNoShowAt = &lastNoShowAt.Time
+		}
+		stats = append(stats, stat)
+	}
+
+	return stats, rows.Err()
+}
@@ -0,0 +1,155 @@
+package bookings
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrDelegateNotFound   = errors.New("пользователь, которому предоставляется доступ, не найден")
+	ErrSelfDelegation     = errors.New("нельзя предоставить доступ самому себе")
+	ErrDelegationExists   = errors.New("доступ этому пользователю уже предоставлен")
+	ErrDelegationNotFound = errors.New("доступ не найден")
+	ErrNotDelegate        = errors.New("владелец не разрешал вам бронировать от его имени")
+)
+
+// Delegation - разрешение делегату создавать и изменять бронирования от имени владельца
+type Delegation struct {
+	OwnerEmail    string    `json:"ownerEmail"`    // Кто разрешил бронировать от своего имени
+	DelegateEmail string    `json:"delegateEmail"` // Кому разрешено
+	FirstName     string    `json:"firstName"`     // Имя второго участника: делегата для выданных, владельца для полученных
+	LastName      string    `json:"lastName"`      // Фамилия второго участника
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// Delegations - разрешения, выданные пользователем и полученные им
+type Delegations struct {
+	Granted  []Delegation `json:"granted"`  // Кто может бронировать от имени пользователя
+	Received []Delegation `json:"received"` // От чьего имени может бронировать пользователь
+}
+
+// isDelegate проверяет, разрешил ли owner пользователю delegate бронировать от своего имени
+func (s *Service) isDelegate(owner, delegate string) (bool, error) {
+	var allowed bool
+	err := s.DB.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM booking_delegate WHERE owner_email = $1 AND delegate_email = $2)
+	`, owner, delegate).Scan(&allowed)
+	if err != nil {
+		return false, fmt.Errorf("ошибка при проверке делегирования: %v", err)
+	}
+	return allowed, nil
+}
+
+// resolveOwner определяет владельца создаваемого бронирования: сам пользователь, если onBehalfOf пуст
+// или совпадает с ним, иначе onBehalfOf при условии, что тот разрешил пользователю бронировать за себя
+func (s *Service) resolveOwner(email, onBehalfOf string) (string, error) {
+	onBehalfOf = strings.TrimSpace(onBehalfOf)
+	if onBehalfOf == "" || strings.EqualFold(onBehalfOf, email) {
+		return email, nil
+	}
+
+	var owner string
+	err := s.DB.QueryRow(`
+		SELECT owner_email FROM booking_delegate WHERE lower(owner_email) = lower($1) AND delegate_email = $2
+	`, onBehalfOf, email).Scan(&owner)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNotDelegate
+		}
+		return "", fmt.Errorf("ошибка при проверке делегирования: %v", err)
+	}
+	return owner, nil
+}
+
+// GetDelegations возвращает разрешения, выданные пользователем и полученные им
+func (s *Service) GetDelegations(email string) (*Delegations, error) {
+	granted, err := s.queryDelegations(`
+		SELECT d.owner_email, d.delegate_email, u.first_name, u.last_name, d.created_at
+		FROM booking_delegate d
+		JOIN users u ON u.email = d.delegate_email
+		WHERE d.owner_email = $1
+		ORDER BY u.last_name, u.first_name
+	`, email)
+	if err != nil {
+		return nil, err
+	}
+
+	received, err := s.queryDelegations(`
+		SELECT d.owner_email, d.delegate_email, u.first_name, u.last_name, d.created_at
+		FROM booking_delegate d
+		JOIN users u ON u.email = d.owner_email
+		WHERE d.delegate_email = $1
+		ORDER BY u.last_name, u.first_name
+	`, email)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Delegations{Granted: granted, Received: received}, nil
+}
+
+func (s *Service) queryDelegations(query, email string) ([]Delegation, error) {
+	rows, err := s.DB.Query(query, email)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении делегирований: %v", err)
+	}
+	defer rows.Close()
+
+	delegations := []Delegation{}
+	for rows.Next() {
+		var delegation Delegation
+		err := rows.Scan(&delegation.OwnerEmail, &delegation.DelegateEmail, &delegation.FirstName, &delegation.LastName, &delegation.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при обработке делегирований: %v", err)
+		}
+		delegations = append(delegations, delegation)
+	}
+
+	return delegations, rows.Err()
+}
+
+// GrantDelegation разрешает пользователю delegate создавать и изменять бронирования от имени owner
+func (s *Service) GrantDelegation(owner, delegate string) error {
+	delegate = strings.TrimSpace(delegate)
+	if strings.EqualFold(owner, delegate) {
+		return ErrSelfDelegation
+	}
+
+	var registered string
+	err := s.DB.QueryRow(`SELECT email FROM users WHERE lower(email) = lower($1)`, delegate).Scan(&registered)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrDelegateNotFound
+		}
+		return fmt.Errorf("ошибка при поиске пользователя: %v", err)
+	}
+
+	_, err = s.DB.Exec(`INSERT INTO booking_delegate (owner_email, delegate_email) VALUES ($1, $2)`, owner, registered)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" { // unique_violation
+			return ErrDelegationExists
+		}
+		return fmt.Errorf("не удалось сохранить делегирование: %v", err)
+	}
+	return nil
+}
+
+// RevokeDelegation отзывает разрешение. Уже созданные делегатом бронирования остаются у владельца.
+func (s *Service) RevokeDelegation(owner, delegate string) error {
+	result, err := s.DB.Exec(`
+		DELETE FROM booking_delegate WHERE owner_email = $1 AND lower(delegate_email) = lower($2)
+	`, owner, strings.TrimSpace(delegate))
+	if err != nil {
+		return fmt.Errorf("не удалось удалить делегирование: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrDelegationNotFound
+	}
+	return nil
+}
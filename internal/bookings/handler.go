@@ -1 +1,838 @@
 package bookings
+
+import (
+	"book_talk/internal/ical"
+	"book_talk/internal/models"
+	"book_talk/internal/roles"
+	"book_talk/internal/rooms"
+	mw "book_talk/middleware"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Максимальный размер загружаемого файла iCalendar
+const maxImportSize = 10 << 20
+
+type Handler struct {
+	BookingService *Service
+	RoleService    *roles.Service
+}
+
+// Новый хэндлер для инициализации с сервисом
+func NewBookingsHandler(db *sql.DB) *Handler {
+	return &Handler{
+		BookingService: NewBookingsService(db),
+		RoleService:    roles.NewRolesService(db),
+	}
+}
+
+// sendBookingError отправляет ответ с кодом, соответствующим ошибке сервиса
+func sendBookingError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrBookingNotFound), errors.Is(err, rooms.ErrRoomNotFound),
+		errors.Is(err, ErrSeriesNotFound), errors.Is(err, ErrOccurrenceNotFound), errors.Is(err, ErrWaitlistEntryNotFound),
+		errors.Is(err, ErrQuotaNotFound), errors.Is(err, ErrDelegateNotFound), errors.Is(err, ErrDelegationNotFound):
+		mw.SendJSONResponse(w, &models.Response{Message: err.Error()}, http.StatusNotFound) // 404
+	case errors.Is(err, ErrBookingConflict), errors.Is(err, ErrBookingCancelled), errors.Is(err, ErrBookingFinished),
+		errors.Is(err, ErrBookingNoShow), errors.Is(err, ErrAlreadyCheckedIn), errors.Is(err, ErrCheckInTooEarly),
+		errors.Is(err, ErrBookingOffered), errors.Is(err, ErrAlreadyWaiting), errors.Is(err, ErrSlotAvailable),
+		errors.Is(err, ErrWaitlistClosed), errors.Is(err, ErrOfferNotActive), errors.Is(err, ErrBookingPending),
+		errors.Is(err, ErrBookingRejected), errors.Is(err, ErrApprovalExpired), errors.Is(err, ErrNotPending),
+		errors.Is(err, ErrQuotaExceeded), errors.Is(err, ErrQuotaExists), errors.Is(err, ErrDelegationExists),
+		errors.Is(err, rooms.ErrRoomClosed):
+		mw.SendJSONResponse(w, &models.Response{Message: err.Error()}, http.StatusConflict) // 409
+	case errors.Is(err, ErrForbidden), errors.Is(err, ErrNotDelegate):
+		mw.SendJSONResponse(w, &models.Response{Message: err.Error()}, http.StatusForbidden) // 403
+	case errors.Is(err, ErrInvalidInterval), errors.Is(err, ErrBookingInPast), errors.Is(err, ErrRoomInactive),
+		errors.Is(err, ical.ErrInvalidRule), errors.Is(err, ical.ErrUnboundedRule), errors.Is(err, ErrInvalidScope),
+		errors.Is(err, ErrSeriesDateChange), errors.Is(err, ErrEmptySeries), errors.Is(err, ErrInvalidTimeZone),
+		errors.Is(err, ical.ErrInvalidCalendar), errors.Is(err, ErrImportTooLarge), errors.Is(err, ErrUnknownAttendee),
+		errors.Is(err, ErrInvalidGuest), errors.Is(err, ErrCapacityExceeded), errors.Is(err, rooms.ErrPolicyViolation),
+		errors.Is(err, ErrInvalidQuota), errors.Is(err, ErrSelfDelegation), errors.Is(err, rooms.ErrInvalidTimeZone):
+		mw.SendJSONResponse(w, &models.Response{Message: err.Error()}, http.StatusBadRequest) // 400
+	default:
+		mw.SendJSONResponse(w, &models.Response{Message: "Внутренняя ошибка сервера: " + err.Error()}, http.StatusInternalServerError) // 500
+	}
+}
+
+func (h *Handler) CreateBooking(w http.ResponseWriter, r *http.Request) {
+	email, ok := r.Context().Value("email").(string)
+	if !ok {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Unauthorized",
+		}, http.StatusUnauthorized)
+		return
+	}
+
+	var req BookingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	booking, err := h.BookingService.CreateBooking(email, req)
+	if err != nil {
+		sendBookingError(w, err)
+		return
+	}
+
+	message := "Комната забронирована"
+	if booking.Status == models.BookingStatusPending {
+		message = "Бронирование создано и ожидает согласования"
+	}
+	mw.SendJSONResponse(w, &models.Response{
+		Message: message,
+		Data:    map[string]models.Booking{"booking": *booking},
+	}, http.StatusCreated)
+}
+
+// bookingID извлекает идентификатор бронирования из пути запроса
+func bookingID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id <= 0 {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный идентификатор бронирования"}, http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// displayLocation определяет по параметру timeZone часовой пояс, в котором показывается время бронирований.
+// nil означает местное время комнаты.
+func (h *Handler) displayLocation(w http.ResponseWriter, r *http.Request) (*time.Location, bool) {
+	param := r.URL.Query().Get("timeZone")
+	var userZone string
+	if param == rooms.DisplayZoneUser {
+		email, _ := r.Context().Value("email").(string)
+		var err error
+		if userZone, err = h.BookingService.userTimeZone(email); err != nil {
+			sendBookingError(w, err)
+			return nil, false
+		}
+	}
+
+	loc, err := rooms.DisplayLocation(param, userZone)
+	if err != nil {
+		sendBookingError(w, err)
+		return nil, false
+	}
+	return loc, true
+}
+
+// renderBookings переводит время бронирований в часовой пояс loc, если он задан
+func renderBookings(bookings []models.Booking, loc *time.Location) {
+	if loc == nil {
+		return
+	}
+	for i := range bookings {
+		bookings[i].InLocation(loc)
+	}
+}
+
+// GetBooking возвращает бронирование владельцу, участникам, делегатам владельца, согласующим и администратору
+func (h *Handler) GetBooking(w http.ResponseWriter, r *http.Request) {
+	email, ok := r.Context().Value("email").(string)
+	if !ok {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Unauthorized",
+		}, http.StatusUnauthorized)
+		return
+	}
+
+	id, ok := bookingID(w, r)
+	if !ok {
+		return
+	}
+	loc, ok := h.displayLocation(w, r)
+	if !ok {
+		return
+	}
+
+	booking, err := h.BookingService.GetVisibleBooking(email, id)
+	if err != nil {
+		sendBookingError(w, err)
+		return
+	}
+	if loc != nil {
+		booking.InLocation(loc)
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Бронирование успешно получено",
+		Data:    map[string]models.Booking{"booking": *booking},
+	}, http.StatusOK)
+}
+
+func (h *Handler) UpdateBooking(w http.ResponseWriter, r *http.Request) {
+	email, ok := r.Context().Value("email").(string)
+	if !ok {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Unauthorized",
+		}, http.StatusUnauthorized)
+		return
+	}
+
+	id, ok := bookingID(w, r)
+	if !ok {
+		return
+	}
+
+	var req BookingUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	booking, err := h.BookingService.UpdateBooking(email, id, req)
+	if err != nil {
+		sendBookingError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Бронирование изменено",
+		Data:    map[string]models.Booking{"booking": *booking},
+	}, http.StatusOK)
+}
+
+// CancelBooking отменяет бронирование. Причину отмены можно передать параметром reason.
+func (h *Handler) CancelBooking(w http.ResponseWriter, r *http.Request) {
+	email, ok := r.Context().Value("email").(string)
+	if !ok {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Unauthorized",
+		}, http.StatusUnauthorized)
+		return
+	}
+
+	id, ok := bookingID(w, r)
+	if !ok {
+		return
+	}
+
+	booking, err := h.BookingService.CancelBooking(email, id, r.URL.Query().Get("reason"))
+	if err != nil {
+		sendBookingError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Бронирование отменено",
+		Data:    map[string]models.Booking{"booking": *booking},
+	}, http.StatusOK)
+}
+
+func (h *Handler) GetBookingHistory(w http.ResponseWriter, r *http.Request) {
+	email, ok := r.Context().Value("email").(string)
+	if !ok {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Unauthorized",
+		}, http.StatusUnauthorized)
+		return
+	}
+
+	id, ok := bookingID(w, r)
+	if !ok {
+		return
+	}
+
+	history, err := h.BookingService.GetBookingHistory(email, id)
+	if err != nil {
+		sendBookingError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "История бронирования успешно получена",
+		Data:    map[string][]models.BookingHistoryEntry{"history": history},
+	}, http.StatusOK)
+}
+
+func (h *Handler) CheckIn(w http.ResponseWriter, r *http.Request) {
+	email, ok := r.Context().Value("email").(string)
+	if !ok {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Unauthorized",
+		}, http.StatusUnauthorized)
+		return
+	}
+
+	id, ok := bookingID(w, r)
+	if !ok {
+		return
+	}
+
+	booking, err := h.BookingService.CheckIn(email, id)
+	if err != nil {
+		sendBookingError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Приход отмечен",
+		Data:    map[string]models.Booking{"booking": *booking},
+	}, http.StatusOK)
+}
+
+func (h *Handler) GetPendingApprovals(w http.ResponseWriter, r *http.Request) {
+	email, ok := r.Context().Value("email").(string)
+	if !ok {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Unauthorized",
+		}, http.StatusUnauthorized)
+		return
+	}
+	loc, ok := h.displayLocation(w, r)
+	if !ok {
+		return
+	}
+
+	bookings, err := h.BookingService.GetPendingApprovals(email)
+	if err != nil {
+		sendBookingError(w, err)
+		return
+	}
+	renderBookings(bookings, loc)
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Бронирования на согласование получены",
+		Data:    map[string][]models.Booking{"bookings": bookings},
+	}, http.StatusOK)
+}
+
+func (h *Handler) ApproveBooking(w http.ResponseWriter, r *http.Request) {
+	h.decideBooking(w, r, true)
+}
+
+func (h *Handler) RejectBooking(w http.ResponseWriter, r *http.Request) {
+	h.decideBooking(w, r, false)
+}
+
+// decideBooking принимает решение по бронированию. Тело запроса с комментарием необязательно.
+func (h *Handler) decideBooking(w http.ResponseWriter, r *http.Request, approve bool) {
+	email, ok := r.Context().Value("email").(string)
+	if !ok {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Unauthorized",
+		}, http.StatusUnauthorized)
+		return
+	}
+
+	id, ok := bookingID(w, r)
+	if !ok {
+		return
+	}
+
+	var decision ApprovalDecision
+	if err := json.NewDecoder(r.Body).Decode(&decision); err != nil && !errors.Is(err, io.EOF) {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	var booking *models.Booking
+	var err error
+	message := "Бронирование согласовано"
+	if approve {
+		booking, err = h.BookingService.ApproveBooking(email, id, decision)
+	} else {
+		booking, err = h.BookingService.RejectBooking(email, id, decision)
+		message = "Бронирование отклонено"
+	}
+	if err != nil {
+		sendBookingError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: message,
+		Data:    map[string]models.Booking{"booking": *booking},
+	}, http.StatusOK)
+}
+
+func (h *Handler) GetNoShowStats(w http.ResponseWriter, r *http.Request) {
+	email, ok := r.Context().Value("email").(string)
+	if !ok {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Unauthorized",
+		}, http.StatusUnauthorized)
+		return
+	}
+
+	stats, err := h.BookingService.GetNoShowStats(email)
+	if err != nil {
+		sendBookingError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Статистика неявок успешно получена",
+		Data:    map[string][]NoShowStat{"noShows": stats},
+	}, http.StatusOK)
+}
+
+func (h *Handler) JoinWaitlist(w http.ResponseWriter, r *http.Request) {
+	email, ok := r.Context().Value("email").(string)
+	if !ok {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Unauthorized",
+		}, http.StatusUnauthorized)
+		return
+	}
+
+	var req WaitlistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	entry, err := h.BookingService.JoinWaitlist(email, req)
+	if err != nil {
+		sendBookingError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Вы добавлены в лист ожидания",
+		Data:    map[string]WaitlistEntry{"entry": *entry},
+	}, http.StatusCreated)
+}
+
+func (h *Handler) GetWaitlist(w http.ResponseWriter, r *http.Request) {
+	email, ok := r.Context().Value("email").(string)
+	if !ok {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Unauthorized",
+		}, http.StatusUnauthorized)
+		return
+	}
+
+	entries, err := h.BookingService.GetWaitlist(email)
+	if err != nil {
+		sendBookingError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Лист ожидания успешно получен",
+		Data:    map[string][]WaitlistEntry{"entries": entries},
+	}, http.StatusOK)
+}
+
+// waitlistEntryID извлекает идентификатор записи листа ожидания из пути запроса
+func waitlistEntryID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id <= 0 {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный идентификатор записи листа ожидания"}, http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func (h *Handler) AcceptWaitlistOffer(w http.ResponseWriter, r *http.Request) {
+	email, ok := r.Context().Value("email").(string)
+	if !ok {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Unauthorized",
+		}, http.StatusUnauthorized)
+		return
+	}
+
+	id, ok := waitlistEntryID(w, r)
+	if !ok {
+		return
+	}
+
+	booking, err := h.BookingService.AcceptWaitlistOffer(email, id)
+	if err != nil {
+		sendBookingError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Предложение принято, комната забронирована",
+		Data:    map[string]models.Booking{"booking": *booking},
+	}, http.StatusOK)
+}
+
+// LeaveWaitlist удаляет запись из листа ожидания, действующее предложение при этом отклоняется
+func (h *Handler) LeaveWaitlist(w http.ResponseWriter, r *http.Request) {
+	email, ok := r.Context().Value("email").(string)
+	if !ok {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Unauthorized",
+		}, http.StatusUnauthorized)
+		return
+	}
+
+	id, ok := waitlistEntryID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.BookingService.LeaveWaitlist(email, id); err != nil {
+		sendBookingError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{Message: "Запись удалена из листа ожидания"}, http.StatusOK)
+}
+
+// seriesID извлекает идентификатор серии из пути запроса
+func seriesID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id <= 0 {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный идентификатор серии"}, http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// sendSeriesResult отправляет отчет по повторениям серии. При конфликте отчет передается вместе с кодом 409.
+func sendSeriesResult(w http.ResponseWriter, result *SeriesResult, err error, message string, statusCode int) {
+	if err != nil {
+		if result != nil && errors.Is(err, ErrNothingBooked) {
+			mw.SendJSONResponse(w, &models.Response{Message: err.Error(), Data: result}, http.StatusUnprocessableEntity)
+			return
+		}
+		if result != nil && errors.Is(err, ErrBookingConflict) {
+			mw.SendJSONResponse(w, &models.Response{Message: err.Error(), Data: result}, http.StatusConflict)
+			return
+		}
+		sendBookingError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{Message: message, Data: result}, statusCode)
+}
+
+func (h *Handler) CreateSeries(w http.ResponseWriter, r *http.Request) {
+	email, ok := r.Context().Value("email").(string)
+	if !ok {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Unauthorized",
+		}, http.StatusUnauthorized)
+		return
+	}
+
+	var req SeriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.BookingService.CreateSeries(email, req)
+	sendSeriesResult(w, result, err, "Серия бронирований создана", http.StatusCreated)
+}
+
+// GetSeries возвращает серию владельцу, участникам ее повторений, делегатам владельца, согласующим и администратору
+func (h *Handler) GetSeries(w http.ResponseWriter, r *http.Request) {
+	email, ok := r.Context().Value("email").(string)
+	if !ok {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Unauthorized",
+		}, http.StatusUnauthorized)
+		return
+	}
+
+	id, ok := seriesID(w, r)
+	if !ok {
+		return
+	}
+	loc, ok := h.displayLocation(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := h.BookingService.GetVisibleSeries(email, id)
+	if err != nil {
+		sendBookingError(w, err)
+		return
+	}
+	renderBookings(result.Bookings, loc)
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Серия бронирований успешно получена",
+		Data:    map[string]models.BookingSeries{"series": *result},
+	}, http.StatusOK)
+}
+
+func (h *Handler) UpdateSeries(w http.ResponseWriter, r *http.Request) {
+	email, ok := r.Context().Value("email").(string)
+	if !ok {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Unauthorized",
+		}, http.StatusUnauthorized)
+		return
+	}
+
+	id, ok := seriesID(w, r)
+	if !ok {
+		return
+	}
+
+	var req SeriesUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.BookingService.UpdateSeries(email, id, req)
+	sendSeriesResult(w, result, err, "Серия бронирований обновлена", http.StatusOK)
+}
+
+func (h *Handler) CancelSeries(w http.ResponseWriter, r *http.Request) {
+	email, ok := r.Context().Value("email").(string)
+	if !ok {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Unauthorized",
+		}, http.StatusUnauthorized)
+		return
+	}
+
+	id, ok := seriesID(w, r)
+	if !ok {
+		return
+	}
+
+	// scope по умолчанию - вся серия, occurrence - исходное начало повторения в формате RFC 3339
+	scope := Scope(r.URL.Query().Get("scope"))
+	if scope == "" {
+		scope = ScopeAll
+	}
+	var occurrence time.Time
+	if occurrenceStr := r.URL.Query().Get("occurrence"); occurrenceStr != "" {
+		parsed, err := time.Parse(time.RFC3339, occurrenceStr)
+		if err != nil {
+			mw.SendJSONResponse(w, &models.Response{Message: "Некорректное значение occurrence, ожидается RFC 3339"}, http.StatusBadRequest)
+			return
+		}
+		occurrence = parsed
+	}
+
+	if err := h.BookingService.CancelSeries(email, id, scope, occurrence); err != nil {
+		sendBookingError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{Message: "Бронирования серии отменены"}, http.StatusOK)
+}
+
+// ImportBookings импортирует события из файла iCalendar в бронирования комнаты.
+// Файл передается телом запроса, параметр dryRun=true позволяет получить отчет без сохранения.
+// Импорт доступен только администраторам, так как бронирования создаются от имени организаторов событий.
+func (h *Handler) ImportBookings(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	email, ok := r.Context().Value("email").(string)
+	if !ok {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Unauthorized",
+		}, http.StatusUnauthorized)
+		return
+	}
+
+	isAdmin, err := h.RoleService.IsAdmin(email)
+	if err != nil {
+		sendBookingError(w, err)
+		return
+	}
+	if !isAdmin {
+		mw.SendJSONResponse(w, &models.Response{Message: "Недостаточно прав"}, http.StatusForbidden)
+		return
+	}
+
+	roomID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || roomID <= 0 {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный идентификатор комнаты"}, http.StatusBadRequest)
+		return
+	}
+
+	dryRun := false
+	if dryRunStr := r.URL.Query().Get("dryRun"); dryRunStr != "" {
+		dryRun, err = strconv.ParseBool(dryRunStr)
+		if err != nil {
+			mw.SendJSONResponse(w, &models.Response{Message: "Некорректное значение dryRun"}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxImportSize)
+	result, err := h.BookingService.ImportBookings(email, roomID, body, dryRun)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			mw.SendJSONResponse(w, &models.Response{Message: "Файл слишком большой"}, http.StatusRequestEntityTooLarge)
+			return
+		}
+		sendBookingError(w, err)
+		return
+	}
+
+	message := "Импорт завершен"
+	if dryRun {
+		message = "Пробный импорт завершен, бронирования не сохранены"
+	}
+	mw.SendJSONResponse(w, &models.Response{Message: message, Data: result}, http.StatusOK)
+}
+
+// GetQuotaUsage возвращает действующие для пользователя квоты и их остаток.
+// Параметр at (RFC3339) выбирает неделю для квот на часы, по умолчанию - текущая неделя.
+// Параметр roomId считает неделю в часовом поясе комнаты, по умолчанию - в часовом поясе пользователя.
+func (h *Handler) GetQuotaUsage(w http.ResponseWriter, r *http.Request) {
+	email, ok := r.Context().Value("email").(string)
+	if !ok {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Unauthorized",
+		}, http.StatusUnauthorized)
+		return
+	}
+
+	at := time.Now()
+	if atStr := r.URL.Query().Get("at"); atStr != "" {
+		var err error
+		at, err = time.Parse(time.RFC3339, atStr)
+		if err != nil {
+			mw.SendJSONResponse(w, &models.Response{Message: "Некорректный формат at, ожидается RFC3339"}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	roomID := 0
+	if roomStr := r.URL.Query().Get("roomId"); roomStr != "" {
+		var err error
+		roomID, err = strconv.Atoi(roomStr)
+		if err != nil || roomID <= 0 {
+			mw.SendJSONResponse(w, &models.Response{Message: "Некорректный идентификатор комнаты"}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	usage, err := h.BookingService.GetQuotaUsage(email, at, roomID)
+	if err != nil {
+		sendBookingError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Остаток квот успешно получен",
+		Data:    map[string][]QuotaUsage{"quotas": usage},
+	}, http.StatusOK)
+}
+
+func (h *Handler) GetQuotas(w http.ResponseWriter, r *http.Request) {
+	quotas, err := h.BookingService.GetQuotas()
+	if err != nil {
+		sendBookingError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Квоты успешно получены",
+		Data:    map[string][]Quota{"quotas": quotas},
+	}, http.StatusOK)
+}
+
+func (h *Handler) CreateQuota(w http.ResponseWriter, r *http.Request) {
+	var quota Quota
+	if err := json.NewDecoder(r.Body).Decode(&quota); err != nil {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.BookingService.CreateQuota(quota)
+	if err != nil {
+		sendBookingError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Квота успешно создана",
+		Data:    map[string]Quota{"quota": *created},
+	}, http.StatusCreated)
+}
+
+func (h *Handler) DeleteQuota(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id <= 0 {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный идентификатор квоты"}, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.BookingService.DeleteQuota(id); err != nil {
+		sendBookingError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{Message: "Квота успешно удалена"}, http.StatusOK)
+}
+
+// DelegationRequest - запрос на предоставление доступа к бронированиям
+type DelegationRequest struct {
+	Email string `json:"email"` // Email пользователя, которому разрешается бронировать от имени текущего
+}
+
+func (h *Handler) GetDelegations(w http.ResponseWriter, r *http.Request) {
+	email, ok := r.Context().Value("email").(string)
+	if !ok {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Unauthorized",
+		}, http.StatusUnauthorized)
+		return
+	}
+
+	delegations, err := h.BookingService.GetDelegations(email)
+	if err != nil {
+		sendBookingError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Делегирования успешно получены",
+		Data:    map[string]Delegations{"delegations": *delegations},
+	}, http.StatusOK)
+}
+
+func (h *Handler) GrantDelegation(w http.ResponseWriter, r *http.Request) {
+	email, ok := r.Context().Value("email").(string)
+	if !ok {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Unauthorized",
+		}, http.StatusUnauthorized)
+		return
+	}
+
+	var req DelegationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.BookingService.GrantDelegation(email, req.Email); err != nil {
+		sendBookingError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{Message: "Доступ к бронированиям успешно предоставлен"}, http.StatusCreated)
+}
+
+func (h *Handler) RevokeDelegation(w http.ResponseWriter, r *http.Request) {
+	email, ok := r.Context().Value("email").(string)
+	if !ok {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Unauthorized",
+		}, http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.BookingService.RevokeDelegation(email, mux.Vars(r)["email"]); err != nil {
+		sendBookingError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{Message: "Доступ к бронированиям успешно отозван"}, http.StatusOK)
+}
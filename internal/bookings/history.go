@@ -0,0 +1,73 @@
+package bookings
+
+import (
+	"book_talk/internal/models"
+	"database/sql"
+	"fmt"
+)
+
+// Действия, которые записываются в историю бронирования
+const (
+	HistoryCreated   = "created"
+	HistoryUpdated   = "updated"
+	HistoryCancelled = "cancelled"
+	HistoryCheckedIn = "checked_in"
+	HistoryNoShow    = "no_show"
+	HistoryApproved  = "approved"
+	HistoryRejected  = "rejected"
+	HistoryExpired   = "expired"
+)
+
+// historySystemActor - автор изменений, которые выполняются фоновыми процессами
+const historySystemActor = "system"
+
+// recordHistoryTx записывает в историю текущее состояние бронирования после изменения
+func recordHistoryTx(tx *sql.Tx, bookingID int, actor, action, comment string) error {
+	_, err := tx.Exec(`
+		INSERT INTO booking_history (booking_id, action, changed_by, room_id, start_time, end_time, status, comment)
+		SELECT id, $2, $3, room_id, start_time, end_time, status, $4 FROM booking WHERE id = $1
+	`, bookingID, action, actor, comment)
+	if err != nil {
+		return fmt.Errorf("не удалось сохранить историю бронирования: %v", err)
+	}
+	return nil
+}
+
+// GetBookingHistory возвращает историю изменений бронирования в хронологическом порядке.
+// Историю видят только владелец бронирования, его делегаты и администратор;
+// тот, кто не видит само бронирование, получает ErrBookingNotFound.
+func (s *Service) GetBookingHistory(email string, id int) ([]models.BookingHistoryEntry, error) {
+	booking, err := s.GetVisibleBooking(email, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkCanManage(email, booking.User.Email); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.DB.Query(`
+		SELECT id, action, changed_by, changed_at, room_id, start_time, end_time, status, comment
+		FROM booking_history
+		WHERE booking_id = $1
+		ORDER BY changed_at, id
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении истории бронирования: %v", err)
+	}
+	defer rows.Close()
+
+	history := []models.BookingHistoryEntry{}
+	for rows.Next() {
+		var entry models.BookingHistoryEntry
+		var start, end sql.NullTime
+		err := rows.Scan(&entry.ID, &entry.Action, &entry.ChangedBy, &entry.ChangedAt, &entry.RoomID,
+			&start, &end, &entry.Status, &entry.Comment)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при обработке истории бронирования: %v", err)
+		}
+		entry.Start, entry.End = start.Time, end.Time
+		history = append(history, entry)
+	}
+
+	return history, rows.Err()
+}
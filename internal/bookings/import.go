@@ -0,0 +1,241 @@
+package bookings
+
+import (
+	"book_talk/internal/ical"
+	"book_talk/internal/rooms"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ImportStatus - результат импорта отдельного события
+type ImportStatus string
+
+const (
+	ImportCreated  ImportStatus = "created"
+	ImportSkipped  ImportStatus = "skipped"
+	ImportConflict ImportStatus = "conflict"
+)
+
+// Ограничения импорта
+const (
+	MaxImportEvents   = 2000 // Максимальное число бронирований в одном файле после разворачивания повторений
+	importHorizonDays = 365  // Повторяющиеся события разворачиваются не дальше этого числа дней вперед
+)
+
+var ErrImportTooLarge = fmt.Errorf("файл содержит больше %d бронирований", MaxImportEvents)
+
+// ImportEventResult - отчет по одному событию (или экземпляру повторяющегося события)
+type ImportEventResult struct {
+	UID          string       `json:"uid"`                    // UID события из файла
+	RecurrenceID *time.Time   `json:"recurrenceId,omitempty"` // Начало экземпляра повторяющегося события
+	Summary      string       `json:"summary,omitempty"`      // Заголовок события
+	Start        time.Time    `json:"start"`                  // Начало бронирования
+	End          time.Time    `json:"end"`                    // Окончание бронирования
+	Owner        string       `json:"owner,omitempty"`        // Владелец бронирования
+	Status       ImportStatus `json:"status"`                 // created, skipped или conflict
+	Reason       string       `json:"reason,omitempty"`       // Причина пропуска или конфликта
+	BookingID    int          `json:"bookingId,omitempty"`    // Созданное бронирование, не заполняется при пробном импорте
+}
+
+// ImportResult - отчет об импорте файла
+type ImportResult struct {
+	RoomID    int                 `json:"roomId"`
+	DryRun    bool                `json:"dryRun"`    // Пробный импорт: бронирования не сохранены
+	Created   int                 `json:"created"`   // Число созданных бронирований
+	Skipped   int                 `json:"skipped"`   // Число пропущенных событий
+	Conflicts int                 `json:"conflicts"` // Число событий, пересекающихся с другими бронированиями
+	Events    []ImportEventResult `json:"events"`
+}
+
+// importItem - экземпляр события, который нужно превратить в бронирование
+type importItem struct {
+	event        ical.Event
+	start, end   time.Time
+	recurrenceID time.Time
+	err          error
+}
+
+// ImportBookings создает бронирования комнаты из событий файла iCalendar.
+// Каждое событие проходит те же проверки, что и обычное бронирование. Владельцем бронирования
+// становится зарегистрированный пользователь из ORGANIZER, иначе - импортирующий пользователь.
+// При dryRun все изменения откатываются, но отчет формируется так же, как при настоящем импорте.
+func (s *Service) ImportBookings(email string, roomID int, r io.Reader, dryRun bool) (*ImportResult, error) {
+	// Время событий без часового пояса относится к местному времени комнаты
+	loc, err := s.roomLocation(roomID)
+	if err != nil {
+		return nil, err
+	}
+	calendar, err := ical.Decode(r, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	items := expandImportEvents(calendar.Events, now, now.AddDate(0, 0, importHorizonDays))
+	if len(items) > MaxImportEvents {
+		return nil, ErrImportTooLarge
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Ошибки комнаты относятся ко всему файлу, а не к отдельным событиям
+	if _, _, err := checkRoomTx(tx, roomID); err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{RoomID: roomID, DryRun: dryRun, Events: []ImportEventResult{}}
+	owners := map[string]string{}
+	for _, item := range items {
+		entry := ImportEventResult{
+			UID:     item.event.UID,
+			Summary: item.event.Summary,
+			Start:   item.start,
+			End:     item.end,
+		}
+		if !item.recurrenceID.IsZero() {
+			recurrenceID := item.recurrenceID
+			entry.RecurrenceID = &recurrenceID
+		}
+
+		switch {
+		case item.err != nil:
+			entry.Status, entry.Reason = ImportSkipped, item.err.Error()
+		case item.event.Status == "CANCELLED":
+			entry.Status, entry.Reason = ImportSkipped, "событие отменено"
+		case item.event.AllDay:
+			entry.Status, entry.Reason = ImportSkipped, "события на весь день не импортируются"
+		default:
+			owner, err := s.importOwnerTx(tx, owners, item.event.Organizer, email)
+			if err != nil {
+				return nil, err
+			}
+			entry.Owner = owner
+
+			req := BookingRequest{
+				RoomID:      roomID,
+				Start:       item.start,
+				End:         item.end,
+				externalUID: importKey(item.event.UID, item.recurrenceID),
+				actor:       email,
+			}
+			var id int
+			err = withSavepoint(tx, func() error {
+				var err error
+				id, err = s.createBookingTx(tx, owner, req)
+				return err
+			})
+
+			switch {
+			case err == nil:
+				entry.Status = ImportCreated
+				if !dryRun {
+					entry.BookingID = id
+				}
+			case errors.Is(err, ErrBookingConflict):
+				entry.Status, entry.Reason = ImportConflict, err.Error()
+			case errors.Is(err, ErrBookingInPast), errors.Is(err, ErrInvalidInterval), errors.Is(err, ErrAlreadyImported),
+				errors.Is(err, rooms.ErrPolicyViolation), errors.Is(err, ErrCapacityExceeded), errors.Is(err, ErrQuotaExceeded),
+				errors.Is(err, rooms.ErrRoomClosed):
+				entry.Status, entry.Reason = ImportSkipped, err.Error()
+			default:
+				return nil, err
+			}
+		}
+
+		switch entry.Status {
+		case ImportCreated:
+			result.Created++
+		case ImportConflict:
+			result.Conflicts++
+		default:
+			result.Skipped++
+		}
+		result.Events = append(result.Events, entry)
+	}
+
+	if dryRun {
+		return result, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+
+	return result, nil
+}
+
+// expandImportEvents разворачивает повторяющиеся события в экземпляры, начинающиеся в [from, to).
+// Экземпляры, замененные отдельными событиями с RECURRENCE-ID, пропускаются.
+func expandImportEvents(events []ical.Event, from, to time.Time) []importItem {
+	overridden := map[string]bool{}
+	for _, event := range events {
+		if event.Err == nil && !event.RecurrenceID.IsZero() {
+			overridden[importKey(event.UID, event.RecurrenceID)] = true
+		}
+	}
+
+	var items []importItem
+	for _, event := range events {
+		switch {
+		case event.Err != nil:
+			items = append(items, importItem{event: event, err: event.Err})
+		case !event.RecurrenceID.IsZero():
+			items = append(items, importItem{event: event, start: event.Start, end: event.End, recurrenceID: event.RecurrenceID})
+		case event.RRule == "":
+			items = append(items, importItem{event: event, start: event.Start, end: event.End})
+		default:
+			instances, err := event.Instances(from, to)
+			if err != nil {
+				items = append(items, importItem{event: event, start: event.Start, end: event.End, err: err})
+				continue
+			}
+			duration := event.End.Sub(event.Start)
+			for _, start := range instances {
+				if overridden[importKey(event.UID, start)] {
+					continue
+				}
+				items = append(items, importItem{event: event, start: start, end: start.Add(duration), recurrenceID: start})
+			}
+		}
+	}
+
+	return items
+}
+
+// importKey формирует идентификатор импортированного бронирования из UID события и начала экземпляра
+func importKey(uid string, recurrenceID time.Time) string {
+	if recurrenceID.IsZero() {
+		return uid
+	}
+	return uid + "/" + recurrenceID.UTC().Format("20060102T150405Z")
+}
+
+// importOwnerTx возвращает email зарегистрированного пользователя-организатора или email импортирующего
+func (s *Service) importOwnerTx(tx *sql.Tx, cache map[string]string, organizer, fallback string) (string, error) {
+	organizer = strings.ToLower(strings.TrimSpace(organizer))
+	if organizer == "" {
+		return fallback, nil
+	}
+	if owner, ok := cache[organizer]; ok {
+		return owner, nil
+	}
+
+	var owner string
+	err := tx.QueryRow(`SELECT email FROM users WHERE lower(email) = $1`, organizer).Scan(&owner)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("ошибка при поиске организатора: %v", err)
+		}
+		owner = fallback
+	}
+
+	cache[organizer] = owner
+	return owner, nil
+}
@@ -0,0 +1,302 @@
+package bookings
+
+import (
+	"book_talk/internal/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Область действия квоты
+const (
+	QuotaScopeUser       = "USER"       // Квота действует на каждого пользователя отдельно
+	QuotaScopeDepartment = "DEPARTMENT" // Квота действует на все бронирования сотрудников отдела вместе
+)
+
+// Вид квоты
+const (
+	QuotaHoursPerWeek   = "HOURS_PER_WEEK"  // Часы бронирований, начинающихся в одной календарной неделе
+	QuotaFutureBookings = "FUTURE_BOOKINGS" // Число еще не закончившихся бронирований
+)
+
+var (
+	ErrQuotaExceeded = errors.New("превышена квота бронирований")
+	ErrQuotaNotFound = errors.New("квота не найдена")
+	ErrQuotaExists   = errors.New("такая квота уже задана")
+	ErrInvalidQuota  = errors.New("некорректная квота: область USER или DEPARTMENT, вид HOURS_PER_WEEK или FUTURE_BOOKINGS, лимит не меньше нуля")
+)
+
+// quotaStatuses - статусы бронирований, которые расходуют квоту. Предложения из листа ожидания
+// расходуют квоту только после того, как пользователь их примет.
+var quotaStatuses = []string{models.BookingStatusActive, models.BookingStatusPending}
+
+// Quota - ограничение на бронирования. Квота без отдела действует по умолчанию,
+// квота для конкретного отдела заменяет ее для этого отдела и его сотрудников.
+type Quota struct {
+	ID           int    `json:"id"`
+	Scope        string `json:"scope"`                  // USER или DEPARTMENT
+	Kind         string `json:"kind"`                   // HOURS_PER_WEEK или FUTURE_BOOKINGS
+	DepartmentID *int   `json:"departmentId,omitempty"` // Отдел, для которого действует квота; пусто - для всех
+	Limit        int    `json:"limit"`                  // Часы в неделю или число будущих бронирований
+}
+
+// QuotaUsage - сколько квоты израсходовано и сколько осталось
+type QuotaUsage struct {
+	Quota
+	Used        float64    `json:"used"`                  // Израсходовано: часы или число бронирований
+	Remaining   float64    `json:"remaining"`             // Осталось, не меньше нуля
+	PeriodStart *time.Time `json:"periodStart,omitempty"` // Начало недели для квоты на часы
+	PeriodEnd   *time.Time `json:"periodEnd,omitempty"`   // Окончание недели для квоты на часы
+}
+
+type rowQueryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func scanQuota(row rowScanner) (Quota, error) {
+	var quota Quota
+	var departmentID sql.NullInt64
+	if err := row.Scan(&quota.ID, &quota.Scope, &quota.Kind, &departmentID, &quota.Limit); err != nil {
+		return quota, err
+	}
+	if departmentID.Valid {
+		id := int(departmentID.Int64)
+		quota.DepartmentID = &id
+	}
+	return quota, nil
+}
+
+// GetQuotas возвращает все заданные квоты
+func (s *Service) GetQuotas() ([]Quota, error) {
+	rows, err := s.DB.Query(`
+		SELECT id, scope, kind, department_id, limit_value FROM booking_quota
+		ORDER BY scope, kind, department_id NULLS FIRST
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении квот: %v", err)
+	}
+	defer rows.Close()
+
+	quotas := []Quota{}
+	for rows.Next() {
+		quota, err := scanQuota(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при обработке квот: %v", err)
+		}
+		quotas = append(quotas, quota)
+	}
+
+	return quotas, rows.Err()
+}
+
+// CreateQuota добавляет квоту. Квоты уже созданных бронирований не пересчитываются.
+func (s *Service) CreateQuota(quota Quota) (*Quota, error) {
+	if (quota.Scope != QuotaScopeUser && quota.Scope != QuotaScopeDepartment) ||
+		(quota.Kind != QuotaHoursPerWeek && quota.Kind != QuotaFutureBookings) || quota.Limit < 0 {
+		return nil, ErrInvalidQuota
+	}
+
+	var departmentID sql.NullInt64
+	if quota.DepartmentID != nil {
+		departmentID = sql.NullInt64{Int64: int64(*quota.DepartmentID), Valid: true}
+	}
+	err := s.DB.QueryRow(`
+		INSERT INTO booking_quota (scope, kind, department_id, limit_value) VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, quota.Scope, quota.Kind, departmentID, quota.Limit).Scan(&quota.ID)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) {
+			switch pqErr.Code {
+			case "23505": // unique_violation
+				return nil, ErrQuotaExists
+			case "23503": // foreign_key_violation
+				return nil, ErrInvalidQuota
+			}
+		}
+		return nil, fmt.Errorf("не удалось сохранить квоту: %v", err)
+	}
+
+	return &quota, nil
+}
+
+// DeleteQuota удаляет квоту
+func (s *Service) DeleteQuota(id int) error {
+	result, err := s.DB.Exec(`DELETE FROM booking_quota WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("не удалось удалить квоту: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrQuotaNotFound
+	}
+	return nil
+}
+
+// effectiveQuotas возвращает квоты, действующие для сотрудника отдела: квоты отдела заменяют квоты по умолчанию
+func effectiveQuotas(q queryer, departmentID sql.NullInt64) ([]Quota, error) {
+	rows, err := q.Query(`
+		SELECT id, scope, kind, department_id, limit_value FROM booking_quota
+		WHERE department_id IS NULL OR department_id = $1
+		ORDER BY department_id NULLS FIRST
+	`, departmentID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении квот: %v", err)
+	}
+	defer rows.Close()
+
+	var quotas []Quota
+	index := map[string]int{}
+	for rows.Next() {
+		quota, err := scanQuota(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при обработке квот: %v", err)
+		}
+		// Квота отдела для пользователя без отдела не применяется
+		if quota.Scope == QuotaScopeDepartment && !departmentID.Valid {
+			continue
+		}
+		key := quota.Scope + "/" + quota.Kind
+		if i, ok := index[key]; ok {
+			quotas[i] = quota
+			continue
+		}
+		index[key] = len(quotas)
+		quotas = append(quotas, quota)
+	}
+
+	return quotas, rows.Err()
+}
+
+// quotaUsed возвращает, сколько квоты израсходовано без учета бронирования excludeID:
+// часы бронирований, начинающихся в неделе week, или число еще не закончившихся бронирований
+func quotaUsed(q rowQueryer, quota Quota, email string, departmentID sql.NullInt64, week time.Time, excludeID int) (float64, error) {
+	owner := "b.user_email = $1"
+	var target interface{} = email
+	if quota.Scope == QuotaScopeDepartment {
+		owner = "b.user_email IN (SELECT email FROM users WHERE department_id = $1)"
+		target = departmentID.Int64
+	}
+
+	var query string
+	args := []interface{}{target, pq.Array(quotaStatuses), excludeID}
+	switch quota.Kind {
+	case QuotaHoursPerWeek:
+		query = `SELECT COALESCE(sum(extract(epoch FROM b.end_time - b.start_time)) / 3600, 0) FROM booking b
+			WHERE ` + owner + ` AND b.status = ANY($2) AND b.id <> $3 AND b.start_time >= $4 AND b.start_time < $5`
+		args = append(args, week, week.AddDate(0, 0, 7))
+	default:
+		query = `SELECT count(*) FROM booking b
+			WHERE ` + owner + ` AND b.status = ANY($2) AND b.id <> $3 AND b.end_time > now()`
+	}
+
+	var used float64
+	if err := q.QueryRow(query, args...).Scan(&used); err != nil {
+		return 0, fmt.Errorf("ошибка при подсчете использования квоты: %v", err)
+	}
+	return used, nil
+}
+
+// checkQuotasTx проверяет, что бронирование владельца email на интервал [start, end) не превышает квот.
+// excludeID - переносимое бронирование, которое не учитывается в израсходованной квоте (0 для нового).
+// Неделя для квот на часы определяется в часовом поясе комнаты loc.
+// Строки пользователя и отдела блокируются, чтобы одновременные бронирования не превысили квоту вместе.
+func checkQuotasTx(tx *sql.Tx, email string, excludeID int, start, end time.Time, loc *time.Location) error {
+	var departmentID sql.NullInt64
+	err := tx.QueryRow(`SELECT department_id FROM users WHERE email = $1 FOR UPDATE`, email).Scan(&departmentID)
+	if err != nil {
+		return fmt.Errorf("ошибка при получении пользователя: %v", err)
+	}
+	if departmentID.Valid {
+		if _, err := tx.Exec(`SELECT 1 FROM department WHERE id = $1 FOR UPDATE`, departmentID.Int64); err != nil {
+			return fmt.Errorf("ошибка при получении отдела: %v", err)
+		}
+	}
+
+	quotas, err := effectiveQuotas(tx, departmentID)
+	if err != nil {
+		return err
+	}
+
+	week := startOfWeek(start, loc)
+	for _, quota := range quotas {
+		used, err := quotaUsed(tx, quota, email, departmentID, week, excludeID)
+		if err != nil {
+			return err
+		}
+
+		requested := 1.0
+		if quota.Kind == QuotaHoursPerWeek {
+			requested = end.Sub(start).Hours()
+		}
+		if used+requested > float64(quota.Limit) {
+			return fmt.Errorf("%w: %s", ErrQuotaExceeded, describeQuota(quota, used))
+		}
+	}
+
+	return nil
+}
+
+// describeQuota формирует понятное пользователю описание квоты и ее использования
+func describeQuota(quota Quota, used float64) string {
+	owner := "пользователя"
+	if quota.Scope == QuotaScopeDepartment {
+		owner = "отдела"
+	}
+	if quota.Kind == QuotaHoursPerWeek {
+		return fmt.Sprintf("не больше %d ч. в неделю для %s, уже забронировано %.1f ч.", quota.Limit, owner, used)
+	}
+	return fmt.Sprintf("не больше %d будущих бронирований для %s, уже есть %d", quota.Limit, owner, int(used))
+}
+
+// GetQuotaUsage возвращает действующие для пользователя квоты и их остаток. Квоты на часы считаются
+// для недели, в которую попадает at: в часовом поясе комнаты roomID, а если она не задана (0) -
+// в часовом поясе из профиля пользователя.
+func (s *Service) GetQuotaUsage(email string, at time.Time, roomID int) ([]QuotaUsage, error) {
+	var departmentID sql.NullInt64
+	var timeZone string
+	err := s.DB.QueryRow(`SELECT department_id, time_zone FROM users WHERE email = $1`, email).Scan(&departmentID, &timeZone)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении пользователя: %v", err)
+	}
+
+	loc := zoneLocation(timeZone)
+	if roomID != 0 {
+		if loc, err = s.roomLocation(roomID); err != nil {
+			return nil, err
+		}
+	}
+
+	quotas, err := effectiveQuotas(s.DB, departmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	week := startOfWeek(at, loc)
+	weekEnd := week.AddDate(0, 0, 7)
+	usage := []QuotaUsage{}
+	for _, quota := range quotas {
+		used, err := quotaUsed(s.DB, quota, email, departmentID, week, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		item := QuotaUsage{Quota: quota, Used: used, Remaining: max(float64(quota.Limit)-used, 0)}
+		if quota.Kind == QuotaHoursPerWeek {
+			item.PeriodStart, item.PeriodEnd = &week, &weekEnd
+		}
+		usage = append(usage, item)
+	}
+
+	return usage, nil
+}
+
+// startOfWeek возвращает полночь понедельника недели, в которую попадает t, в часовом поясе loc
+func startOfWeek(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	year, month, day := t.Date()
+	offset := (int(t.Weekday()) + 6) % 7
+	return time.Date(year, month, day-offset, 0, 0, 0, 0, t.Location())
+}
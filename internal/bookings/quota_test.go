@@ -0,0 +1,146 @@
+package bookings
+
+import (
+	"book_talk/internal/database/dbtest"
+	"errors"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func TestStartOfWeek(t *testing.T) {
+	moscow := mustLoadLocation(t, "Europe/Moscow")
+	losAngeles := mustLoadLocation(t, "America/Los_Angeles")
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+
+	tests := []struct {
+		name string
+		t    time.Time
+		loc  *time.Location
+		want string // Полночь понедельника в часовом поясе loc
+	}{
+		{name: "monday midnight", t: time.Date(2026, time.March, 2, 0, 0, 0, 0, moscow), loc: moscow, want: "2026-03-02 00:00 +0300"},
+		{name: "just before monday midnight", t: time.Date(2026, time.March, 1, 23, 59, 59, 0, moscow), loc: moscow, want: "2026-02-23 00:00 +0300"},
+		{name: "sunday noon", t: time.Date(2026, time.March, 8, 12, 0, 0, 0, moscow), loc: moscow, want: "2026-03-02 00:00 +0300"},
+		{name: "monday in zone, sunday in UTC", t: time.Date(2026, time.March, 1, 21, 0, 0, 0, time.UTC), loc: moscow, want: "2026-03-02 00:00 +0300"},
+		{name: "sunday in zone, monday in UTC", t: time.Date(2026, time.March, 2, 6, 59, 0, 0, time.UTC), loc: losAngeles, want: "2026-02-23 00:00 -0800"},
+		{name: "monday in zone and UTC", t: time.Date(2026, time.March, 2, 8, 0, 0, 0, time.UTC), loc: losAngeles, want: "2026-03-02 00:00 -0800"},
+		{name: "sunday of spring forward", t: time.Date(2026, time.March, 8, 23, 59, 0, 0, losAngeles), loc: losAngeles, want: "2026-03-02 00:00 -0800"},
+		{name: "monday after spring forward", t: time.Date(2026, time.March, 9, 0, 0, 0, 0, losAngeles), loc: losAngeles, want: "2026-03-09 00:00 -0700"},
+		{name: "sunday of fall back", t: time.Date(2026, time.October, 25, 23, 30, 0, 0, berlin), loc: berlin, want: "2026-10-19 00:00 +0200"},
+		{name: "monday after fall back", t: time.Date(2026, time.October, 26, 0, 0, 0, 0, berlin), loc: berlin, want: "2026-10-26 00:00 +0100"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := startOfWeek(tt.t, tt.loc).Format("2006-01-02 15:04 -0700"); got != tt.want {
+				t.Errorf("startOfWeek() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDepartmentQuotaOverridesDefault(t *testing.T) {
+	database := dbtest.Open(t)
+	s := NewBookingsService(database)
+
+	const (
+		department = 1
+		member     = "member@example.com"
+		outsider   = "outsider@example.com"
+	)
+	if _, err := database.Exec(`INSERT INTO department (id, name, short_name, color) VALUES ($1, 'Продажи', 'ПР', '#ff0000')`, department); err != nil {
+		t.Fatal(err)
+	}
+	_, err := database.Exec(`
+		INSERT INTO users (email, password, first_name, last_name, department_id) VALUES
+			($1, 'x', 'Иван', 'Иванов', $3),
+			($2, 'x', 'Петр', 'Петров', NULL)
+	`, member, outsider, department)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	departmentID := department
+	for _, quota := range []Quota{
+		{Scope: QuotaScopeUser, Kind: QuotaHoursPerWeek, Limit: 1},
+		{Scope: QuotaScopeUser, Kind: QuotaHoursPerWeek, DepartmentID: &departmentID, Limit: 4},
+		{Scope: QuotaScopeUser, Kind: QuotaFutureBookings, Limit: 5},
+		{Scope: QuotaScopeUser, Kind: QuotaFutureBookings, DepartmentID: &departmentID, Limit: 0},
+	} {
+		if _, err := s.CreateQuota(quota); err != nil {
+			t.Fatalf("CreateQuota(%+v) error = %v", quota, err)
+		}
+	}
+
+	// Квота отдела заменяет квоту по умолчанию того же вида, а не добавляется к ней
+	wantLimits := map[string]map[string]int{
+		member:   {QuotaHoursPerWeek: 4, QuotaFutureBookings: 0},
+		outsider: {QuotaHoursPerWeek: 1, QuotaFutureBookings: 5},
+	}
+	at := time.Now().AddDate(0, 0, 7)
+	for email, want := range wantLimits {
+		usage, err := s.GetQuotaUsage(email, at, 0)
+		if err != nil {
+			t.Fatalf("GetQuotaUsage(%s) error = %v", email, err)
+		}
+		if len(usage) != len(want) {
+			t.Fatalf("GetQuotaUsage(%s) = %+v, want limits %v", email, usage, want)
+		}
+		for _, item := range usage {
+			if item.Limit != want[item.Kind] || item.Remaining != float64(want[item.Kind]) {
+				t.Errorf("%s: quota %s limit = %d, remaining = %v; want %d", email, item.Kind, item.Limit, item.Remaining, want[item.Kind])
+			}
+		}
+	}
+
+	start := time.Date(at.Year(), at.Month(), at.Day(), 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		email   string
+		hours   int
+		wantErr error
+	}{
+		// Отдел не может создавать будущие бронирования, хотя по умолчанию разрешено пять
+		{name: "department limit applies", email: member, hours: 1, wantErr: ErrQuotaExceeded},
+		{name: "default limit applies", email: outsider, hours: 1},
+		{name: "default hours exceeded", email: outsider, hours: 2, wantErr: ErrQuotaExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx, err := database.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tx.Rollback()
+
+			err = checkQuotasTx(tx, tt.email, 0, start, start.Add(time.Duration(tt.hours)*time.Hour), time.UTC)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("checkQuotasTx() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// После удаления квоты отдела сотрудник снова подчиняется квоте по умолчанию
+	if _, err := database.Exec(`DELETE FROM booking_quota WHERE department_id = $1 AND kind = $2`, department, QuotaFutureBookings); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := database.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if err := checkQuotasTx(tx, member, 0, start, start.Add(3*time.Hour), time.UTC); err != nil {
+		t.Errorf("checkQuotasTx() with department hours quota error = %v", err)
+	}
+}
@@ -0,0 +1,792 @@
+package bookings
+
+import (
+	"book_talk/internal/ical"
+	"book_talk/internal/models"
+	"book_talk/internal/rooms"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Scope - к каким повторениям серии применяется изменение или отмена
+type Scope string
+
+const (
+	ScopeThis      Scope = "this"      // Только выбранное повторение
+	ScopeFollowing Scope = "following" // Выбранное и все последующие повторения
+	ScopeAll       Scope = "all"       // Вся серия
+)
+
+// Результаты обработки отдельного повторения
+const (
+	OccurrenceCreated  = "created"
+	OccurrenceUpdated  = "updated"
+	OccurrenceConflict = "conflict"
+	OccurrenceSkipped  = "skipped"
+)
+
+var (
+	ErrSeriesNotFound     = errors.New("серия бронирований не найдена")
+	ErrOccurrenceNotFound = errors.New("повторение не найдено в серии")
+	ErrInvalidScope       = errors.New("область изменения должна быть this, following или all")
+	ErrSeriesDateChange   = errors.New("для нескольких повторений можно изменить только время, длительность и комнату, но не дату")
+	ErrEmptySeries        = errors.New("правило повторения не дает ни одного повторения")
+	ErrInvalidTimeZone    = errors.New("неизвестный часовой пояс")
+	ErrForbidden          = errors.New("недостаточно прав для изменения бронирования")
+	ErrNothingBooked      = errors.New("ни одно повторение серии не забронировано")
+)
+
+// SeriesRequest описывает запрос на создание повторяющегося бронирования
+type SeriesRequest struct {
+	RoomID   int         `json:"roomId"`   // Идентификатор комнаты
+	Start    time.Time   `json:"start"`    // Начало первого повторения (DTSTART)
+	End      time.Time   `json:"end"`      // Окончание первого повторения, задает длительность
+	RRule    string      `json:"rrule"`    // Правило повторения RFC 5545
+	ExDates  []time.Time `json:"exDates"`  // Исключенные повторения (EXDATE)
+	TimeZone string      `json:"timeZone"` // Часовой пояс IANA, в котором разворачивается правило; пусто - пояс комнаты
+
+	OnBehalfOf string `json:"onBehalfOf"` // Email владельца, если серию создает его делегат
+}
+
+// SeriesUpdateRequest описывает изменение повторений серии.
+// Occurrence - исходное начало выбранного повторения (recurrenceId), Start и End - его новые значения.
+type SeriesUpdateRequest struct {
+	Scope      Scope     `json:"scope"`
+	Occurrence time.Time `json:"occurrence"`
+	RoomID     int       `json:"roomId"` // 0 - комната не меняется
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+}
+
+// OccurrenceResult - результат обработки одного повторения серии
+type OccurrenceResult struct {
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Status    string    `json:"status"`
+	BookingID int       `json:"bookingId,omitempty"`
+	Message   string    `json:"message,omitempty"`
+}
+
+// SeriesResult - серия и отчет по каждому ее повторению
+type SeriesResult struct {
+	Series      *models.BookingSeries `json:"series"`
+	Occurrences []OccurrenceResult    `json:"occurrences"`
+}
+
+// series - серия в том виде, в котором она хранится в базе данных
+type series struct {
+	id       int
+	roomID   int
+	email    string
+	rule     *ical.Rule
+	dtstart  time.Time
+	duration time.Duration
+	loc      *time.Location
+	exdates  []time.Time
+}
+
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, ErrInvalidTimeZone
+	}
+	return loc, nil
+}
+
+// CreateSeries создает серию и бронирования для всех ее будущих повторений.
+// Повторения, пересекающиеся с чужими бронированиями, пропускаются и попадают в отчет со статусом conflict.
+// Если не удалось создать ни одного бронирования, серия не сохраняется и возвращается ErrBookingConflict вместе с отчетом.
+func (s *Service) CreateSeries(email string, req SeriesRequest) (*SeriesResult, error) {
+	owner, err := s.resolveOwner(email, req.OnBehalfOf)
+	if err != nil {
+		return nil, err
+	}
+	rule, err := ical.ParseRule(req.RRule)
+	if err != nil {
+		return nil, err
+	}
+	if req.Start.IsZero() || req.End.IsZero() || !req.End.After(req.Start) {
+		return nil, ErrInvalidInterval
+	}
+	loc, err := loadLocation(req.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, roomLoc, err := checkRoomTx(tx, req.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	// Без явного часового пояса серия повторяется по местному времени комнаты
+	if req.TimeZone == "" {
+		loc = roomLoc
+	}
+
+	dtstart := req.Start.In(loc)
+	duration := req.End.Sub(req.Start)
+	occurrences, err := rule.Occurrences(dtstart, req.ExDates)
+	if err != nil {
+		return nil, err
+	}
+	if len(occurrences) == 0 {
+		return nil, ErrEmptySeries
+	}
+
+	var seriesID int
+	err = tx.QueryRow(`
+		INSERT INTO booking_series (room_id, user_email, rrule, dtstart, duration_seconds, time_zone)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, req.RoomID, owner, rule.String(), dtstart, int(duration.Seconds()), loc.String()).Scan(&seriesID)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось сохранить серию бронирований: %v", err)
+	}
+
+	if err := saveExDatesTx(tx, seriesID, req.ExDates); err != nil {
+		return nil, err
+	}
+
+	result := &SeriesResult{Occurrences: []OccurrenceResult{}}
+	created, conflicts := 0, 0
+	var skipErr error // Причина пропуска первого пропущенного повторения
+	now := time.Now()
+	for _, occurrence := range occurrences {
+		item := OccurrenceResult{Start: occurrence, End: occurrence.Add(duration)}
+		if occurrence.Before(now) {
+			item.Status = OccurrenceSkipped
+			item.Message = ErrBookingInPast.Error()
+			if skipErr == nil {
+				skipErr = ErrBookingInPast
+			}
+			result.Occurrences = append(result.Occurrences, item)
+			continue
+		}
+
+		var bookingID int
+		err := withSavepoint(tx, func() error {
+			var err error
+			bookingID, err = s.createBookingTx(tx, owner, BookingRequest{
+				RoomID:       req.RoomID,
+				Start:        item.Start,
+				End:          item.End,
+				actor:        email,
+				seriesID:     seriesID,
+				recurrenceID: occurrence,
+			})
+			return err
+		})
+		switch {
+		case err == nil:
+			item.Status = OccurrenceCreated
+			item.BookingID = bookingID
+			created++
+		case errors.Is(err, ErrBookingConflict):
+			item.Status = OccurrenceConflict
+			item.Message = err.Error()
+			conflicts++
+		case errors.Is(err, rooms.ErrPolicyViolation), errors.Is(err, ErrQuotaExceeded), errors.Is(err, rooms.ErrRoomClosed):
+			item.Status = OccurrenceSkipped
+			item.Message = err.Error()
+			if skipErr == nil {
+				skipErr = err
+			}
+		default:
+			return nil, err
+		}
+		result.Occurrences = append(result.Occurrences, item)
+	}
+
+	// Серия без единого бронирования не сохраняется. Конфликт возвращается, только если он действительно был,
+	// иначе - причина пропуска повторений; отчет возвращается в обоих случаях.
+	if created == 0 {
+		if conflicts > 0 {
+			return result, ErrBookingConflict
+		}
+		return result, fmt.Errorf("%w: %w", ErrNothingBooked, skipErr)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+
+	result.Series, err = s.GetSeries(seriesID)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetSeries возвращает серию вместе с ее бронированиями
+func (s *Service) GetSeries(id int) (*models.BookingSeries, error) {
+	var result models.BookingSeries
+	var durationSeconds int
+	var timeZone string
+
+	err := s.DB.QueryRow(`
+		SELECT s.id, s.rrule, s.dtstart, s.duration_seconds, s.time_zone,
+			   r.id, r.name, r.capacity, COALESCE(r.active, true),
+			   u.email, u.first_name, u.last_name
+		FROM booking_series s
+		JOIN room r ON r.id = s.room_id
+		JOIN users u ON u.email = s.user_email
+		WHERE s.id = $1
+	`, id).Scan(&result.ID, &result.RRule, &result.Start, &durationSeconds, &timeZone,
+		&result.Room.ID, &result.Room.Name, &result.Room.Capacity, &result.Room.Active,
+		&result.User.Email, &result.User.FirstName, &result.User.LastName)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSeriesNotFound
+		}
+		return nil, fmt.Errorf("ошибка при получении серии бронирований: %v", err)
+	}
+
+	if loc, err := loadLocation(timeZone); err == nil {
+		result.Start = result.Start.In(loc)
+	}
+	result.End = result.Start.Add(time.Duration(durationSeconds) * time.Second)
+
+	result.ExDates, err = loadExDates(s.DB, id)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.DB.Query(bookingSelect+" WHERE b.series_id = $1 ORDER BY b.start_time", id)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении бронирований серии: %v", err)
+	}
+	defer rows.Close()
+
+	result.Bookings = []models.Booking{}
+	for rows.Next() {
+		booking, err := scanBooking(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при обработке бронирований серии: %v", err)
+		}
+		result.Bookings = append(result.Bookings, booking)
+	}
+
+	return &result, rows.Err()
+}
+
+// GetVisibleSeries возвращает серию, если пользователь может ее видеть: владелец, участник хотя бы одного
+// повторения, делегат владельца, согласующий комнаты или администратор. Иначе возвращается ErrSeriesNotFound.
+func (s *Service) GetVisibleSeries(email string, id int) (*models.BookingSeries, error) {
+	result, err := s.GetSeries(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var invited bool
+	err = s.DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM booking_attendee a JOIN booking b ON b.id = a.booking_id
+			WHERE b.series_id = $1 AND lower(a.user_email) = lower($2)
+		)
+	`, id, email).Scan(&invited)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при проверке участников серии: %v", err)
+	}
+
+	if err := s.checkCanViewAs(email, result.User.Email, result.Room.ID, invited); err != nil {
+		if errors.Is(err, ErrBookingNotFound) {
+			return nil, ErrSeriesNotFound
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+// queryer - общий интерфейс *sql.DB и *sql.Tx для чтения
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func loadExDates(q queryer, seriesID int) ([]time.Time, error) {
+	rows, err := q.Query(`SELECT exdate FROM booking_series_exdate WHERE series_id = $1 ORDER BY exdate`, seriesID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении исключений серии: %v", err)
+	}
+	defer rows.Close()
+
+	exdates := []time.Time{}
+	for rows.Next() {
+		var exdate time.Time
+		if err := rows.Scan(&exdate); err != nil {
+			return nil, fmt.Errorf("ошибка при обработке исключений серии: %v", err)
+		}
+		exdates = append(exdates, exdate)
+	}
+	return exdates, rows.Err()
+}
+
+func saveExDatesTx(tx *sql.Tx, seriesID int, exdates []time.Time) error {
+	for _, exdate := range exdates {
+		_, err := tx.Exec(`INSERT INTO booking_series_exdate (series_id, exdate) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+			seriesID, exdate)
+		if err != nil {
+			return fmt.Errorf("не удалось сохранить исключение серии: %v", err)
+		}
+	}
+	return nil
+}
+
+// loadSeriesTx загружает серию и блокирует ее до конца транзакции.
+// Изменять серию может только ее владелец или администратор.
+func (s *Service) loadSeriesTx(tx *sql.Tx, id int, email string) (*series, error) {
+	var item series
+	var rrule, timeZone string
+	var durationSeconds int
+
+	err := tx.QueryRow(`
+		SELECT id, room_id, user_email, rrule, dtstart, duration_seconds, time_zone
+		FROM booking_series WHERE id = $1 FOR UPDATE
+	`, id).Scan(&item.id, &item.roomID, &item.email, &rrule, &item.dtstart, &durationSeconds, &timeZone)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSeriesNotFound
+		}
+		return nil, fmt.Errorf("ошибка при получении серии бронирований: %v", err)
+	}
+
+	if err := s.checkCanManage(email, item.email); err != nil {
+		return nil, err
+	}
+
+	item.rule, err = ical.ParseRule(rrule)
+	if err != nil {
+		return nil, fmt.Errorf("серия %d содержит некорректное правило: %v", id, err)
+	}
+	item.loc, err = loadLocation(timeZone)
+	if err != nil {
+		return nil, fmt.Errorf("серия %d содержит некорректный часовой пояс: %v", id, err)
+	}
+	item.dtstart = item.dtstart.In(item.loc)
+	item.duration = time.Duration(durationSeconds) * time.Second
+
+	item.exdates, err = loadExDates(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// truncateSeriesTx завершает серию перед указанным моментом
+func truncateSeriesTx(tx *sql.Tx, item *series, before time.Time) error {
+	rule := *item.rule
+	rule.Count = 0
+	rule.Until = before.Add(-time.Second)
+
+	_, err := tx.Exec(`UPDATE booking_series SET rrule = $1 WHERE id = $2`, rule.String(), item.id)
+	if err != nil {
+		return fmt.Errorf("не удалось обновить правило серии: %v", err)
+	}
+	return nil
+}
+
+// loadOccurrenceTx загружает еще занимающее комнату повторение серии и блокирует его до конца транзакции
+func loadOccurrenceTx(tx *sql.Tx, seriesID int, occurrence time.Time) (*storedBooking, error) {
+	var booking storedBooking
+	var start, end sql.NullTime
+	err := tx.QueryRow(`
+		SELECT id, room_id, start_time, end_time, status FROM booking
+		WHERE series_id = $1 AND recurrence_id = $2 AND status <> ALL($3)
+		FOR UPDATE
+	`, seriesID, occurrence, pq.Array(models.ReleasedBookingStatuses)).Scan(&booking.id, &booking.roomID, &start, &end, &booking.status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOccurrenceNotFound
+		}
+		return nil, fmt.Errorf("ошибка при получении повторения: %v", err)
+	}
+	booking.start, booking.end = start.Time, end.Time
+	return &booking, nil
+}
+
+// CancelSeries отменяет выбранное повторение, выбранное и последующие или всю серию.
+// Бронирования не удаляются, а получают статус CANCELLED; уже прошедшие бронирования серии не меняются.
+func (s *Service) CancelSeries(email string, id int, scope Scope, occurrence time.Time) error {
+	if scope != ScopeThis && scope != ScopeFollowing && scope != ScopeAll {
+		return ErrInvalidScope
+	}
+	if scope != ScopeAll && occurrence.IsZero() {
+		return ErrOccurrenceNotFound
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	item, err := s.loadSeriesTx(tx, id, email)
+	if err != nil {
+		return err
+	}
+
+	switch scope {
+	case ScopeThis:
+		booking, err := loadOccurrenceTx(tx, id, occurrence)
+		if err != nil {
+			return err
+		}
+		// Прошедшее повторение отменить нельзя, как и отдельное бронирование
+		if err := booking.checkModifiable(); err != nil {
+			return err
+		}
+		if err := cancelBookingTx(tx, booking.id, email, ""); err != nil {
+			return err
+		}
+		if err := s.offerFreedSlotTx(tx, booking.roomID, booking.start, booking.end); err != nil {
+			return err
+		}
+		if err := saveExDatesTx(tx, id, []time.Time{occurrence}); err != nil {
+			return err
+		}
+
+	case ScopeFollowing, ScopeAll:
+		from := occurrence
+		if scope == ScopeAll || from.Before(item.dtstart) {
+			from = item.dtstart
+		}
+
+		rows, err := tx.Query(`
+			SELECT id, room_id, start_time, end_time FROM booking
+			WHERE series_id = $1 AND recurrence_id >= $2 AND start_time > now() AND status <> ALL($3)
+			FOR UPDATE
+		`, id, from, pq.Array(models.ReleasedBookingStatuses))
+		if err != nil {
+			return fmt.Errorf("ошибка при получении повторений серии: %v", err)
+		}
+		var cancelled []storedBooking
+		for rows.Next() {
+			var booking storedBooking
+			if err := rows.Scan(&booking.id, &booking.roomID, &booking.start, &booking.end); err != nil {
+				rows.Close()
+				return fmt.Errorf("ошибка при обработке повторений серии: %v", err)
+			}
+			cancelled = append(cancelled, booking)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, booking := range cancelled {
+			if err := cancelBookingTx(tx, booking.id, email, ""); err != nil {
+				return err
+			}
+			if err := s.offerFreedSlotTx(tx, booking.roomID, booking.start, booking.end); err != nil {
+				return err
+			}
+		}
+
+		// Отмененные и прошедшие повторения остаются в серии, поэтому она завершается на текущем моменте
+		if from.Before(time.Now()) {
+			from = time.Now()
+		}
+		if from.After(item.dtstart) {
+			if err := truncateSeriesTx(tx, item, from); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+	return nil
+}
+
+// UpdateSeries изменяет время, длительность и комнату повторений серии.
+// Для scope=this выбранное повторение можно перенести на любую дату, для following и all меняется
+// только время суток, длительность и комната, а дата каждого повторения сохраняется.
+// Повторения, которые не удалось перенести из-за пересечений, остаются на месте и попадают в отчет со статусом conflict.
+func (s *Service) UpdateSeries(email string, id int, req SeriesUpdateRequest) (*SeriesResult, error) {
+	if req.Scope != ScopeThis && req.Scope != ScopeFollowing && req.Scope != ScopeAll {
+		return nil, ErrInvalidScope
+	}
+	if req.Occurrence.IsZero() {
+		return nil, ErrOccurrenceNotFound
+	}
+	if req.Start.IsZero() || req.End.IsZero() || !req.End.After(req.Start) {
+		return nil, ErrInvalidInterval
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	item, err := s.loadSeriesTx(tx, id, email)
+	if err != nil {
+		return nil, err
+	}
+
+	roomID := req.RoomID
+	if roomID == 0 {
+		roomID = item.roomID
+	}
+
+	result := &SeriesResult{Occurrences: []OccurrenceResult{}}
+
+	if req.Scope == ScopeThis {
+		booking, err := loadOccurrenceTx(tx, id, req.Occurrence)
+		if err != nil {
+			return nil, err
+		}
+		if err := booking.checkModifiable(); err != nil {
+			return nil, err
+		}
+		if err := s.rescheduleBookingTx(tx, booking.id, roomID, req.Start, req.End, email, ""); err != nil {
+			return nil, err
+		}
+		// Прежний интервал повторения предлагается листу ожидания, как при переносе отдельного бронирования
+		if err := s.offerFreedSlotTx(tx, booking.roomID, booking.start, booking.end); err != nil {
+			return nil, err
+		}
+		result.Occurrences = append(result.Occurrences, OccurrenceResult{
+			Start: req.Start, End: req.End, Status: OccurrenceUpdated, BookingID: booking.id,
+		})
+	} else {
+		occurrence := req.Occurrence.In(item.loc)
+		newStart := req.Start.In(item.loc)
+		if !sameDate(occurrence, newStart) {
+			return nil, ErrSeriesDateChange
+		}
+		duration := req.End.Sub(req.Start)
+
+		// Изменение с первого повторения равносильно изменению всей серии
+		scope := req.Scope
+		if !occurrence.After(item.dtstart) {
+			scope = ScopeAll
+		}
+
+		seriesID := id
+		if scope == ScopeFollowing {
+			seriesID, err = s.splitSeriesTx(tx, item, occurrence, newStart, duration, roomID)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			err = s.updateSeriesTx(tx, item, atClock(item.dtstart, newStart), duration, roomID)
+			if err != nil {
+				return nil, err
+			}
+			occurrence = item.dtstart
+		}
+
+		result.Occurrences, err = s.moveOccurrencesTx(tx, seriesID, occurrence, newStart, duration, roomID, item.loc, email)
+		if err != nil {
+			return nil, err
+		}
+
+		moved := 0
+		for _, o := range result.Occurrences {
+			if o.Status == OccurrenceUpdated {
+				moved++
+			}
+		}
+		if moved == 0 && len(result.Occurrences) > 0 {
+			return result, ErrBookingConflict
+		}
+		id = seriesID
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+
+	result.Series, err = s.GetSeries(id)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// updateSeriesTx сохраняет новое начало, длительность и комнату всей серии
+func (s *Service) updateSeriesTx(tx *sql.Tx, item *series, dtstart time.Time, duration time.Duration, roomID int) error {
+	_, err := tx.Exec(`UPDATE booking_series SET dtstart = $1, duration_seconds = $2, room_id = $3 WHERE id = $4`,
+		dtstart, int(duration.Seconds()), roomID, item.id)
+	if err != nil {
+		return fmt.Errorf("не удалось обновить серию: %v", err)
+	}
+
+	// Исключения должны совпадать с новым временем повторений
+	exdates := make([]time.Time, len(item.exdates))
+	for i, exdate := range item.exdates {
+		exdates[i] = atClock(exdate.In(item.loc), dtstart)
+	}
+	if _, err := tx.Exec(`DELETE FROM booking_series_exdate WHERE series_id = $1`, item.id); err != nil {
+		return fmt.Errorf("не удалось обновить исключения серии: %v", err)
+	}
+	return saveExDatesTx(tx, item.id, exdates)
+}
+
+// splitSeriesTx завершает серию перед повторением occurrence и создает новую серию,
+// которая начинается с него с новым временем, длительностью и комнатой. Возвращает id новой серии.
+func (s *Service) splitSeriesTx(tx *sql.Tx, item *series, occurrence, newStart time.Time, duration time.Duration, roomID int) (int, error) {
+	rule := *item.rule
+	if rule.Count > 0 {
+		// Оставшееся количество повторений считается без учета исключений, как и сам COUNT
+		all, err := item.rule.Occurrences(item.dtstart, nil)
+		if err != nil {
+			return 0, err
+		}
+		remaining := 0
+		for _, o := range all {
+			if !o.Before(occurrence) {
+				remaining++
+			}
+		}
+		if remaining == 0 {
+			return 0, ErrOccurrenceNotFound
+		}
+		rule.Count = remaining
+	}
+
+	if err := truncateSeriesTx(tx, item, occurrence); err != nil {
+		return 0, err
+	}
+
+	var newID int
+	err := tx.QueryRow(`
+		INSERT INTO booking_series (room_id, user_email, rrule, dtstart, duration_seconds, time_zone)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, roomID, item.email, rule.String(), newStart, int(duration.Seconds()), item.loc.String()).Scan(&newID)
+	if err != nil {
+		return 0, fmt.Errorf("не удалось сохранить новую серию: %v", err)
+	}
+
+	var exdates []time.Time
+	for _, exdate := range item.exdates {
+		if !exdate.Before(occurrence) {
+			exdates = append(exdates, atClock(exdate.In(item.loc), newStart))
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM booking_series_exdate WHERE series_id = $1 AND exdate >= $2`, item.id, occurrence); err != nil {
+		return 0, fmt.Errorf("не удалось перенести исключения серии: %v", err)
+	}
+	if err := saveExDatesTx(tx, newID, exdates); err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`UPDATE booking SET series_id = $1 WHERE series_id = $2 AND recurrence_id >= $3`, newID, item.id, occurrence)
+	if err != nil {
+		return 0, fmt.Errorf("не удалось перенести бронирования в новую серию: %v", err)
+	}
+
+	return newID, nil
+}
+
+// moveOccurrencesTx переносит будущие бронирования серии, начиная с повторения from, на новое время суток.
+// Освобожденные интервалы перенесенных повторений предлагаются листу ожидания.
+func (s *Service) moveOccurrencesTx(tx *sql.Tx, seriesID int, from, newStart time.Time, duration time.Duration, roomID int, loc *time.Location, actor string) ([]OccurrenceResult, error) {
+	rows, err := tx.Query(`
+		SELECT id, recurrence_id, room_id, start_time, end_time FROM booking
+		WHERE series_id = $1 AND recurrence_id >= $2 AND start_time > now() AND status <> ALL($3)
+		ORDER BY recurrence_id
+		FOR UPDATE
+	`, seriesID, from, pq.Array(models.ReleasedBookingStatuses))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении повторений серии: %v", err)
+	}
+
+	type occurrenceRow struct {
+		bookingID    int
+		recurrenceID time.Time
+		roomID       int
+		start, end   time.Time
+	}
+	var items []occurrenceRow
+	for rows.Next() {
+		var item occurrenceRow
+		var start, end sql.NullTime
+		if err := rows.Scan(&item.bookingID, &item.recurrenceID, &item.roomID, &start, &end); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка при обработке повторений серии: %v", err)
+		}
+		item.start, item.end = start.Time, end.Time
+		items = append(items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// При сдвиге на более позднее время переносим повторения с конца, чтобы они не пересекались друг с другом
+	if len(items) > 0 && atClock(items[0].recurrenceID.In(loc), newStart).After(items[0].recurrenceID) {
+		sort.Slice(items, func(i, j int) bool { return items[i].recurrenceID.After(items[j].recurrenceID) })
+	}
+
+	results := make([]OccurrenceResult, 0, len(items))
+	var freed []occurrenceRow
+	for _, item := range items {
+		start := atClock(item.recurrenceID.In(loc), newStart)
+		end := start.Add(duration)
+		result := OccurrenceResult{Start: start, End: end, BookingID: item.bookingID}
+
+		err := withSavepoint(tx, func() error {
+			return s.rescheduleBookingTx(tx, item.bookingID, roomID, start, end, actor, "")
+		})
+		switch {
+		case err == nil:
+			result.Status = OccurrenceUpdated
+			// Исходное начало перенесенного повторения следует за новым временем серии
+			if _, err := tx.Exec(`UPDATE booking SET recurrence_id = $1 WHERE id = $2`, start, item.bookingID); err != nil {
+				return nil, fmt.Errorf("не удалось обновить повторение: %v", err)
+			}
+			if item.roomID != roomID || !item.start.Equal(start) || !item.end.Equal(end) {
+				freed = append(freed, item)
+			}
+		case errors.Is(err, ErrBookingConflict), errors.Is(err, ErrBookingInPast), errors.Is(err, rooms.ErrPolicyViolation),
+			errors.Is(err, ErrQuotaExceeded), errors.Is(err, rooms.ErrRoomClosed):
+			// Повторение осталось на месте и сохраняет прежнее recurrence_id
+			result.Status = OccurrenceConflict
+			result.Message = err.Error()
+		default:
+			return nil, err
+		}
+
+		results = append(results, result)
+	}
+
+	// Прежние интервалы предлагаются после всех переносов, когда известно, какие из них действительно свободны
+	for _, item := range freed {
+		if err := s.offerFreedSlotTx(tx, item.roomID, item.start, item.end); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Start.Before(results[j].Start) })
+	return results, nil
+}
+
+// atClock возвращает дату day со временем суток clock
+func atClock(day, clock time.Time) time.Time {
+	year, month, d := day.Date()
+	hour, minute, second := clock.In(day.Location()).Clock()
+	return time.Date(year, month, d, hour, minute, second, 0, day.Location())
+}
+
+func sameDate(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
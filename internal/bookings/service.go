@@ -1 +1,712 @@
 package bookings
+
+import (
+	"book_talk/internal/models"
+	"book_talk/internal/roles"
+	"book_talk/internal/rooms"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type Service struct {
+	DB               *sql.DB
+	RoleService      *roles.Service
+	WaitlistOfferTTL time.Duration // Сколько действует предложение освободившегося интервала из листа ожидания
+	ApprovalTTL      time.Duration // Сколько бронирование может ожидать согласования
+}
+
+func NewBookingsService(db *sql.DB) *Service {
+	return &Service{
+		DB:               db,
+		RoleService:      roles.NewRolesService(db),
+		WaitlistOfferTTL: DefaultWaitlistOfferTTL,
+		ApprovalTTL:      DefaultApprovalTTL,
+	}
+}
+
+var (
+	ErrBookingNotFound  = errors.New("бронирование не найдено")
+	ErrBookingConflict  = errors.New("комната уже забронирована на это время")
+	ErrInvalidInterval  = errors.New("время окончания должно быть позже времени начала")
+	ErrBookingInPast    = errors.New("нельзя забронировать комнату на прошедшее время")
+	ErrRoomInactive     = errors.New("комната недоступна для бронирования")
+	ErrAlreadyImported  = errors.New("событие уже импортировано в эту комнату")
+	ErrBookingCancelled = errors.New("бронирование отменено")
+	ErrBookingFinished  = errors.New("бронирование уже завершилось")
+	ErrBookingNoShow    = errors.New("бронирование освобождено: никто не отметился о приходе")
+	ErrBookingOffered   = errors.New("интервал удерживается по предложению из листа ожидания, примите или отклоните его")
+)
+
+// BookingRequest описывает запрос на бронирование комнаты
+type BookingRequest struct {
+	RoomID int       `json:"roomId"` // Идентификатор комнаты
+	Start  time.Time `json:"start"`  // Начало интервала в формате RFC 3339
+	End    time.Time `json:"end"`    // Окончание интервала в формате RFC 3339
+
+	Attendees []string `json:"attendees"` // Email приглашенных зарегистрированных пользователей
+	Guests    []Guest  `json:"guests"`    // Приглашенные внешние гости
+
+	OnBehalfOf string `json:"onBehalfOf"` // Email владельца, если бронирование создает его делегат
+
+	actor        string    // Кто создает бронирование, по умолчанию владелец
+	seriesID     int       // Серия, к которой относится повторение
+	recurrenceID time.Time // Исходное начало повторения в серии
+	externalUID  string    // Идентификатор импортированного события календаря
+	status       string    // Начальный статус, по умолчанию ACTIVE или PENDING для комнат с согласованием
+}
+
+const bookingSelect = `
+	SELECT b.id, b.time, b.start_time, b.end_time, b.status, b.checked_in_at, b.series_id, b.recurrence_id, b.approval_expires_at,
+		   r.id, r.name, r.capacity, COALESCE(r.active, true),
+		   a.id, a.region, a.city, a.street, a.building, COALESCE(a.time_zone, ''),
+		   u.email, u.first_name, u.last_name, c.email, c.first_name, c.last_name
+	FROM booking b
+	JOIN room r ON r.id = b.room_id
+	LEFT JOIN address a ON a.id = r.address_id
+	JOIN users u ON u.email = b.user_email
+	LEFT JOIN users c ON c.email = b.created_by
+`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanBooking(row rowScanner) (models.Booking, error) {
+	var booking models.Booking
+	var start, end, checkedInAt, recurrenceID, approvalExpiresAt sql.NullTime
+	var seriesID, addressID sql.NullInt64
+	var region, city, street, building sql.NullString
+	var timeZone string
+	var creatorEmail, creatorFirstName, creatorLastName sql.NullString
+
+	err := row.Scan(&booking.ID, &booking.Time, &start, &end, &booking.Status, &checkedInAt, &seriesID, &recurrenceID, &approvalExpiresAt,
+		&booking.Room.ID, &booking.Room.Name, &booking.Room.Capacity, &booking.Room.Active,
+		&addressID, &region, &city, &street, &building, &timeZone,
+		&booking.User.Email, &booking.User.FirstName, &booking.User.LastName,
+		&creatorEmail, &creatorFirstName, &creatorLastName)
+	if err != nil {
+		return booking, err
+	}
+
+	if addressID.Valid {
+		booking.Room.Address = models.Address{
+			ID:       int(addressID.Int64),
+			Region:   region.String,
+			City:     city.String,
+			Street:   street.String,
+			Building: building.String,
+			TimeZone: timeZone,
+		}
+	}
+
+	booking.Start = start.Time
+	booking.End = end.Time
+	if checkedInAt.Valid {
+		booking.CheckedInAt = &checkedInAt.Time
+	}
+	if seriesID.Valid {
+		id := int(seriesID.Int64)
+		booking.SeriesID = &id
+	}
+	if recurrenceID.Valid {
+		booking.RecurrenceID = &recurrenceID.Time
+	}
+	if creatorEmail.Valid {
+		booking.CreatedBy = &models.UserDTO{
+			Email:     creatorEmail.String,
+			FirstName: creatorFirstName.String,
+			LastName:  creatorLastName.String,
+		}
+	}
+	booking.Attendees = []models.Attendee{}
+	if approvalExpiresAt.Valid {
+		booking.ApprovalExpiresAt = &approvalExpiresAt.Time
+	}
+	// Время бронирования показывается по местному времени комнаты
+	booking.InLocation(zoneLocation(timeZone))
+
+	return booking, nil
+}
+
+func (s *Service) GetBooking(id int) (*models.Booking, error) {
+	booking, err := scanBooking(s.DB.QueryRow(bookingSelect+" WHERE b.id = $1", id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrBookingNotFound
+		}
+		return nil, fmt.Errorf("ошибка при получении бронирования: %v", err)
+	}
+
+	bookings := []models.Booking{booking}
+	if err := s.loadAttendees(bookings); err != nil {
+		return nil, err
+	}
+	return &bookings[0], nil
+}
+
+// GetVisibleBooking возвращает бронирование, если пользователь может его видеть, иначе ErrBookingNotFound
+func (s *Service) GetVisibleBooking(email string, id int) (*models.Booking, error) {
+	booking, err := s.GetBooking(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkCanView(email, booking); err != nil {
+		return nil, err
+	}
+	return booking, nil
+}
+
+// checkCanView возвращает ErrBookingNotFound, если пользователь не может видеть бронирование.
+// Бронирование видят владелец, участники, делегаты владельца, согласующие комнаты и администратор.
+func (s *Service) checkCanView(email string, booking *models.Booking) error {
+	invited := false
+	for _, attendee := range booking.Attendees {
+		if !attendee.Guest && strings.EqualFold(email, attendee.Email) {
+			invited = true
+			break
+		}
+	}
+	return s.checkCanViewAs(email, booking.User.Email, booking.Room.ID, invited)
+}
+
+// checkCanViewAs проверяет доступ на чтение к бронированию или серии владельца owner в комнате roomID.
+// invited - пользователь приглашен участником.
+func (s *Service) checkCanViewAs(email, owner string, roomID int, invited bool) error {
+	if invited || strings.EqualFold(email, owner) {
+		return nil
+	}
+
+	err := s.checkCanManage(email, owner)
+	if !errors.Is(err, ErrForbidden) {
+		return err
+	}
+	allowed, err := s.canApprove(email, roomID)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		// Чужое бронирование не раскрывается даже фактом существования
+		return ErrBookingNotFound
+	}
+	return nil
+}
+
+// ListFilter описывает условия отбора бронирований
+type ListFilter struct {
+	UserEmail string    // Владелец бронирований, пустая строка - любой
+	Invited   bool      // Включать бронирования, в которые UserEmail приглашен участником
+	RoomID    int       // Комната, 0 - любая
+	From      time.Time // Бронирования, заканчивающиеся после этого момента
+	To        time.Time // Бронирования, начинающиеся до этого момента
+}
+
+// ListBookings возвращает бронирования с заданным интервалом, отсортированные по началу
+func (s *Service) ListBookings(filter ListFilter) ([]models.Booking, error) {
+	var conditions []string
+	var args []interface{}
+
+	conditions = append(conditions, "b.period IS NOT NULL")
+	if filter.UserEmail != "" {
+		args = append(args, filter.UserEmail)
+		if filter.Invited {
+			conditions = append(conditions, fmt.Sprintf(
+				"(b.user_email = $%[1]d OR b.id IN (SELECT booking_id FROM booking_attendee WHERE user_email = $%[1]d))", len(args)))
+		} else {
+			conditions = append(conditions, fmt.Sprintf("b.user_email = $%d", len(args)))
+		}
+	}
+	if filter.RoomID != 0 {
+		args = append(args, filter.RoomID)
+		conditions = append(conditions, fmt.Sprintf("b.room_id = $%d", len(args)))
+	}
+	if !filter.From.IsZero() {
+		args = append(args, filter.From)
+		conditions = append(conditions, fmt.Sprintf("b.end_time > $%d", len(args)))
+	}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To)
+		conditions = append(conditions, fmt.Sprintf("b.start_time < $%d", len(args)))
+	}
+
+	query := bookingSelect + " WHERE " + strings.Join(conditions, " AND ") + " ORDER BY b.start_time, b.id"
+	rows, err := s.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении бронирований: %v", err)
+	}
+	defer rows.Close()
+
+	bookings := []models.Booking{}
+	for rows.Next() {
+		booking, err := scanBooking(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при обработке бронирований: %v", err)
+		}
+		bookings = append(bookings, booking)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.loadAttendees(bookings); err != nil {
+		return nil, err
+	}
+	return bookings, nil
+}
+
+// CreateBooking бронирует комнату на указанный интервал от имени пользователя
+// или, если задан OnBehalfOf, от имени владельца, который разрешил пользователю бронировать за него
+func (s *Service) CreateBooking(email string, req BookingRequest) (*models.Booking, error) {
+	owner, err := s.resolveOwner(email, req.OnBehalfOf)
+	if err != nil {
+		return nil, err
+	}
+	req.actor = email
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	id, err := s.createBookingTx(tx, owner, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+
+	return s.GetBooking(id)
+}
+
+// BookingUpdateRequest описывает изменение бронирования. Незаполненные поля не меняются.
+type BookingUpdateRequest struct {
+	RoomID  int       `json:"roomId"`  // Новая комната
+	Start   time.Time `json:"start"`   // Новое начало интервала
+	End     time.Time `json:"end"`     // Новое окончание интервала
+	Comment string    `json:"comment"` // Комментарий для истории изменений
+
+	Attendees *[]string `json:"attendees"` // Новый список приглашенных пользователей
+	Guests    *[]Guest  `json:"guests"`    // Новый список гостей
+}
+
+// storedBooking - бронирование в том виде, в котором оно хранится в базе данных
+type storedBooking struct {
+	id           int
+	roomID       int
+	email        string
+	start        time.Time
+	end          time.Time
+	status       string
+	seriesID     sql.NullInt64
+	recurrenceID sql.NullTime
+	checkedIn    bool
+}
+
+// loadBookingTx загружает бронирование и блокирует его до конца транзакции.
+// Изменять бронирование может только его владелец, делегат владельца или администратор;
+// тот, кто бронирование не видит, получает ErrBookingNotFound, как и при чтении.
+func (s *Service) loadBookingTx(tx *sql.Tx, id int, email string) (*storedBooking, error) {
+	var item storedBooking
+	var start, end sql.NullTime
+	err := tx.QueryRow(`
+		SELECT id, room_id, user_email, start_time, end_time, status, series_id, recurrence_id, checked_in_at IS NOT NULL
+		FROM booking WHERE id = $1 FOR UPDATE
+	`, id).Scan(&item.id, &item.roomID, &item.email, &start, &end, &item.status, &item.seriesID, &item.recurrenceID, &item.checkedIn)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrBookingNotFound
+		}
+		return nil, fmt.Errorf("ошибка при получении бронирования: %v", err)
+	}
+	item.start, item.end = start.Time, end.Time
+
+	invited := false
+	if !strings.EqualFold(email, item.email) {
+		err := tx.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM booking_attendee WHERE booking_id = $1 AND lower(user_email) = lower($2))
+		`, id, email).Scan(&invited)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при проверке участников бронирования: %v", err)
+		}
+	}
+	if err := s.checkCanViewAs(email, item.email, item.roomID, invited); err != nil {
+		return nil, err
+	}
+	if err := s.checkCanManage(email, item.email); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// checkModifiable проверяет, что бронирование еще занимает комнату и не завершилось
+func (item *storedBooking) checkModifiable() error {
+	switch item.status {
+	case models.BookingStatusCancelled:
+		return ErrBookingCancelled
+	case models.BookingStatusNoShow:
+		return ErrBookingNoShow
+	case models.BookingStatusOffered:
+		return ErrBookingOffered
+	case models.BookingStatusRejected:
+		return ErrBookingRejected
+	case models.BookingStatusExpired:
+		return ErrApprovalExpired
+	}
+	if !item.end.IsZero() && !item.end.After(time.Now()) {
+		return ErrBookingFinished
+	}
+	return nil
+}
+
+// checkCanManage возвращает ErrForbidden, если пользователь не является владельцем, его делегатом или администратором
+func (s *Service) checkCanManage(email, owner string) error {
+	if email == owner {
+		return nil
+	}
+	delegate, err := s.isDelegate(owner, email)
+	if err != nil || delegate {
+		return err
+	}
+	isAdmin, err := s.RoleService.IsAdmin(email)
+	if err != nil {
+		return err
+	}
+	if !isAdmin {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// UpdateBooking переносит бронирование на другое время или в другую комнату и меняет его участников
+func (s *Service) UpdateBooking(email string, id int, req BookingUpdateRequest) (*models.Booking, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	item, err := s.loadBookingTx(tx, id, email)
+	if err != nil {
+		return nil, err
+	}
+	if err := item.checkModifiable(); err != nil {
+		return nil, err
+	}
+
+	roomID, start, end := item.roomID, item.start, item.end
+	if req.RoomID != 0 {
+		roomID = req.RoomID
+	}
+	if !req.Start.IsZero() {
+		start = req.Start
+	}
+	if !req.End.IsZero() {
+		end = req.End
+	}
+
+	// Участники меняются до переноса, чтобы вместимость проверялась уже для нового списка
+	if err := saveAttendeesTx(tx, id, item.email, req.Attendees, req.Guests); err != nil {
+		return nil, err
+	}
+	if roomID != item.roomID || !start.Equal(item.start) || !end.Equal(item.end) {
+		if err := s.rescheduleBookingTx(tx, id, roomID, start, end, email, req.Comment); err != nil {
+			return nil, err
+		}
+		if err := s.offerFreedSlotTx(tx, item.roomID, item.start, item.end); err != nil {
+			return nil, err
+		}
+	} else {
+		// Бронирование остается на месте, поэтому его можно изменить и во время встречи, а статус согласования не меняется
+		if err := checkCapacityTx(tx, id, roomID); err != nil {
+			return nil, err
+		}
+		if err := recordHistoryTx(tx, id, email, HistoryUpdated, req.Comment); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+
+	return s.GetBooking(id)
+}
+
+// CancelBooking отменяет бронирование. Бронирование не удаляется, а получает статус CANCELLED
+// и перестает занимать комнату. Отмененное повторение серии добавляется в ее исключения.
+func (s *Service) CancelBooking(email string, id int, reason string) (*models.Booking, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	item, err := s.loadBookingTx(tx, id, email)
+	if err != nil {
+		return nil, err
+	}
+	if err := item.checkModifiable(); err != nil {
+		return nil, err
+	}
+
+	if err := cancelBookingTx(tx, id, email, reason); err != nil {
+		return nil, err
+	}
+	if err := s.offerFreedSlotTx(tx, item.roomID, item.start, item.end); err != nil {
+		return nil, err
+	}
+	if item.seriesID.Valid && item.recurrenceID.Valid {
+		if err := saveExDatesTx(tx, int(item.seriesID.Int64), []time.Time{item.recurrenceID.Time}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+
+	return s.GetBooking(id)
+}
+
+// cancelBookingTx переводит бронирование в статус CANCELLED и записывает отмену в историю
+func cancelBookingTx(tx *sql.Tx, id int, actor, reason string) error {
+	_, err := tx.Exec(`UPDATE booking SET status = $1 WHERE id = $2`, models.BookingStatusCancelled, id)
+	if err != nil {
+		return fmt.Errorf("не удалось отменить бронирование: %v", err)
+	}
+	return recordHistoryTx(tx, id, actor, HistoryCancelled, reason)
+}
+
+// createBookingTx проверяет запрос и сохраняет бронирование в рамках переданной транзакции.
+// Пересечение интервалов проверяет ограничение booking_room_period_excl,
+// поэтому из двух одновременных запросов на один интервал успешно завершится только один.
+func (s *Service) createBookingTx(tx *sql.Tx, email string, req BookingRequest) (int, error) {
+	if req.Start.IsZero() || req.End.IsZero() || !req.End.After(req.Start) {
+		return 0, ErrInvalidInterval
+	}
+	if req.Start.Before(time.Now()) {
+		return 0, ErrBookingInPast
+	}
+
+	policy, loc, err := checkRoomTx(tx, req.RoomID)
+	if err != nil {
+		return 0, err
+	}
+	if err := rooms.CheckClosedTx(tx, req.RoomID, loc, req.Start, req.End); err != nil {
+		return 0, err
+	}
+	// Предложения из листа ожидания проверяются по правилам при постановке в очередь,
+	// а их начало может сдвинуться на текущий момент, поэтому повторно не проверяются
+	if req.status != models.BookingStatusOffered {
+		if err := rooms.CheckPolicy(policy, loc, req.Start, req.End, time.Now()); err != nil {
+			return 0, err
+		}
+		if err := checkQuotasTx(tx, email, 0, req.Start, req.End, loc); err != nil {
+			return 0, err
+		}
+	}
+
+	status, approvalExpiresAt := req.status, sql.NullTime{}
+	if status == "" {
+		status, approvalExpiresAt, err = s.initialStatusTx(tx, email, req.RoomID, req.Start)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	actor := req.actor
+	if actor == "" {
+		actor = email
+	}
+
+	blockedStart, blockedEnd := rooms.BlockedInterval(policy, req.Start, req.End)
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO booking (room_id, user_email, time, start_time, end_time, series_id, recurrence_id, external_uid,
+			status, approval_expires_at, blocked_start, blocked_end, created_by)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0), $7, NULLIF($8, ''), $9, $10, $11, $12, $13)
+		RETURNING id
+	`, req.RoomID, email, req.Start.UTC().Format(time.RFC3339), req.Start, req.End,
+		req.seriesID, nullTime(req.recurrenceID), req.externalUID, status, approvalExpiresAt, blockedStart, blockedEnd, actor).Scan(&id)
+	if err != nil {
+		return 0, mapBookingError(err)
+	}
+
+	if err := saveAttendeesTx(tx, id, email, &req.Attendees, &req.Guests); err != nil {
+		return 0, err
+	}
+	if err := checkCapacityTx(tx, id, req.RoomID); err != nil {
+		return 0, err
+	}
+
+	if err := recordHistoryTx(tx, id, actor, HistoryCreated, ""); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// rescheduleBookingTx переносит бронирование на другой интервал и, возможно, в другую комнату.
+// В комнате с согласованием перенесенное бронирование снова ожидает решения, если actor не может согласовать его сам;
+// если комната и интервал не изменились, статус и срок согласования сохраняются.
+// Изменение записывается в историю от имени actor.
+func (s *Service) rescheduleBookingTx(tx *sql.Tx, id, roomID int, start, end time.Time, actor, comment string) error {
+	if start.IsZero() || end.IsZero() || !end.After(start) {
+		return ErrInvalidInterval
+	}
+	if start.Before(time.Now()) {
+		return ErrBookingInPast
+	}
+
+	policy, loc, err := checkRoomTx(tx, roomID)
+	if err != nil {
+		return err
+	}
+	if err := rooms.CheckPolicy(policy, loc, start, end, time.Now()); err != nil {
+		return err
+	}
+	if err := rooms.CheckClosedTx(tx, roomID, loc, start, end); err != nil {
+		return err
+	}
+	// Квоты расходуются владельцем бронирования, даже если переносит его администратор
+	var owner, status string
+	var currentRoomID int
+	var currentStart, currentEnd, approvalExpiresAt sql.NullTime
+	err = tx.QueryRow(`
+		SELECT user_email, room_id, start_time, end_time, status, approval_expires_at FROM booking WHERE id = $1
+	`, id).Scan(&owner, &currentRoomID, &currentStart, &currentEnd, &status, &approvalExpiresAt)
+	if err != nil {
+		return fmt.Errorf("ошибка при получении бронирования: %v", err)
+	}
+	if err := checkQuotasTx(tx, owner, id, start, end, loc); err != nil {
+		return err
+	}
+	moved := roomID != currentRoomID || !start.Equal(currentStart.Time) || !end.Equal(currentEnd.Time)
+	if moved {
+		status, approvalExpiresAt, err = s.initialStatusTx(tx, actor, roomID, start)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Отметка о приходе сбрасывается, если бронирование перенесено на другое время или в другую комнату
+	blockedStart, blockedEnd := rooms.BlockedInterval(policy, start, end)
+	_, err = tx.Exec(`
+		UPDATE booking SET room_id = $1, time = $2, start_time = $3, end_time = $4,
+			checked_in_at = CASE WHEN room_id = $1 AND start_time = $3 THEN checked_in_at END,
+			status = $6, approval_expires_at = $7, blocked_start = $8, blocked_end = $9
+		WHERE id = $5
+	`, roomID, start.UTC().Format(time.RFC3339), start, end, id, status, approvalExpiresAt, blockedStart, blockedEnd)
+	if err != nil {
+		return mapBookingError(err)
+	}
+	if err := checkCapacityTx(tx, id, roomID); err != nil {
+		return err
+	}
+
+	return recordHistoryTx(tx, id, actor, HistoryUpdated, comment)
+}
+
+// checkRoomTx проверяет, что комната существует и активна, блокирует ее от изменения на время транзакции
+// и возвращает правила бронирования комнаты и ее часовой пояс
+func checkRoomTx(tx *sql.Tx, roomID int) (models.RoomPolicy, *time.Location, error) {
+	var active bool
+	var policy models.RoomPolicy
+	var timeZone string
+	err := tx.QueryRow(`
+		SELECT COALESCE(r.active, true), r.min_duration_minutes, r.max_duration_minutes, r.granularity_minutes,
+			   r.setup_buffer_minutes, r.cleanup_buffer_minutes, r.booking_horizon_days, COALESCE(a.time_zone, '')
+		FROM room r
+		LEFT JOIN address a ON a.id = r.address_id
+		WHERE r.id = $1 FOR SHARE OF r
+	`, roomID).Scan(&active, &policy.MinDurationMinutes, &policy.MaxDurationMinutes, &policy.GranularityMinutes,
+		&policy.SetupBufferMinutes, &policy.CleanupBufferMinutes, &policy.HorizonDays, &timeZone)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return policy, nil, rooms.ErrRoomNotFound
+		}
+		return policy, nil, fmt.Errorf("ошибка при получении комнаты: %v", err)
+	}
+	if !active {
+		return policy, nil, ErrRoomInactive
+	}
+	return policy, zoneLocation(timeZone), nil
+}
+
+// zoneLocation возвращает часовой пояс комнаты по часовому поясу ее адреса
+func zoneLocation(timeZone string) *time.Location {
+	return rooms.Location(models.Room{Address: models.Address{TimeZone: timeZone}})
+}
+
+// userTimeZone возвращает часовой пояс из профиля пользователя, пустая строка - не задан
+func (s *Service) userTimeZone(email string) (string, error) {
+	var timeZone string
+	err := s.DB.QueryRow(`SELECT time_zone FROM users WHERE email = $1`, email).Scan(&timeZone)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("ошибка при получении часового пояса пользователя: %v", err)
+	}
+	return timeZone, nil
+}
+
+// roomLocation возвращает часовой пояс комнаты
+func (s *Service) roomLocation(roomID int) (*time.Location, error) {
+	var timeZone string
+	err := s.DB.QueryRow(`
+		SELECT COALESCE(a.time_zone, '') FROM room r LEFT JOIN address a ON a.id = r.address_id WHERE r.id = $1
+	`, roomID).Scan(&timeZone)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, rooms.ErrRoomNotFound
+		}
+		return nil, fmt.Errorf("ошибка при получении комнаты: %v", err)
+	}
+	return zoneLocation(timeZone), nil
+}
+
+// mapBookingError преобразует ошибки ограничений таблицы booking в ошибки сервиса
+func mapBookingError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "23P01": // exclusion_violation
+			return ErrBookingConflict
+		case "23514": // check_violation
+			return ErrInvalidInterval
+		case "23505": // unique_violation
+			if pqErr.Constraint == "booking_external_uid_idx" {
+				return ErrAlreadyImported
+			}
+		}
+	}
+	return fmt.Errorf("не удалось сохранить бронирование: %v", err)
+}
+
+// nullTime преобразует нулевое время в NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// withSavepoint выполняет fn внутри точки сохранения, чтобы ошибка одного шага
+// не прерывала всю транзакцию
+func withSavepoint(tx *sql.Tx, fn func() error) error {
+	if _, err := tx.Exec(`SAVEPOINT booking_step`); err != nil {
+		return fmt.Errorf("не удалось создать точку сохранения: %v", err)
+	}
+	if err := fn(); err != nil {
+		if _, rbErr := tx.Exec(`ROLLBACK TO SAVEPOINT booking_step`); rbErr != nil {
+			return fmt.Errorf("не удалось откатиться к точке сохранения: %v", rbErr)
+		}
+		return err
+	}
+	if _, err := tx.Exec(`RELEASE SAVEPOINT booking_step`); err != nil {
+		return fmt.Errorf("не удалось освободить точку сохранения: %v", err)
+	}
+	return nil
+}
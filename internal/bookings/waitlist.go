@@ -0,0 +1,467 @@
+package bookings
+
+import (
+	"book_talk/internal/models"
+	"book_talk/internal/rooms"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DefaultWaitlistOfferTTL - сколько по умолчанию действует предложение освободившегося интервала
+const DefaultWaitlistOfferTTL = 30 * time.Minute
+
+// Статусы записей в листе ожидания
+const (
+	WaitlistWaiting   = "WAITING"   // Пользователь ждет освобождения интервала
+	WaitlistOffered   = "OFFERED"   // Интервал удерживается для пользователя до offerExpiresAt
+	WaitlistAccepted  = "ACCEPTED"  // Пользователь принял предложение, бронирование активно
+	WaitlistExpired   = "EXPIRED"   // Предложение или сам интервал истекли
+	WaitlistCancelled = "CANCELLED" // Пользователь покинул лист ожидания или отклонил предложение
+)
+
+var (
+	ErrWaitlistEntryNotFound = errors.New("запись в листе ожидания не найдена")
+	ErrAlreadyWaiting        = errors.New("вы уже стоите в листе ожидания на этот интервал")
+	ErrSlotAvailable         = errors.New("интервал свободен, его можно забронировать")
+	ErrWaitlistClosed        = errors.New("запись в листе ожидания уже закрыта")
+	ErrOfferNotActive        = errors.New("для записи нет действующего предложения")
+)
+
+// WaitlistRequest описывает запрос на постановку в лист ожидания
+type WaitlistRequest struct {
+	RoomID int       `json:"roomId"` // Идентификатор комнаты
+	Start  time.Time `json:"start"`  // Начало желаемого интервала в формате RFC 3339
+	End    time.Time `json:"end"`    // Окончание желаемого интервала в формате RFC 3339
+}
+
+// WaitlistEntry - запись пользователя в листе ожидания
+type WaitlistEntry struct {
+	ID             int        `json:"id"`
+	RoomID         int        `json:"roomId"`
+	Start          time.Time  `json:"start"`
+	End            time.Time  `json:"end"`
+	Status         string     `json:"status"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	Position       int        `json:"position,omitempty"`       // Место в очереди, только для WAITING
+	BookingID      *int       `json:"bookingId,omitempty"`      // Удерживающее или принятое бронирование
+	OfferExpiresAt *time.Time `json:"offerExpiresAt,omitempty"` // До какого момента можно принять предложение
+}
+
+// JoinWaitlist ставит пользователя в очередь на занятый интервал комнаты
+func (s *Service) JoinWaitlist(email string, req WaitlistRequest) (*WaitlistEntry, error) {
+	if req.Start.IsZero() || req.End.IsZero() || !req.End.After(req.Start) {
+		return nil, ErrInvalidInterval
+	}
+	if req.Start.Before(time.Now()) {
+		return nil, ErrBookingInPast
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	policy, loc, err := checkRoomTx(tx, req.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	if err := rooms.CheckPolicy(policy, loc, req.Start, req.End, time.Now()); err != nil {
+		return nil, err
+	}
+	if err := rooms.CheckClosedTx(tx, req.RoomID, loc, req.Start, req.End); err != nil {
+		return nil, err
+	}
+
+	blockedStart, blockedEnd := rooms.BlockedInterval(policy, req.Start, req.End)
+	var busy bool
+	err = tx.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM booking
+			WHERE room_id = $1 AND blocked_period && tstzrange($2, $3, '[)') AND status <> ALL($4)
+		)
+	`, req.RoomID, blockedStart, blockedEnd, pq.Array(models.ReleasedBookingStatuses)).Scan(&busy)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при проверке занятости комнаты: %v", err)
+	}
+	if !busy {
+		return nil, ErrSlotAvailable
+	}
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO waitlist_entry (room_id, user_email, start_time, end_time) VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, req.RoomID, email, req.Start, req.End).Scan(&id)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return nil, ErrAlreadyWaiting
+		}
+		return nil, fmt.Errorf("не удалось сохранить запись в листе ожидания: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+
+	return s.getWaitlistEntry(email, id)
+}
+
+const waitlistSelect = `
+	SELECT w.id, w.room_id, w.start_time, w.end_time, w.status, w.created_at, w.booking_id, w.offer_expires_at,
+		   (SELECT count(*) FROM waitlist_entry o
+			WHERE o.room_id = w.room_id AND o.status = 'WAITING'
+			  AND o.start_time < w.end_time AND o.end_time > w.start_time
+			  AND (o.created_at, o.id) < (w.created_at, w.id)) + 1
+	FROM waitlist_entry w
+`
+
+func scanWaitlistEntry(row rowScanner) (WaitlistEntry, error) {
+	var entry WaitlistEntry
+	var bookingID sql.NullInt64
+	var offerExpiresAt sql.NullTime
+
+	err := row.Scan(&entry.ID, &entry.RoomID, &entry.Start, &entry.End, &entry.Status, &entry.CreatedAt,
+		&bookingID, &offerExpiresAt, &entry.Position)
+	if err != nil {
+		return entry, err
+	}
+
+	if entry.Status != WaitlistWaiting {
+		entry.Position = 0
+	}
+	if bookingID.Valid {
+		id := int(bookingID.Int64)
+		entry.BookingID = &id
+	}
+	if offerExpiresAt.Valid {
+		entry.OfferExpiresAt = &offerExpiresAt.Time
+	}
+	return entry, nil
+}
+
+func (s *Service) getWaitlistEntry(email string, id int) (*WaitlistEntry, error) {
+	entry, err := scanWaitlistEntry(s.DB.QueryRow(waitlistSelect+" WHERE w.id = $1 AND w.user_email = $2", id, email))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrWaitlistEntryNotFound
+		}
+		return nil, fmt.Errorf("ошибка при получении записи листа ожидания: %v", err)
+	}
+	return &entry, nil
+}
+
+// GetWaitlist возвращает действующие записи пользователя в листе ожидания
+func (s *Service) GetWaitlist(email string) ([]WaitlistEntry, error) {
+	rows, err := s.DB.Query(waitlistSelect+" WHERE w.user_email = $1 AND w.status IN ($2, $3) ORDER BY w.start_time, w.id",
+		email, WaitlistWaiting, WaitlistOffered)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении листа ожидания: %v", err)
+	}
+	defer rows.Close()
+
+	entries := []WaitlistEntry{}
+	for rows.Next() {
+		entry, err := scanWaitlistEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при обработке листа ожидания: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// waitlistOffer - запись с действующим предложением и удерживающее ее бронирование
+type waitlistOffer struct {
+	entryID   int
+	email     string
+	status    string
+	expiresAt sql.NullTime
+	bookingID sql.NullInt64
+	roomID    int
+	start     time.Time
+	end       time.Time
+}
+
+// loadWaitlistEntryTx загружает запись пользователя вместе с удерживающим бронированием и блокирует ее
+func loadWaitlistEntryTx(tx *sql.Tx, email string, id int) (*waitlistOffer, error) {
+	var offer waitlistOffer
+	var start, end sql.NullTime
+	err := tx.QueryRow(`
+		SELECT w.id, w.user_email, w.status, w.offer_expires_at, w.booking_id, w.room_id, b.start_time, b.end_time
+		FROM waitlist_entry w
+		LEFT JOIN booking b ON b.id = w.booking_id
+		WHERE w.id = $1 AND w.user_email = $2
+		FOR UPDATE OF w
+	`, id, email).Scan(&offer.entryID, &offer.email, &offer.status, &offer.expiresAt, &offer.bookingID,
+		&offer.roomID, &start, &end)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrWaitlistEntryNotFound
+		}
+		return nil, fmt.Errorf("ошибка при получении записи листа ожидания: %v", err)
+	}
+	offer.start, offer.end = start.Time, end.Time
+	return &offer, nil
+}
+
+// AcceptWaitlistOffer принимает предложение: удерживающее бронирование становится активным,
+// а в комнате с согласованием - ожидающим согласования
+func (s *Service) AcceptWaitlistOffer(email string, id int) (*models.Booking, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	offer, err := loadWaitlistEntryTx(tx, email, id)
+	if err != nil {
+		return nil, err
+	}
+	if offer.status != WaitlistOffered || !offer.bookingID.Valid || !offer.expiresAt.Time.After(time.Now()) {
+		return nil, ErrOfferNotActive
+	}
+
+	// Предложение расходует квоту только после того, как его приняли
+	bookingID := int(offer.bookingID.Int64)
+	var start, end time.Time
+	if err := tx.QueryRow(`SELECT start_time, end_time FROM booking WHERE id = $1`, bookingID).Scan(&start, &end); err != nil {
+		return nil, fmt.Errorf("ошибка при получении бронирования: %v", err)
+	}
+	loc, err := s.roomLocation(offer.roomID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkQuotasTx(tx, email, bookingID, start, end, loc); err != nil {
+		return nil, err
+	}
+
+	status, approvalExpiresAt, err := s.initialStatusTx(tx, email, offer.roomID, offer.start)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`UPDATE booking SET status = $1, approval_expires_at = $2 WHERE id = $3`, status, approvalExpiresAt, bookingID)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось подтвердить бронирование: %v", err)
+	}
+	if err := recordHistoryTx(tx, bookingID, email, HistoryUpdated, "предложение из листа ожидания принято"); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`UPDATE waitlist_entry SET status = $1 WHERE id = $2`, WaitlistAccepted, id); err != nil {
+		return nil, fmt.Errorf("не удалось обновить запись листа ожидания: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+
+	return s.GetBooking(bookingID)
+}
+
+// LeaveWaitlist удаляет пользователя из очереди. Если ему уже предложен интервал,
+// предложение отклоняется и интервал предлагается следующему в очереди.
+func (s *Service) LeaveWaitlist(email string, id int) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	offer, err := loadWaitlistEntryTx(tx, email, id)
+	if err != nil {
+		return err
+	}
+	if offer.status != WaitlistWaiting && offer.status != WaitlistOffered {
+		return ErrWaitlistClosed
+	}
+
+	if _, err := tx.Exec(`UPDATE waitlist_entry SET status = $1 WHERE id = $2`, WaitlistCancelled, id); err != nil {
+		return fmt.Errorf("не удалось обновить запись листа ожидания: %v", err)
+	}
+	if offer.status == WaitlistOffered && offer.bookingID.Valid {
+		if err := s.withdrawOfferTx(tx, offer, email, "предложение из листа ожидания отклонено"); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+	return nil
+}
+
+// withdrawOfferTx отменяет удерживающее бронирование и предлагает интервал следующему в очереди
+func (s *Service) withdrawOfferTx(tx *sql.Tx, offer *waitlistOffer, actor, reason string) error {
+	if err := cancelBookingTx(tx, int(offer.bookingID.Int64), actor, reason); err != nil {
+		return err
+	}
+	return s.offerFreedSlotTx(tx, offer.roomID, offer.start, offer.end)
+}
+
+// offerFreedSlotTx предлагает освободившийся интервал комнаты ожидающим в порядке очереди.
+// Для каждой записи, интервал которой теперь свободен, создается удерживающее бронирование со статусом OFFERED,
+// поэтому никто другой не сможет занять интервал, пока действует предложение. Записи, интервал которых
+// все еще пересекается с другими бронированиями, остаются в очереди. Если интервал записи уже начался,
+// предлагается его оставшаяся часть.
+func (s *Service) offerFreedSlotTx(tx *sql.Tx, roomID int, start, end time.Time) error {
+	if start.IsZero() || end.IsZero() {
+		return nil
+	}
+
+	rows, err := tx.Query(`
+		SELECT id, user_email, start_time, end_time FROM waitlist_entry
+		WHERE room_id = $1 AND status = $2 AND start_time < $4 AND end_time > $3 AND end_time > now()
+		ORDER BY created_at, id
+		FOR UPDATE
+	`, roomID, WaitlistWaiting, start, end)
+	if err != nil {
+		return fmt.Errorf("ошибка при получении листа ожидания: %v", err)
+	}
+
+	type waitingEntry struct {
+		id         int
+		email      string
+		start, end time.Time
+	}
+	var entries []waitingEntry
+	for rows.Next() {
+		var entry waitingEntry
+		if err := rows.Scan(&entry.id, &entry.email, &entry.start, &entry.end); err != nil {
+			rows.Close()
+			return fmt.Errorf("ошибка при обработке листа ожидания: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		offerStart := entry.start
+		if earliest := time.Now().Add(time.Minute).Truncate(time.Minute); offerStart.Before(earliest) {
+			offerStart = earliest
+		}
+		if !offerStart.Before(entry.end) {
+			continue
+		}
+
+		var bookingID int
+		err := withSavepoint(tx, func() error {
+			var err error
+			bookingID, err = s.createBookingTx(tx, entry.email, BookingRequest{
+				RoomID: roomID,
+				Start:  offerStart,
+				End:    entry.end,
+				status: models.BookingStatusOffered,
+			})
+			return err
+		})
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrBookingConflict), errors.Is(err, ErrBookingInPast), errors.Is(err, ErrRoomInactive),
+			errors.Is(err, rooms.ErrRoomClosed):
+			continue
+		default:
+			return err
+		}
+
+		_, err = tx.Exec(`
+			UPDATE waitlist_entry SET status = $1, booking_id = $2, offer_expires_at = now() + make_interval(secs => $3)
+			WHERE id = $4
+		`, WaitlistOffered, bookingID, s.WaitlistOfferTTL.Seconds(), entry.id)
+		if err != nil {
+			return fmt.Errorf("не удалось сохранить предложение из листа ожидания: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// ExpireWaitlist отзывает просроченные предложения, передавая интервал следующему в очереди,
+// и закрывает записи, интервал которых уже закончился. Возвращает число отозванных предложений.
+func (s *Service) ExpireWaitlist() (int, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT w.id, w.user_email, w.status, w.offer_expires_at, w.booking_id, w.room_id, b.start_time, b.end_time
+		FROM waitlist_entry w
+		JOIN booking b ON b.id = w.booking_id
+		WHERE w.status = $1 AND w.offer_expires_at <= now()
+		ORDER BY w.offer_expires_at
+		FOR UPDATE OF w SKIP LOCKED
+	`, WaitlistOffered)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при получении просроченных предложений: %v", err)
+	}
+
+	var offers []waitlistOffer
+	for rows.Next() {
+		var offer waitlistOffer
+		err := rows.Scan(&offer.entryID, &offer.email, &offer.status, &offer.expiresAt, &offer.bookingID,
+			&offer.roomID, &offer.start, &offer.end)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("ошибка при обработке просроченных предложений: %v", err)
+		}
+		offers = append(offers, offer)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for i := range offers {
+		offer := &offers[i]
+		if _, err := tx.Exec(`UPDATE waitlist_entry SET status = $1 WHERE id = $2`, WaitlistExpired, offer.entryID); err != nil {
+			return 0, fmt.Errorf("не удалось обновить запись листа ожидания: %v", err)
+		}
+		if err := s.withdrawOfferTx(tx, offer, historySystemActor, "предложение из листа ожидания истекло"); err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE waitlist_entry SET status = $1 WHERE status = $2 AND end_time <= now()`, WaitlistExpired, WaitlistWaiting)
+	if err != nil {
+		return 0, fmt.Errorf("не удалось закрыть устаревшие записи листа ожидания: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+	return len(offers), nil
+}
+
+// RunWaitlistExpirer раз в interval отзывает просроченные предложения из листа ожидания, пока не отменен ctx
+func (s *Service) RunWaitlistExpirer(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		expired, err := s.ExpireWaitlist()
+		if err != nil {
+			log.Println("Ошибка при обработке листа ожидания:", err)
+		} else if expired > 0 {
+			log.Printf("Отозвано просроченных предложений из листа ожидания: %d", expired)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
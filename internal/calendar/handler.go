@@ -0,0 +1,164 @@
+package calendar
+
+import (
+	"book_talk/internal/ical"
+	"book_talk/internal/models"
+	"book_talk/internal/rooms"
+	mw "book_talk/middleware"
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	CalendarService *Service
+}
+
+// Новый хэндлер для инициализации с сервисом
+func NewCalendarHandler(db *sql.DB) *Handler {
+	return &Handler{
+		CalendarService: NewCalendarService(db),
+	}
+}
+
+// ProtectFeed проверяет токен календаря из параметра token.
+// Календарные клиенты не умеют передавать заголовок Authorization, поэтому mw.Protect здесь не подходит.
+func (h *Handler) ProtectFeed(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email, err := h.CalendarService.Authenticate(r.URL.Query().Get("token"))
+		if err != nil {
+			if errors.Is(err, ErrInvalidFeedToken) {
+				mw.SendJSONResponse(w, &models.Response{Message: err.Error()}, http.StatusUnauthorized)
+				return
+			}
+			mw.SendJSONResponse(w, &models.Response{Message: err.Error()}, http.StatusInternalServerError)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), "email", email)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// sendCalendar отправляет календарь в формате iCalendar
+func sendCalendar(w http.ResponseWriter, data []byte, filename string) {
+	w.Header().Set("Content-Type", ical.ContentType)
+	w.Header().Set("Content-Disposition", `inline; filename="`+filename+`"`)
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func (h *Handler) GetUserCalendar(w http.ResponseWriter, r *http.Request) {
+	email, ok := r.Context().Value("email").(string)
+	if !ok {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Unauthorized",
+		}, http.StatusUnauthorized)
+		return
+	}
+
+	data, err := h.CalendarService.UserCalendar(email)
+	if err != nil {
+		mw.SendJSONResponse(w, &models.Response{Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	sendCalendar(w, data, "bookings.ics")
+}
+
+func (h *Handler) GetRoomCalendar(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id <= 0 {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный идентификатор комнаты"}, http.StatusBadRequest)
+		return
+	}
+
+	data, err := h.CalendarService.RoomCalendar(id)
+	if err != nil {
+		if errors.Is(err, rooms.ErrRoomNotFound) {
+			mw.SendJSONResponse(w, &models.Response{Message: err.Error()}, http.StatusNotFound)
+			return
+		}
+		mw.SendJSONResponse(w, &models.Response{Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	sendCalendar(w, data, "calendar.ics")
+}
+
+func (h *Handler) CreateFeedToken(w http.ResponseWriter, r *http.Request) {
+	email, ok := r.Context().Value("email").(string)
+	if !ok {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Unauthorized",
+		}, http.StatusUnauthorized)
+		return
+	}
+
+	token, err := h.CalendarService.CreateFeedToken(email)
+	if err != nil {
+		mw.SendJSONResponse(w, &models.Response{Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Токен календаря создан, сохраните его: повторно он не показывается",
+		Data: map[string]interface{}{
+			"token":       token,
+			"bookingsUrl": "/api/v1/me/bookings.ics?token=" + token.Token,
+		},
+	}, http.StatusCreated)
+}
+
+func (h *Handler) GetFeedTokens(w http.ResponseWriter, r *http.Request) {
+	email, ok := r.Context().Value("email").(string)
+	if !ok {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Unauthorized",
+		}, http.StatusUnauthorized)
+		return
+	}
+
+	tokens, err := h.CalendarService.GetFeedTokens(email)
+	if err != nil {
+		mw.SendJSONResponse(w, &models.Response{Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Токены календаря успешно получены",
+		Data:    map[string][]FeedToken{"tokens": tokens},
+	}, http.StatusOK)
+}
+
+func (h *Handler) RevokeFeedToken(w http.ResponseWriter, r *http.Request) {
+	email, ok := r.Context().Value("email").(string)
+	if !ok {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Unauthorized",
+		}, http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id <= 0 {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный идентификатор токена"}, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.CalendarService.RevokeFeedToken(email, id); err != nil {
+		if errors.Is(err, ErrFeedTokenNotFound) {
+			mw.SendJSONResponse(w, &models.Response{Message: err.Error()}, http.StatusNotFound)
+			return
+		}
+		mw.SendJSONResponse(w, &models.Response{Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{Message: "Токен календаря отозван"}, http.StatusOK)
+}
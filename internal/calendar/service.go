@@ -0,0 +1,241 @@
+package calendar
+
+import (
+	"book_talk/internal/auth"
+	"book_talk/internal/bookings"
+	"book_talk/internal/ical"
+	"book_talk/internal/models"
+	"book_talk/internal/rooms"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Период, который попадает в ленту календаря
+const (
+	feedPastDays   = 90
+	feedFutureDays = 365
+)
+
+type Service struct {
+	DB             *sql.DB
+	BookingService *bookings.Service
+	RoomService    *rooms.Service
+	PasswordMaxAge time.Duration // Срок действия пароля владельца ленты, 0 - пароль не истекает
+}
+
+func NewCalendarService(db *sql.DB) *Service {
+	return &Service{
+		DB:             db,
+		BookingService: bookings.NewBookingsService(db),
+		RoomService:    rooms.NewRoomsService(db),
+		PasswordMaxAge: auth.DefaultPasswordMaxAge,
+	}
+}
+
+var (
+	ErrInvalidFeedToken  = errors.New("неверный или отозванный токен календаря")
+	ErrFeedTokenNotFound = errors.New("токен календаря не найден")
+)
+
+// FeedToken - токен подписки на календарь. Значение токена возвращается только при создании.
+type FeedToken struct {
+	ID         int        `json:"id"`
+	Token      string     `json:"token,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+// hashToken возвращает хеш токена, который хранится в базе данных вместо самого токена
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateFeedToken выпускает новый токен подписки на календарь для пользователя
+func (s *Service) CreateFeedToken(email string) (*FeedToken, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("ошибка при генерации токена: %v", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	feedToken := FeedToken{Token: token}
+	err := s.DB.QueryRow(`
+		INSERT INTO calendar_feed_token (user_email, token_hash) VALUES ($1, $2)
+		RETURNING id, created_at
+	`, email, hashToken(token)).Scan(&feedToken.ID, &feedToken.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось сохранить токен календаря: %v", err)
+	}
+
+	return &feedToken, nil
+}
+
+// GetFeedTokens возвращает действующие токены пользователя без их значений
+func (s *Service) GetFeedTokens(email string) ([]FeedToken, error) {
+	rows, err := s.DB.Query(`
+		SELECT id, created_at, last_used_at FROM calendar_feed_token
+		WHERE user_email = $1 AND revoked_at IS NULL
+		ORDER BY created_at
+	`, email)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении токенов календаря: %v", err)
+	}
+	defer rows.Close()
+
+	tokens := []FeedToken{}
+	for rows.Next() {
+		var token FeedToken
+		var lastUsedAt sql.NullTime
+		if err := rows.Scan(&token.ID, &token.CreatedAt, &lastUsedAt); err != nil {
+			return nil, fmt.Errorf("ошибка при обработке токенов календаря: %v", err)
+		}
+		if lastUsedAt.Valid {
+			token.LastUsedAt = &lastUsedAt.Time
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// RevokeFeedToken отзывает токен пользователя
+func (s *Service) RevokeFeedToken(email string, id int) error {
+	result, err := s.DB.Exec(`
+		UPDATE calendar_feed_token SET revoked_at = now()
+		WHERE id = $1 AND user_email = $2 AND revoked_at IS NULL
+	`, id, email)
+	if err != nil {
+		return fmt.Errorf("не удалось отозвать токен календаря: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrFeedTokenNotFound
+	}
+	return nil
+}
+
+// Authenticate возвращает email владельца действующего токена.
+// Владелец проверяется так же, как при входе: лента заблокированного, отключенного или истекшего аккаунта не отдается.
+func (s *Service) Authenticate(token string) (string, error) {
+	if token == "" {
+		return "", ErrInvalidFeedToken
+	}
+
+	var id int
+	var email string
+	err := s.DB.QueryRow(`
+		SELECT t.id, u.email FROM calendar_feed_token t
+		JOIN users u ON u.email = t.user_email
+		WHERE t.token_hash = $1 AND t.revoked_at IS NULL
+	`, hashToken(token)).Scan(&id, &email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrInvalidFeedToken
+		}
+		return "", fmt.Errorf("ошибка при проверке токена календаря: %v", err)
+	}
+
+	if err := auth.CheckAccount(s.DB, email, s.PasswordMaxAge); err != nil {
+		if errors.Is(err, auth.ErrAccountUnavailable) {
+			return "", fmt.Errorf("%w: %w", ErrInvalidFeedToken, err)
+		}
+		return "", err
+	}
+
+	if _, err := s.DB.Exec(`UPDATE calendar_feed_token SET last_used_at = now() WHERE id = $1`, id); err != nil {
+		return "", fmt.Errorf("ошибка при проверке токена календаря: %v", err)
+	}
+	return email, nil
+}
+
+func feedPeriod() (time.Time, time.Time) {
+	now := time.Now()
+	return now.AddDate(0, 0, -feedPastDays), now.AddDate(0, 0, feedFutureDays)
+}
+
+// UserCalendar возвращает календарь бронирований пользователя
+func (s *Service) UserCalendar(email string) ([]byte, error) {
+	from, to := feedPeriod()
+	items, err := s.BookingService.ListBookings(bookings.ListFilter{UserEmail: email, Invited: true, From: from, To: to})
+	if err != nil {
+		return nil, err
+	}
+
+	calendar := ical.Calendar{Name: "Мои бронирования"}
+	for _, booking := range items {
+		event := bookingEvent(booking)
+		event.Summary = booking.Room.Name
+		// В своей ленте пользователь видит, кто владелец бронирований, в которые он приглашен
+		event.Description += ", " + booking.User.Email
+		calendar.Events = append(calendar.Events, event)
+	}
+
+	return calendar.Encode(), nil
+}
+
+// RoomCalendar возвращает календарь бронирований комнаты
+func (s *Service) RoomCalendar(roomID int) ([]byte, error) {
+	room, err := s.RoomService.GetRoom(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	from, to := feedPeriod()
+	items, err := s.BookingService.ListBookings(bookings.ListFilter{RoomID: roomID, From: from, To: to})
+	if err != nil {
+		return nil, err
+	}
+
+	calendar := ical.Calendar{Name: room.Name}
+	for _, booking := range items {
+		event := bookingEvent(booking)
+		// Ленту комнаты может получить любой пользователь, поэтому в ней нет данных о том, кто бронировал
+		event.Summary = "Забронировано"
+		calendar.Events = append(calendar.Events, event)
+	}
+
+	return calendar.Encode(), nil
+}
+
+// bookingEvent преобразует бронирование в событие календаря
+func bookingEvent(booking models.Booking) ical.Event {
+	return ical.Event{
+		UID:         fmt.Sprintf("booking-%d@book_talk", booking.ID),
+		Start:       booking.Start,
+		End:         booking.End,
+		Location:    roomLocation(booking.Room),
+		Description: fmt.Sprintf("Бронирование #%d", booking.ID),
+		Status:      eventStatus(booking.Status),
+	}
+}
+
+// eventStatus возвращает статус события календаря для статуса бронирования.
+// Отмененные и освобожденные бронирования остаются в ленте, чтобы клиенты удалили их у себя.
+func eventStatus(status string) string {
+	switch status {
+	case models.BookingStatusCancelled, models.BookingStatusNoShow, models.BookingStatusRejected, models.BookingStatusExpired:
+		return "CANCELLED"
+	case models.BookingStatusOffered, models.BookingStatusPending:
+		return "TENTATIVE"
+	}
+	return "CONFIRMED"
+}
+
+// roomLocation формирует строку места проведения из названия и адреса комнаты
+func roomLocation(room models.Room) string {
+	parts := []string{room.Name}
+	address := room.Address
+	for _, part := range []string{address.Street, address.Building, address.City, address.Region} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,103 @@
+package calendar
+
+import (
+	"book_talk/internal/auth"
+	"book_talk/internal/database/dbtest"
+	"errors"
+	"testing"
+)
+
+func TestAuthenticate(t *testing.T) {
+	const email = "user@example.com"
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, s *Service, token *FeedToken)
+		wantErr error
+	}{
+		{name: "valid token", prepare: func(t *testing.T, s *Service, token *FeedToken) {}},
+		{
+			name: "revoked token",
+			prepare: func(t *testing.T, s *Service, token *FeedToken) {
+				if err := s.RevokeFeedToken(email, token.ID); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: ErrInvalidFeedToken,
+		},
+		{
+			name: "sessions revoked",
+			prepare: func(t *testing.T, s *Service, token *FeedToken) {
+				tx, err := s.DB.Begin()
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer tx.Rollback()
+				if err := auth.RevokeUserSessions(tx, email); err != nil {
+					t.Fatal(err)
+				}
+				if err := tx.Commit(); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: ErrInvalidFeedToken,
+		},
+		{
+			name:    "locked account",
+			prepare: setUser(email, "account_non_locked = false"),
+			wantErr: auth.ErrAccountLocked,
+		},
+		{
+			name:    "disabled account",
+			prepare: setUser(email, "enabled = false"),
+			wantErr: auth.ErrAccountDisabled,
+		},
+		{
+			name:    "expired account",
+			prepare: setUser(email, "account_non_expired = false"),
+			wantErr: auth.ErrAccountExpired,
+		},
+		{
+			name:    "expired password",
+			prepare: setUser(email, "password_changed_at = now() - interval '1 year'"),
+			wantErr: auth.ErrCredentialsExpired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := dbtest.Open(t)
+			_, err := database.Exec(`
+				INSERT INTO users (email, password, first_name, last_name, email_verified_at) VALUES ($1, 'x', 'Иван', 'Иванов', now())
+			`, email)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := NewCalendarService(database)
+			token, err := s.CreateFeedToken(email)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.prepare(t, s, token)
+
+			got, err := s.Authenticate(token.Token)
+			if tt.wantErr != nil {
+				if !errors.Is(err, ErrInvalidFeedToken) || !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != email {
+				t.Fatalf("Authenticate() = %q, %v; want %q", got, err, email)
+			}
+		})
+	}
+}
+
+// setUser возвращает подготовку теста, которая меняет пользователя email выражением set
+func setUser(email, set string) func(t *testing.T, s *Service, token *FeedToken) {
+	return func(t *testing.T, s *Service, token *FeedToken) {
+		if _, err := s.DB.Exec(`UPDATE users SET `+set+` WHERE email = $1`, email); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
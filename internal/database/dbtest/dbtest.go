@@ -0,0 +1,142 @@
+// Package dbtest подготавливает PostgreSQL для тестов, которым нужна настоящая база данных
+package dbtest
+
+import (
+	db "book_talk/internal/database"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"os"
+	"strings"
+	"testing"
+)
+
+// baseline - таблицы, которые существовали до появления миграций и ими не создаются
+const baseline = `
+	CREATE TABLE address (
+		id       INT PRIMARY KEY,
+		region   VARCHAR(255) NOT NULL,
+		city     VARCHAR(255) NOT NULL,
+		street   VARCHAR(255) NOT NULL,
+		building VARCHAR(255) NOT NULL
+	);
+	CREATE TABLE department (
+		id         INT PRIMARY KEY,
+		name       VARCHAR(255) NOT NULL,
+		short_name VARCHAR(255) NOT NULL,
+		color      VARCHAR(255) NOT NULL
+	);
+	CREATE TABLE users (
+		email                   VARCHAR(255) PRIMARY KEY,
+		first_name              VARCHAR(255) NOT NULL,
+		last_name               VARCHAR(255) NOT NULL,
+		password                VARCHAR(255) NOT NULL,
+		department_id           INT REFERENCES department (id),
+		image                   VARCHAR(255) DEFAULT NULL,
+		theme                   VARCHAR(255) DEFAULT 'System',
+		credentials_non_expired BOOLEAN DEFAULT true,
+		account_non_expired     BOOLEAN DEFAULT true,
+		account_non_locked      BOOLEAN DEFAULT true,
+		enabled                 BOOLEAN DEFAULT true
+	);
+	CREATE TABLE department_user (
+		department_id INT NOT NULL REFERENCES department (id),
+		user_email    VARCHAR(255) NOT NULL REFERENCES users (email),
+		PRIMARY KEY (department_id, user_email)
+	);
+	CREATE TABLE role (
+		id         INT PRIMARY KEY,
+		authority  VARCHAR(255) NOT NULL,
+		user_email VARCHAR(255) REFERENCES users (email)
+	);
+	CREATE TABLE user_role (
+		user_email VARCHAR(255) NOT NULL REFERENCES users (email),
+		role_id    INT NOT NULL REFERENCES role (id),
+		PRIMARY KEY (user_email, role_id)
+	);
+	CREATE TABLE room (
+		id         INT PRIMARY KEY,
+		capacity   INT NOT NULL,
+		name       VARCHAR(255) NOT NULL,
+		address_id INT REFERENCES address (id),
+		image_path VARCHAR(255) DEFAULT NULL,
+		active     BOOLEAN DEFAULT true
+	);
+	CREATE TABLE booking (
+		id         INT PRIMARY KEY,
+		room_id    INT REFERENCES room (id),
+		user_email VARCHAR(255) REFERENCES users (email),
+		time       VARCHAR NOT NULL
+	);
+	CREATE TABLE user_booking (
+		user_email VARCHAR(255) NOT NULL REFERENCES users (email),
+		booking_id INT NOT NULL REFERENCES booking (id),
+		PRIMARY KEY (user_email, booking_id)
+	);
+	CREATE TABLE weekday (
+		id         INT PRIMARY KEY,
+		day        VARCHAR(255) NOT NULL,
+		start_time TIME NOT NULL,
+		end_time   TIME NOT NULL,
+		room_id    INT REFERENCES room (id),
+		active     BOOLEAN DEFAULT true
+	);`
+
+// Open подключается к базе из TEST_DATABASE_URL, создает для теста отдельную схему с исходными таблицами
+// и применяет к ней миграции. Схема удаляется после теста. Без TEST_DATABASE_URL тест пропускается.
+func Open(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL не задан, тест с базой данных пропущен")
+	}
+
+	raw := make([]byte, 6)
+	if _, err := rand.Read(raw); err != nil {
+		t.Fatal(err)
+	}
+	schema := "test_" + hex.EncodeToString(raw)
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("не удалось подключиться к тестовой базе: %v", err)
+	}
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		admin.Close()
+		t.Fatalf("не удалось создать схему %s: %v", schema, err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`); err != nil {
+			t.Errorf("не удалось удалить схему %s: %v", schema, err)
+		}
+		admin.Close()
+	})
+
+	// Расширения вроде btree_gist обычно установлены в public, поэтому она остается в пути поиска
+	database, err := sql.Open("postgres", withSearchPath(dsn, schema+",public"))
+	if err != nil {
+		t.Fatalf("не удалось подключиться к тестовой базе: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	if _, err := database.Exec(baseline); err != nil {
+		t.Fatalf("не удалось создать исходные таблицы: %v", err)
+	}
+	if err := db.Migrate(database); err != nil {
+		t.Fatalf("не удалось применить миграции: %v", err)
+	}
+	return database
+}
+
+// withSearchPath добавляет к строке подключения параметр search_path в формате URL или key=value
+func withSearchPath(dsn, path string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		separator := "?"
+		if strings.Contains(dsn, "?") {
+			separator = "&"
+		}
+		return dsn + separator + "search_path=" + strings.ReplaceAll(path, ",", "%2C")
+	}
+	return dsn + " search_path=" + path
+}
@@ -0,0 +1,367 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// migrations содержит изменения схемы в порядке применения.
+// Уже примененные шаги повторно не выполняются: их номера хранятся в таблице schema_migration.
+// Новые шаги добавляются только в конец списка.
+var migrations = []string{
+	// 1: автоинкремент идентификаторов для справочников комнат
+	`DO $$
+	DECLARE t text;
+	BEGIN
+		FOREACH t IN ARRAY ARRAY['address', 'room', 'weekday'] LOOP
+			IF pg_get_serial_sequence(t, 'id') IS NULL THEN
+				EXECUTE format('ALTER TABLE %I ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY', t);
+				EXECUTE format('SELECT setval(pg_get_serial_sequence(%L, ''id''), COALESCE((SELECT max(id) FROM %I), 0) + 1, false)', t, t);
+			END IF;
+		END LOOP;
+	END $$`,
+
+	// 2: интервалы бронирований и запрет пересечений на уровне БД
+	`DO $$
+	BEGIN
+		IF pg_get_serial_sequence('booking', 'id') IS NULL THEN
+			ALTER TABLE booking ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+			PERFORM setval(pg_get_serial_sequence('booking', 'id'), COALESCE((SELECT max(id) FROM booking), 0) + 1, false);
+		END IF;
+	END $$;
+	CREATE EXTENSION IF NOT EXISTS btree_gist;
+	ALTER TABLE booking
+		ADD COLUMN start_time TIMESTAMPTZ,
+		ADD COLUMN end_time   TIMESTAMPTZ;
+	ALTER TABLE booking
+		ADD COLUMN period TSTZRANGE GENERATED ALWAYS AS (
+			CASE WHEN start_time IS NOT NULL AND end_time IS NOT NULL THEN tstzrange(start_time, end_time, '[)') END
+		) STORED,
+		ADD CONSTRAINT booking_interval_check CHECK (start_time < end_time);
+	ALTER TABLE booking
+		ADD CONSTRAINT booking_room_period_excl EXCLUDE USING gist (room_id WITH =, period WITH &&);`,
+
+	// 3: повторяющиеся бронирования
+	`CREATE TABLE booking_series (
+		id               INT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		room_id          INT NOT NULL REFERENCES room (id),
+		user_email       VARCHAR(255) NOT NULL REFERENCES users (email),
+		rrule            TEXT NOT NULL,
+		dtstart          TIMESTAMPTZ NOT NULL,
+		duration_seconds INT NOT NULL CHECK (duration_seconds > 0),
+		time_zone        TEXT NOT NULL,
+		created_at       TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+	CREATE TABLE booking_series_exdate (
+		series_id INT NOT NULL REFERENCES booking_series (id) ON DELETE CASCADE,
+		exdate    TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (series_id, exdate)
+	);
+	ALTER TABLE booking
+		ADD COLUMN series_id     INT REFERENCES booking_series (id),
+		ADD COLUMN recurrence_id TIMESTAMPTZ;
+	CREATE UNIQUE INDEX booking_series_occurrence_idx ON booking (series_id, recurrence_id) WHERE series_id IS NOT NULL;`,
+
+	// 4: токены подписки на календарь бронирований
+	`CREATE TABLE calendar_feed_token (
+		id           INT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		user_email   VARCHAR(255) NOT NULL REFERENCES users (email) ON DELETE CASCADE,
+		token_hash   CHAR(64) NOT NULL UNIQUE,
+		created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+		last_used_at TIMESTAMPTZ,
+		revoked_at   TIMESTAMPTZ
+	);`,
+
+	// 5: идентификаторы событий, импортированных из iCalendar
+	`ALTER TABLE booking ADD COLUMN external_uid VARCHAR(512);
+	CREATE UNIQUE INDEX booking_external_uid_idx ON booking (room_id, external_uid) WHERE external_uid IS NOT NULL;`,
+
+	// 6: статус бронирования и история изменений; отмененные бронирования не занимают комнату
+	`ALTER TABLE booking ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'ACTIVE';
+	ALTER TABLE booking DROP CONSTRAINT booking_room_period_excl;
+	ALTER TABLE booking
+		ADD CONSTRAINT booking_room_period_excl EXCLUDE USING gist (room_id WITH =, period WITH &&)
+		WHERE (status <> 'CANCELLED');
+	DROP INDEX booking_series_occurrence_idx;
+	CREATE UNIQUE INDEX booking_series_occurrence_idx ON booking (series_id, recurrence_id)
+		WHERE series_id IS NOT NULL AND status <> 'CANCELLED';
+	CREATE TABLE booking_history (
+		id         INT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		booking_id INT NOT NULL REFERENCES booking (id) ON DELETE CASCADE,
+		action     VARCHAR(32) NOT NULL,
+		changed_by VARCHAR(255) NOT NULL,
+		changed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		room_id    INT NOT NULL,
+		start_time TIMESTAMPTZ,
+		end_time   TIMESTAMPTZ,
+		status     VARCHAR(16) NOT NULL,
+		comment    TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX booking_history_booking_idx ON booking_history (booking_id, changed_at);`,
+
+	// 7: отметка о приходе и освобождение неподтвержденных бронирований
+	`ALTER TABLE booking ADD COLUMN checked_in_at TIMESTAMPTZ;
+	ALTER TABLE booking DROP CONSTRAINT booking_room_period_excl;
+	ALTER TABLE booking
+		ADD CONSTRAINT booking_room_period_excl EXCLUDE USING gist (room_id WITH =, period WITH &&)
+		WHERE (status NOT IN ('CANCELLED', 'NO_SHOW'));
+	CREATE INDEX booking_awaiting_check_in_idx ON booking (start_time)
+		WHERE status = 'ACTIVE' AND checked_in_at IS NULL;
+	ALTER TABLE users
+		ADD COLUMN no_show_count   INT NOT NULL DEFAULT 0,
+		ADD COLUMN last_no_show_at TIMESTAMPTZ;`,
+
+	// 8: лист ожидания занятых интервалов
+	`CREATE TABLE waitlist_entry (
+		id               INT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		room_id          INT NOT NULL REFERENCES room (id) ON DELETE CASCADE,
+		user_email       VARCHAR(255) NOT NULL REFERENCES users (email) ON DELETE CASCADE,
+		start_time       TIMESTAMPTZ NOT NULL,
+		end_time         TIMESTAMPTZ NOT NULL,
+		status           VARCHAR(16) NOT NULL DEFAULT 'WAITING',
+		created_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+		booking_id       INT REFERENCES booking (id),
+		offer_expires_at TIMESTAMPTZ,
+		CONSTRAINT waitlist_entry_interval_check CHECK (start_time < end_time)
+	);
+	CREATE INDEX waitlist_entry_queue_idx ON waitlist_entry (room_id, created_at) WHERE status = 'WAITING';
+	CREATE UNIQUE INDEX waitlist_entry_user_idx ON waitlist_entry (room_id, user_email, start_time, end_time)
+		WHERE status IN ('WAITING', 'OFFERED');`,
+
+	// 9: согласование бронирований комнат с ограниченным доступом
+	`ALTER TABLE room ADD COLUMN approval_required BOOLEAN NOT NULL DEFAULT false;
+	CREATE TABLE room_approver (
+		id            INT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		room_id       INT NOT NULL REFERENCES room (id) ON DELETE CASCADE,
+		authority     VARCHAR(255),
+		department_id INT REFERENCES department (id) ON DELETE CASCADE,
+		CONSTRAINT room_approver_target_check CHECK ((authority IS NULL) <> (department_id IS NULL))
+	);
+	CREATE INDEX room_approver_room_idx ON room_approver (room_id);
+	ALTER TABLE booking ADD COLUMN approval_expires_at TIMESTAMPTZ;
+	CREATE INDEX booking_pending_idx ON booking (approval_expires_at) WHERE status = 'PENDING';
+	ALTER TABLE booking DROP CONSTRAINT booking_room_period_excl;
+	ALTER TABLE booking
+		ADD CONSTRAINT booking_room_period_excl EXCLUDE USING gist (room_id WITH =, period WITH &&)
+		WHERE (status NOT IN ('CANCELLED', 'NO_SHOW', 'REJECTED', 'EXPIRED'));`,
+
+	// 10: фотографии комнат с уменьшенными копиями
+	`CREATE TABLE room_image (
+		id             INT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		room_id        INT NOT NULL REFERENCES room (id) ON DELETE CASCADE,
+		content_type   VARCHAR(50) NOT NULL,
+		width          INT NOT NULL,
+		height         INT NOT NULL,
+		original_path  VARCHAR(255) NOT NULL,
+		medium_path    VARCHAR(255) NOT NULL,
+		thumbnail_path VARCHAR(255) NOT NULL,
+		is_cover       BOOLEAN NOT NULL DEFAULT false,
+		created_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+	CREATE INDEX room_image_room_idx ON room_image (room_id, id);
+	CREATE UNIQUE INDEX room_image_cover_idx ON room_image (room_id) WHERE is_cover;`,
+
+	// 11: участники бронирований - зарегистрированные пользователи и внешние гости
+	`CREATE TABLE booking_attendee (
+		id          INT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		booking_id  INT NOT NULL REFERENCES booking (id) ON DELETE CASCADE,
+		user_email  VARCHAR(255) REFERENCES users (email) ON DELETE CASCADE ON UPDATE CASCADE,
+		guest_name  VARCHAR(255),
+		guest_email VARCHAR(255),
+		CONSTRAINT booking_attendee_kind_check CHECK ((user_email IS NULL) <> (guest_name IS NULL))
+	);
+	CREATE INDEX booking_attendee_booking_idx ON booking_attendee (booking_id);
+	CREATE UNIQUE INDEX booking_attendee_user_idx ON booking_attendee (user_email, booking_id) WHERE user_email IS NOT NULL;`,
+
+	// 12: правила бронирования комнат; бронирования не пересекаются с учетом буферов на подготовку и уборку
+	`ALTER TABLE room
+		ADD COLUMN min_duration_minutes   INT NOT NULL DEFAULT 0 CHECK (min_duration_minutes >= 0),
+		ADD COLUMN max_duration_minutes   INT NOT NULL DEFAULT 0 CHECK (max_duration_minutes >= 0),
+		ADD COLUMN granularity_minutes    INT NOT NULL DEFAULT 0 CHECK (granularity_minutes >= 0),
+		ADD COLUMN setup_buffer_minutes   INT NOT NULL DEFAULT 0 CHECK (setup_buffer_minutes >= 0),
+		ADD COLUMN cleanup_buffer_minutes INT NOT NULL DEFAULT 0 CHECK (cleanup_buffer_minutes >= 0),
+		ADD COLUMN booking_horizon_days   INT NOT NULL DEFAULT 0 CHECK (booking_horizon_days >= 0);
+	ALTER TABLE booking
+		ADD COLUMN blocked_start TIMESTAMPTZ,
+		ADD COLUMN blocked_end   TIMESTAMPTZ;
+	ALTER TABLE booking
+		ADD COLUMN blocked_period TSTZRANGE GENERATED ALWAYS AS (
+			CASE WHEN start_time IS NOT NULL AND end_time IS NOT NULL
+				THEN tstzrange(COALESCE(blocked_start, start_time), COALESCE(blocked_end, end_time), '[)') END
+		) STORED;
+	ALTER TABLE booking DROP CONSTRAINT booking_room_period_excl;
+	ALTER TABLE booking
+		ADD CONSTRAINT booking_room_period_excl EXCLUDE USING gist (room_id WITH =, blocked_period WITH &&)
+		WHERE (status NOT IN ('CANCELLED', 'NO_SHOW', 'REJECTED', 'EXPIRED'));`,
+
+	// 13: квоты бронирований для пользователей и отделов
+	`CREATE TABLE booking_quota (
+		id            INT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		scope         VARCHAR(20) NOT NULL CHECK (scope IN ('USER', 'DEPARTMENT')),
+		kind          VARCHAR(30) NOT NULL CHECK (kind IN ('HOURS_PER_WEEK', 'FUTURE_BOOKINGS')),
+		department_id INT REFERENCES department (id) ON DELETE CASCADE,
+		limit_value   INT NOT NULL CHECK (limit_value >= 0)
+	);
+	CREATE UNIQUE INDEX booking_quota_target_idx ON booking_quota (scope, kind, COALESCE(department_id, 0));`,
+
+	// 14: делегирование бронирований и автор бронирования
+	`CREATE TABLE booking_delegate (
+		owner_email    VARCHAR(255) NOT NULL REFERENCES users (email) ON DELETE CASCADE ON UPDATE CASCADE,
+		delegate_email VARCHAR(255) NOT NULL REFERENCES users (email) ON DELETE CASCADE ON UPDATE CASCADE,
+		created_at     TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (owner_email, delegate_email),
+		CONSTRAINT booking_delegate_self_check CHECK (owner_email <> delegate_email)
+	);
+	CREATE INDEX booking_delegate_delegate_idx ON booking_delegate (delegate_email);
+	ALTER TABLE booking ADD COLUMN created_by VARCHAR(255) REFERENCES users (email) ON DELETE SET NULL ON UPDATE CASCADE;`,
+
+	// 15: праздники и закрытия: для всех комнат, для адреса или для отдельной комнаты
+	`CREATE TABLE closure (
+		id         INT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		name       VARCHAR(255) NOT NULL,
+		start_date DATE NOT NULL,
+		end_date   DATE NOT NULL,
+		address_id INT REFERENCES address (id) ON DELETE CASCADE,
+		room_id    INT REFERENCES room (id) ON DELETE CASCADE,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		CONSTRAINT closure_dates_check CHECK (end_date >= start_date),
+		CONSTRAINT closure_target_check CHECK (address_id IS NULL OR room_id IS NULL)
+	);
+	CREATE UNIQUE INDEX closure_unique_idx ON closure (start_date, end_date, COALESCE(address_id, 0), COALESCE(room_id, 0));
+	CREATE INDEX closure_dates_idx ON closure USING gist (daterange(start_date, end_date, '[]'));`,
+
+	// 16: часовые пояса адресов и пользователей; пустая строка - часовой пояс сервера
+	`ALTER TABLE address ADD COLUMN time_zone VARCHAR(64) NOT NULL DEFAULT '';
+	ALTER TABLE users ADD COLUMN time_zone VARCHAR(64) NOT NULL DEFAULT '';`,
+
+	// 17: справочник оборудования и удобств комнат
+	`CREATE TABLE amenity (
+		id   INT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		code VARCHAR(64) NOT NULL UNIQUE,
+		name VARCHAR(255) NOT NULL
+	);
+	CREATE TABLE room_amenity (
+		room_id    INT NOT NULL REFERENCES room (id) ON DELETE CASCADE,
+		amenity_id INT NOT NULL REFERENCES amenity (id) ON DELETE CASCADE,
+		PRIMARY KEY (room_id, amenity_id)
+	);
+	CREATE INDEX room_amenity_amenity_idx ON room_amenity (amenity_id);
+	INSERT INTO amenity (code, name) VALUES
+		('PROJECTOR', 'Проектор'),
+		('VIDEO_CONFERENCING', 'Видеоконференцсвязь'),
+		('WHITEBOARD', 'Маркерная доска'),
+		('WHEELCHAIR_ACCESS', 'Доступ для колясок');`,
+
+	// 18: этажи и секции зданий; комната может находиться на этаже и в секции этого этажа
+	`CREATE TABLE floor (
+		id         INT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		address_id INT NOT NULL REFERENCES address (id) ON DELETE CASCADE,
+		level      INT NOT NULL,
+		name       VARCHAR(255) NOT NULL,
+		CONSTRAINT floor_level_unique UNIQUE (address_id, level)
+	);
+	CREATE TABLE section (
+		id       INT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		floor_id INT NOT NULL REFERENCES floor (id) ON DELETE CASCADE,
+		name     VARCHAR(255) NOT NULL,
+		CONSTRAINT section_name_unique UNIQUE (floor_id, name)
+	);
+	ALTER TABLE room ADD COLUMN floor_id INT REFERENCES floor (id) ON DELETE SET NULL;
+	ALTER TABLE room ADD COLUMN section_id INT REFERENCES section (id) ON DELETE SET NULL;
+	CREATE INDEX room_floor_idx ON room (floor_id);
+	CREATE INDEX room_section_idx ON room (section_id);`,
+
+	// 19: выпущенные refresh токены; токены одного входа образуют семейство, которое отзывается целиком
+	`CREATE TABLE refresh_token (
+		jti        VARCHAR(64) PRIMARY KEY,
+		family_id  VARCHAR(64) NOT NULL,
+		user_email VARCHAR(255) NOT NULL REFERENCES users (email) ON DELETE CASCADE ON UPDATE CASCADE,
+		issued_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+		expires_at TIMESTAMPTZ NOT NULL,
+		used_at    TIMESTAMPTZ,
+		revoked_at TIMESTAMPTZ
+	);
+	CREATE INDEX refresh_token_family_idx ON refresh_token (family_id);
+	CREATE INDEX refresh_token_user_idx ON refresh_token (user_email);`,
+
+	// 20: одноразовые токены действий со ссылками из писем (подтверждение email и т.п.)
+	`CREATE TABLE action_token (
+		jti        VARCHAR(64) PRIMARY KEY,
+		user_email VARCHAR(255) NOT NULL REFERENCES users (email) ON DELETE CASCADE ON UPDATE CASCADE,
+		purpose    VARCHAR(32) NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		expires_at TIMESTAMPTZ NOT NULL,
+		used_at    TIMESTAMPTZ
+	);
+	CREATE INDEX action_token_user_idx ON action_token (user_email, purpose);`,
+
+	// 21: неудачные попытки входа и срок блокировки аккаунта; пустой срок - до разблокировки администратором
+	`ALTER TABLE users ADD COLUMN locked_until TIMESTAMPTZ;
+	CREATE TABLE failed_login (
+		id           BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		email        VARCHAR(255) NOT NULL,
+		ip           VARCHAR(64) NOT NULL,
+		attempted_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+	CREATE INDEX failed_login_email_idx ON failed_login (email, attempted_at);
+	CREATE INDEX failed_login_ip_idx ON failed_login (ip, attempted_at);
+	CREATE INDEX failed_login_time_idx ON failed_login (attempted_at);`,
+
+	// 22: время последней смены пароля для ограничения срока его действия.
+	// Существующим пользователям срок отсчитывается с момента миграции.
+	`ALTER TABLE users ADD COLUMN password_changed_at TIMESTAMPTZ NOT NULL DEFAULT now();`,
+
+	// 23: время подтверждения email при регистрации. Пустое - регистрация еще не подтверждена;
+	// отключенный администратором аккаунт с подтвержденным email ссылкой из письма не активируется.
+	// Подтвержденными считаются все, кроме неактивных аккаунтов с неиспользованной ссылкой подтверждения.
+	`ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMPTZ;
+	UPDATE users u SET email_verified_at = now()
+	WHERE u.enabled OR NOT EXISTS (
+		SELECT 1 FROM action_token t WHERE t.user_email = u.email AND t.purpose = 'verify_email' AND t.used_at IS NULL
+	);`,
+}
+
+// Migrate применяет к базе данных все еще не примененные миграции
+func Migrate(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migration (
+		version    INT PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return fmt.Errorf("ошибка при создании таблицы миграций: %v", err)
+	}
+
+	for i, migration := range migrations {
+		version := i + 1
+
+		var applied bool
+		err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM schema_migration WHERE version = $1)`, version).Scan(&applied)
+		if err != nil {
+			return fmt.Errorf("ошибка при проверке миграции %d: %v", version, err)
+		}
+		if applied {
+			continue
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("не удалось начать транзакцию для миграции %d: %v", version, err)
+		}
+		if _, err := tx.Exec(migration); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("ошибка при применении миграции %d: %v", version, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migration (version) VALUES ($1)`, version); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("ошибка при сохранении миграции %d: %v", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("не удалось подтвердить миграцию %d: %v", version, err)
+		}
+
+		log.Printf("Применена миграция %d", version)
+	}
+
+	return nil
+}
@@ -0,0 +1,372 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ограничения разбора календаря
+const maxLineLength = 1 << 20 // Максимальная длина строки содержимого в байтах
+
+var (
+	ErrInvalidCalendar = errors.New("некорректный файл iCalendar")
+	ErrInvalidEvent    = errors.New("некорректное событие")
+)
+
+// property - строка содержимого вида NAME;PARAM=VALUE:VALUE
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// Decode разбирает календарь в формате RFC 5545 и возвращает его события VEVENT.
+// Время без часового пояса интерпретируется в зоне X-WR-TIMEZONE, а если она не указана - в loc.
+// Параметр TZID с неизвестной зоной (например, имена зон Windows из Outlook) тоже заменяется этой зоной.
+// Ошибки отдельных событий не прерывают разбор и сохраняются в Event.Err.
+func Decode(r io.Reader, loc *time.Location) (*Calendar, error) {
+	lines, err := unfoldLines(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 || !strings.EqualFold(lines[0], "BEGIN:VCALENDAR") {
+		return nil, fmt.Errorf("%w: ожидается BEGIN:VCALENDAR", ErrInvalidCalendar)
+	}
+
+	calendar := &Calendar{}
+	var stack []string
+	var eventProps []property
+	var rawEvents [][]property
+
+	for _, line := range lines {
+		prop, err := parseProperty(line)
+		if err != nil {
+			return nil, err
+		}
+
+		switch prop.name {
+		case "BEGIN":
+			component := strings.ToUpper(prop.value)
+			if component == "VEVENT" && len(stack) == 1 {
+				eventProps = nil
+			}
+			stack = append(stack, component)
+			continue
+		case "END":
+			component := strings.ToUpper(prop.value)
+			if len(stack) == 0 || stack[len(stack)-1] != component {
+				return nil, fmt.Errorf("%w: неожиданный END:%s", ErrInvalidCalendar, prop.value)
+			}
+			stack = stack[:len(stack)-1]
+			if component == "VEVENT" && len(stack) == 1 {
+				rawEvents = append(rawEvents, eventProps)
+			}
+			continue
+		}
+
+		switch {
+		case len(stack) == 1:
+			switch prop.name {
+			case "X-WR-CALNAME":
+				calendar.Name = unescapeText(prop.value)
+			case "X-WR-TIMEZONE":
+				if zone, err := time.LoadLocation(prop.value); err == nil {
+					loc = zone
+				}
+			}
+		case len(stack) == 2 && stack[1] == "VEVENT":
+			// Свойства вложенных компонентов (VALARM) игнорируются
+			eventProps = append(eventProps, prop)
+		}
+	}
+	if len(stack) != 0 {
+		return nil, fmt.Errorf("%w: не закрыт компонент %s", ErrInvalidCalendar, stack[len(stack)-1])
+	}
+
+	for _, props := range rawEvents {
+		calendar.Events = append(calendar.Events, buildEvent(props, loc))
+	}
+
+	return calendar, nil
+}
+
+// unfoldLines читает строки содержимого, склеивая перенесенные строки
+func unfoldLines(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCalendar, err)
+	}
+
+	// Пропускаем BOM, который добавляют некоторые редакторы
+	if len(lines) > 0 {
+		lines[0] = strings.TrimPrefix(lines[0], "\ufeff")
+	}
+
+	return lines, nil
+}
+
+// parseProperty разбирает строку содержимого. Значения параметров в кавычках могут содержать ':' и ';'.
+func parseProperty(line string) (property, error) {
+	inQuotes := false
+	colon := -1
+	for i := 0; i < len(line) && colon < 0; i++ {
+		switch line[i] {
+		case '"':
+			inQuotes = !inQuotes
+		case ':':
+			if !inQuotes {
+				colon = i
+			}
+		}
+	}
+	if colon <= 0 {
+		return property{}, fmt.Errorf("%w: строка без значения: %.40s", ErrInvalidCalendar, line)
+	}
+
+	prop := property{value: line[colon+1:], params: map[string]string{}}
+	parts := splitUnquoted(line[:colon], ';')
+	prop.name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		key, val, _ := strings.Cut(param, "=")
+		prop.params[strings.ToUpper(key)] = strings.Trim(val, `"`)
+	}
+
+	return prop, nil
+}
+
+// splitUnquoted разбивает строку по разделителю, не учитывая разделители внутри кавычек
+func splitUnquoted(value string, sep byte) []string {
+	var parts []string
+	inQuotes := false
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '"':
+			inQuotes = !inQuotes
+		case value[i] == sep && !inQuotes:
+			parts = append(parts, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, value[start:])
+}
+
+// buildEvent собирает событие из свойств VEVENT
+func buildEvent(props []property, loc *time.Location) Event {
+	var event Event
+	var end time.Time
+	var duration time.Duration
+	var hasStart, hasEnd, hasDuration bool
+
+	fail := func(prop property, err error) {
+		if event.Err == nil {
+			event.Err = fmt.Errorf("%w: %s: %v", ErrInvalidEvent, prop.name, err)
+		}
+	}
+
+	for _, prop := range props {
+		switch prop.name {
+		case "UID":
+			event.UID = prop.value
+		case "SUMMARY":
+			event.Summary = unescapeText(prop.value)
+		case "LOCATION":
+			event.Location = unescapeText(prop.value)
+		case "DESCRIPTION":
+			event.Description = unescapeText(prop.value)
+		case "STATUS":
+			event.Status = strings.ToUpper(prop.value)
+		case "ORGANIZER":
+			value := prop.value
+			if len(value) >= 7 && strings.EqualFold(value[:7], "mailto:") {
+				value = value[7:]
+			}
+			event.Organizer = strings.TrimSpace(value)
+		case "DTSTART":
+			start, allDay, err := parseTimeProperty(prop, loc)
+			if err != nil {
+				fail(prop, err)
+				continue
+			}
+			event.Start, event.AllDay, hasStart = start, allDay, true
+		case "DTEND":
+			value, _, err := parseTimeProperty(prop, loc)
+			if err != nil {
+				fail(prop, err)
+				continue
+			}
+			end, hasEnd = value, true
+		case "DURATION":
+			value, err := parseDuration(prop.value)
+			if err != nil {
+				fail(prop, err)
+				continue
+			}
+			duration, hasDuration = value, true
+		case "RRULE":
+			event.RRule = prop.value
+		case "EXDATE":
+			for _, value := range strings.Split(prop.value, ",") {
+				exdate, _, err := parseTimeProperty(property{name: prop.name, params: prop.params, value: value}, loc)
+				if err != nil {
+					fail(prop, err)
+					break
+				}
+				event.ExDates = append(event.ExDates, exdate)
+			}
+		case "RECURRENCE-ID":
+			value, _, err := parseTimeProperty(prop, loc)
+			if err != nil {
+				fail(prop, err)
+				continue
+			}
+			event.RecurrenceID = value
+		case "LAST-MODIFIED":
+			if value, err := ParseICalTime(prop.value, time.UTC); err == nil {
+				event.LastModified = value
+			}
+		}
+	}
+
+	switch {
+	case event.UID == "":
+		fail(property{name: "UID"}, errors.New("не указан идентификатор события"))
+	case !hasStart:
+		fail(property{name: "DTSTART"}, errors.New("не указано начало события"))
+	}
+
+	// Если окончание не указано, событие на весь день длится сутки, а остальные - ноль секунд (RFC 5545, 3.6.1)
+	switch {
+	case hasEnd:
+		event.End = end
+	case hasDuration:
+		event.End = event.Start.Add(duration)
+	case event.AllDay:
+		event.End = event.Start.AddDate(0, 0, 1)
+	default:
+		event.End = event.Start
+	}
+
+	return event
+}
+
+// parseTimeProperty разбирает значение DATE-TIME или DATE с учетом параметров TZID и VALUE
+func parseTimeProperty(prop property, loc *time.Location) (time.Time, bool, error) {
+	if tzid := prop.params["TZID"]; tzid != "" {
+		if zone, err := time.LoadLocation(tzid); err == nil {
+			loc = zone
+		}
+	}
+
+	value := strings.TrimSpace(prop.value)
+	allDay := strings.EqualFold(prop.params["VALUE"], "DATE") || len(value) == len(icalDateLayout)
+	t, err := ParseICalTime(value, loc)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("некорректное время %q", value)
+	}
+
+	return t, allDay, nil
+}
+
+// parseDuration разбирает значение типа DURATION, например "PT1H30M", "P1D" или "-PT15M"
+func parseDuration(value string) (time.Duration, error) {
+	invalid := fmt.Errorf("некорректная длительность %q", value)
+
+	sign := time.Duration(1)
+	switch {
+	case strings.HasPrefix(value, "-"):
+		sign, value = -1, value[1:]
+	case strings.HasPrefix(value, "+"):
+		value = value[1:]
+	}
+	if len(value) < 2 || value[0] != 'P' {
+		return 0, invalid
+	}
+
+	var total time.Duration
+	inTime := false
+	number := ""
+	for _, c := range value[1:] {
+		if c >= '0' && c <= '9' {
+			number += string(c)
+			continue
+		}
+		if c == 'T' {
+			if inTime || number != "" {
+				return 0, invalid
+			}
+			inTime = true
+			continue
+		}
+		if number == "" {
+			return 0, invalid
+		}
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			return 0, invalid
+		}
+		number = ""
+
+		var unit time.Duration
+		switch {
+		case c == 'W' && !inTime:
+			unit = 7 * 24 * time.Hour
+		case c == 'D' && !inTime:
+			unit = 24 * time.Hour
+		case c == 'H' && inTime:
+			unit = time.Hour
+		case c == 'M' && inTime:
+			unit = time.Minute
+		case c == 'S' && inTime:
+			unit = time.Second
+		default:
+			return 0, invalid
+		}
+		total += time.Duration(n) * unit
+	}
+	if number != "" {
+		return 0, invalid
+	}
+
+	return sign * total, nil
+}
+
+// unescapeText снимает экранирование значения типа TEXT
+func unescapeText(value string) string {
+	replacer := strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+	return replacer.Replace(value)
+}
+
+// Instances возвращает начала экземпляров события. Для повторяющегося события правило RRULE
+// разворачивается в интервале [from, to) с учетом исключений EXDATE,
+// для обычного события возвращается его начало независимо от интервала.
+func (e *Event) Instances(from, to time.Time) ([]time.Time, error) {
+	if e.RRule == "" {
+		return []time.Time{e.Start}, nil
+	}
+
+	rule, err := parseRule(e.RRule)
+	if err != nil {
+		return nil, err
+	}
+	return rule.Between(e.Start, e.ExDates, from, to)
+}
@@ -0,0 +1,115 @@
+package ical
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testCalendar = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:weekly\r\n" +
+	"DTSTART;TZID=Europe/Berlin:20260302T100000\r\n" +
+	"DTEND;TZID=Europe/Berlin:20260302T110000\r\n" +
+	"RRULE:FREQ=WEEKLY;BYDAY=MO\r\n" +
+	"EXDATE;TZID=Europe/Berlin:20260309T100000\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:windows-zone\r\n" +
+	"DTSTART;TZID=W. Europe Standard Time:20260304T090000\r\n" +
+	"DURATION:PT30M\r\n" +
+	"RRULE:FREQ=DAILY;COUNT=2\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:single\r\n" +
+	"DTSTART:20260410T080000Z\r\n" +
+	"DTEND:20260410T090000Z\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:hourly\r\n" +
+	"DTSTART:20260302T080000Z\r\n" +
+	"RRULE:FREQ=HOURLY;COUNT=3\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestEventInstances(t *testing.T) {
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+	moscow := mustLoadLocation(t, "Europe/Moscow")
+	from := time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, time.March, 24, 0, 0, 0, 0, time.UTC)
+
+	calendar, err := Decode(strings.NewReader(testCalendar), moscow)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	events := make(map[string]Event, len(calendar.Events))
+	for _, event := range calendar.Events {
+		events[event.UID] = event
+	}
+
+	tests := []struct {
+		uid     string
+		want    []time.Time
+		wantErr error
+	}{
+		{
+			// Бессрочное правило разворачивается только внутри интервала, исключенное повторение пропускается
+			uid: "weekly",
+			want: []time.Time{
+				time.Date(2026, time.March, 2, 10, 0, 0, 0, berlin),
+				time.Date(2026, time.March, 16, 10, 0, 0, 0, berlin),
+				time.Date(2026, time.March, 23, 10, 0, 0, 0, berlin),
+			},
+		},
+		{
+			// Неизвестная зона TZID заменяется зоной календаря
+			uid: "windows-zone",
+			want: []time.Time{
+				time.Date(2026, time.March, 4, 9, 0, 0, 0, moscow),
+				time.Date(2026, time.March, 5, 9, 0, 0, 0, moscow),
+			},
+		},
+		{
+			// Обычное событие возвращается независимо от интервала
+			uid:  "single",
+			want: []time.Time{time.Date(2026, time.April, 10, 8, 0, 0, 0, time.UTC)},
+		},
+		{
+			uid:     "hourly",
+			wantErr: ErrInvalidRule,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.uid, func(t *testing.T) {
+			event, ok := events[tt.uid]
+			if !ok {
+				t.Fatalf("event %q not decoded", tt.uid)
+			}
+			if event.Err != nil {
+				t.Fatalf("event error = %v", event.Err)
+			}
+
+			got, err := event.Instances(from, to)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Instances() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Instances() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Instances() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].Equal(tt.want[i]) {
+					t.Errorf("instance %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
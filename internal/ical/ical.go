@@ -0,0 +1,104 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ContentType - MIME-тип календаря iCalendar
+const ContentType = "text/calendar; charset=utf-8"
+
+// Event - событие VEVENT
+type Event struct {
+	UID          string    // Уникальный идентификатор события
+	Start        time.Time // DTSTART
+	End          time.Time // DTEND
+	Summary      string    // Заголовок события
+	Location     string    // Место проведения
+	Description  string    // Описание
+	Status       string    // CONFIRMED, TENTATIVE или CANCELLED
+	LastModified time.Time // Время последнего изменения, необязательно
+
+	// Поля ниже заполняются только при разборе календаря и не выводятся в Encode
+	Organizer    string      // Email организатора из ORGANIZER
+	AllDay       bool        // Событие на весь день (DTSTART со значением DATE)
+	RRule        string      // Правило повторения без префикса RRULE:
+	ExDates      []time.Time // Исключенные повторения
+	RecurrenceID time.Time   // Начало повторения, которое заменяет это событие
+	Err          error       // Ошибка разбора события; такое событие нужно пропустить
+}
+
+// Calendar - календарь VCALENDAR со списком событий
+type Calendar struct {
+	Name   string  // Название календаря для клиентов (X-WR-CALNAME)
+	Events []Event // События календаря
+}
+
+// Encode сериализует календарь в формат RFC 5545
+func (c *Calendar) Encode() []byte {
+	var buf bytes.Buffer
+	now := time.Now().UTC().Format(icalUTCLayout)
+
+	writeLine(&buf, "BEGIN:VCALENDAR")
+	writeLine(&buf, "VERSION:2.0")
+	writeLine(&buf, "PRODID:-//book_talk//Room bookings//RU")
+	writeLine(&buf, "CALSCALE:GREGORIAN")
+	writeLine(&buf, "METHOD:PUBLISH")
+	if c.Name != "" {
+		writeLine(&buf, "X-WR-CALNAME:"+escapeText(c.Name))
+	}
+
+	for _, event := range c.Events {
+		writeLine(&buf, "BEGIN:VEVENT")
+		writeLine(&buf, "UID:"+escapeText(event.UID))
+		writeLine(&buf, "DTSTAMP:"+now)
+		writeLine(&buf, "DTSTART:"+event.Start.UTC().Format(icalUTCLayout))
+		writeLine(&buf, "DTEND:"+event.End.UTC().Format(icalUTCLayout))
+		if event.Summary != "" {
+			writeLine(&buf, "SUMMARY:"+escapeText(event.Summary))
+		}
+		if event.Location != "" {
+			writeLine(&buf, "LOCATION:"+escapeText(event.Location))
+		}
+		if event.Description != "" {
+			writeLine(&buf, "DESCRIPTION:"+escapeText(event.Description))
+		}
+		if event.Status != "" {
+			writeLine(&buf, "STATUS:"+event.Status)
+		}
+		if !event.LastModified.IsZero() {
+			writeLine(&buf, "LAST-MODIFIED:"+event.LastModified.UTC().Format(icalUTCLayout))
+		}
+		writeLine(&buf, "END:VEVENT")
+	}
+
+	writeLine(&buf, "END:VCALENDAR")
+	return buf.Bytes()
+}
+
+// escapeText экранирует значение типа TEXT
+func escapeText(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+	return replacer.Replace(value)
+}
+
+// writeLine записывает строку содержимого, перенося ее через каждые 75 октетов, как требует RFC 5545
+func writeLine(buf *bytes.Buffer, line string) {
+	// Продолжение строки начинается с пробела, который тоже входит в 75 октетов
+	limit := 75
+	for len(line) > limit {
+		// Не разрываем многобайтовые символы UTF-8
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		buf.WriteString(line[:cut])
+		buf.WriteString("\r\n ")
+		line = line[cut:]
+		limit = 74
+	}
+	buf.WriteString(line)
+	buf.WriteString("\r\n")
+}
@@ -0,0 +1,440 @@
+package ical
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ограничения разворачивания правил повторения
+const (
+	MaxOccurrences    = 366   // Максимальное число повторений в одной серии
+	maxRuleIterations = 10000 // Защита от правил, которые никогда не дают совпадений
+)
+
+var (
+	ErrInvalidRule   = errors.New("некорректное правило повторения")
+	ErrUnboundedRule = errors.New("правило повторения должно содержать COUNT или UNTIL")
+)
+
+// Frequency - частота повторения (FREQ из RFC 5545)
+type Frequency string
+
+const (
+	FrequencyDaily   Frequency = "DAILY"
+	FrequencyWeekly  Frequency = "WEEKLY"
+	FrequencyMonthly Frequency = "MONTHLY"
+	FrequencyYearly  Frequency = "YEARLY"
+)
+
+// WeekdayNum - день недели из BYDAY, для MONTHLY с необязательным порядковым номером (1MO, -1FR)
+type WeekdayNum struct {
+	Weekday time.Weekday
+	N       int
+}
+
+// Rule - правило повторения RRULE в подмножестве RFC 5545:
+// FREQ=DAILY|WEEKLY|MONTHLY|YEARLY, INTERVAL, COUNT, UNTIL, BYDAY, BYMONTHDAY.
+// Для FREQ=YEARLY поддерживается только повторение в тот же день года, что и dtstart.
+type Rule struct {
+	Freq       Frequency
+	Interval   int
+	Count      int
+	Until      time.Time
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+}
+
+var weekdayCodes = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+func weekdayCode(d time.Weekday) string {
+	return strings.ToUpper(d.String()[:2])
+}
+
+// ParseRule разбирает строку RRULE, например "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10".
+// Префикс "RRULE:" допускается. Правило без COUNT и UNTIL отклоняется.
+func ParseRule(value string) (*Rule, error) {
+	rule, err := parseRule(value)
+	if err != nil {
+		return nil, err
+	}
+	if rule.Count == 0 && rule.Until.IsZero() {
+		return nil, ErrUnboundedRule
+	}
+	return rule, nil
+}
+
+// parseRule разбирает строку RRULE, допуская бессрочные правила
+func parseRule(value string) (*Rule, error) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "RRULE:")
+	if value == "" {
+		return nil, ErrInvalidRule
+	}
+
+	rule := &Rule{Interval: 1}
+	for _, part := range strings.Split(value, ";") {
+		key, val, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidRule, part)
+		}
+
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			rule.Freq = Frequency(strings.ToUpper(val))
+			if rule.Freq != FrequencyDaily && rule.Freq != FrequencyWeekly && rule.Freq != FrequencyMonthly &&
+				rule.Freq != FrequencyYearly {
+				return nil, fmt.Errorf("%w: поддерживаются только FREQ=DAILY, WEEKLY, MONTHLY и YEARLY", ErrInvalidRule)
+			}
+		case "INTERVAL":
+			interval, err := strconv.Atoi(val)
+			if err != nil || interval <= 0 {
+				return nil, fmt.Errorf("%w: INTERVAL=%s", ErrInvalidRule, val)
+			}
+			rule.Interval = interval
+		case "COUNT":
+			count, err := strconv.Atoi(val)
+			if err != nil || count <= 0 {
+				return nil, fmt.Errorf("%w: COUNT=%s", ErrInvalidRule, val)
+			}
+			rule.Count = count
+		case "UNTIL":
+			until, err := ParseICalTime(val, time.UTC)
+			if err != nil {
+				return nil, fmt.Errorf("%w: UNTIL=%s", ErrInvalidRule, val)
+			}
+			rule.Until = until
+		case "BYDAY":
+			for _, code := range strings.Split(strings.ToUpper(val), ",") {
+				day, err := parseWeekdayNum(code)
+				if err != nil {
+					return nil, err
+				}
+				rule.ByDay = append(rule.ByDay, day)
+			}
+		case "BYMONTHDAY":
+			for _, dayStr := range strings.Split(val, ",") {
+				day, err := strconv.Atoi(dayStr)
+				if err != nil || day == 0 || day < -31 || day > 31 {
+					return nil, fmt.Errorf("%w: BYMONTHDAY=%s", ErrInvalidRule, val)
+				}
+				rule.ByMonthDay = append(rule.ByMonthDay, day)
+			}
+		case "WKST":
+			if strings.ToUpper(val) != "MO" {
+				return nil, fmt.Errorf("%w: поддерживается только WKST=MO", ErrInvalidRule)
+			}
+		default:
+			return nil, fmt.Errorf("%w: неподдерживаемый параметр %s", ErrInvalidRule, key)
+		}
+	}
+
+	if rule.Freq == "" {
+		return nil, fmt.Errorf("%w: не указан FREQ", ErrInvalidRule)
+	}
+	if rule.Count > 0 && !rule.Until.IsZero() {
+		return nil, fmt.Errorf("%w: COUNT и UNTIL не могут использоваться вместе", ErrInvalidRule)
+	}
+	for _, day := range rule.ByDay {
+		if day.N != 0 && rule.Freq != FrequencyMonthly {
+			return nil, fmt.Errorf("%w: порядковый номер в BYDAY допустим только для FREQ=MONTHLY", ErrInvalidRule)
+		}
+	}
+	if len(rule.ByMonthDay) > 0 && rule.Freq == FrequencyWeekly {
+		return nil, fmt.Errorf("%w: BYMONTHDAY не допускается для FREQ=WEEKLY", ErrInvalidRule)
+	}
+	if (len(rule.ByDay) > 0 || len(rule.ByMonthDay) > 0) && rule.Freq == FrequencyYearly {
+		return nil, fmt.Errorf("%w: BYDAY и BYMONTHDAY не поддерживаются для FREQ=YEARLY", ErrInvalidRule)
+	}
+
+	return rule, nil
+}
+
+func parseWeekdayNum(code string) (WeekdayNum, error) {
+	code = strings.TrimSpace(code)
+	if len(code) < 2 {
+		return WeekdayNum{}, fmt.Errorf("%w: BYDAY=%s", ErrInvalidRule, code)
+	}
+
+	weekday, ok := weekdayCodes[code[len(code)-2:]]
+	if !ok {
+		return WeekdayNum{}, fmt.Errorf("%w: BYDAY=%s", ErrInvalidRule, code)
+	}
+
+	n := 0
+	if prefix := code[:len(code)-2]; prefix != "" {
+		var err error
+		n, err = strconv.Atoi(prefix)
+		if err != nil || n == 0 || n < -5 || n > 5 {
+			return WeekdayNum{}, fmt.Errorf("%w: BYDAY=%s", ErrInvalidRule, code)
+		}
+	}
+
+	return WeekdayNum{Weekday: weekday, N: n}, nil
+}
+
+// String возвращает правило в каноническом виде RRULE без префикса
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(icalUTCLayout))
+	}
+	if len(r.ByDay) > 0 {
+		codes := make([]string, len(r.ByDay))
+		for i, day := range r.ByDay {
+			codes[i] = weekdayCode(day.Weekday)
+			if day.N != 0 {
+				codes[i] = strconv.Itoa(day.N) + codes[i]
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(codes, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, day := range r.ByMonthDay {
+			days[i] = strconv.Itoa(day)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Occurrences разворачивает правило в список начал повторений.
+// Повторения сохраняют время суток dtstart в его часовом поясе; даты из exdates исключаются
+// после применения COUNT, как того требует RFC 5545.
+func (r *Rule) Occurrences(dtstart time.Time, exdates []time.Time) ([]time.Time, error) {
+	return r.Between(dtstart, exdates, time.Time{}, time.Time{})
+}
+
+// Between разворачивает правило так же, как Occurrences, но возвращает только повторения,
+// начинающиеся в интервале [from, to). Нулевые границы не ограничивают интервал,
+// поэтому бессрочное правило можно развернуть только с заданной границей to.
+func (r *Rule) Between(dtstart time.Time, exdates []time.Time, from, to time.Time) ([]time.Time, error) {
+	if r.Count == 0 && r.Until.IsZero() && to.IsZero() {
+		return nil, ErrUnboundedRule
+	}
+
+	excluded := make(map[int64]bool, len(exdates))
+	for _, exdate := range exdates {
+		excluded[exdate.Unix()] = true
+	}
+
+	// Без COUNT повторения до from не нужно пересчитывать, поэтому периоды до него пропускаются
+	first := 0
+	if r.Count == 0 && from.After(dtstart) {
+		first = r.periodsBefore(dtstart, from)
+	}
+
+	var occurrences []time.Time
+	generated := 0
+	for period := first; period < first+maxRuleIterations; period++ {
+		// Период, который начинается после UNTIL или to, уже не даст повторений
+		periodStart := r.periodStart(dtstart, period)
+		if (!r.Until.IsZero() && periodStart.After(r.Until)) || (!to.IsZero() && !periodStart.Before(to)) {
+			return occurrences, nil
+		}
+
+		for _, candidate := range r.candidates(dtstart, period) {
+			if candidate.Before(dtstart) {
+				continue
+			}
+			if !r.Until.IsZero() && candidate.After(r.Until) {
+				return occurrences, nil
+			}
+			if r.Count > 0 && generated >= r.Count {
+				return occurrences, nil
+			}
+			if !to.IsZero() && !candidate.Before(to) {
+				return occurrences, nil
+			}
+
+			generated++
+			if excluded[candidate.Unix()] || (!from.IsZero() && candidate.Before(from)) {
+				continue
+			}
+			occurrences = append(occurrences, candidate)
+			if len(occurrences) > MaxOccurrences {
+				return nil, fmt.Errorf("%w: серия не может содержать больше %d повторений", ErrInvalidRule, MaxOccurrences)
+			}
+		}
+	}
+
+	// Ни COUNT, ни UNTIL, ни to не достигнуты: обрезанный результат выдавал бы себя за полный
+	return nil, fmt.Errorf("%w: правило не удалось развернуть за %d периодов", ErrInvalidRule, maxRuleIterations)
+}
+
+// periodStart возвращает самое раннее время, с которого могут начинаться повторения периода с номером period
+func (r *Rule) periodStart(dtstart time.Time, period int) time.Time {
+	year, month, day := dtstart.Date()
+	loc := dtstart.Location()
+	switch r.Freq {
+	case FrequencyDaily:
+		return time.Date(year, month, day+period*r.Interval, 0, 0, 0, 0, loc)
+	case FrequencyWeekly:
+		offset := (int(dtstart.Weekday()) + 6) % 7
+		return time.Date(year, month, day-offset+period*r.Interval*7, 0, 0, 0, 0, loc)
+	case FrequencyMonthly:
+		return time.Date(year, month+time.Month(period*r.Interval), 1, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(year+period*r.Interval, time.January, 1, 0, 0, 0, 0, loc)
+	}
+}
+
+// periodsBefore возвращает число периодов от dtstart, все повторения которых заведомо раньше from
+func (r *Rule) periodsBefore(dtstart, from time.Time) int {
+	from = from.In(dtstart.Location())
+	var units int
+	switch r.Freq {
+	case FrequencyDaily:
+		units = int(from.Sub(dtstart).Hours() / 24)
+	case FrequencyWeekly:
+		units = int(from.Sub(dtstart).Hours()/24) / 7
+	case FrequencyMonthly:
+		units = (from.Year()-dtstart.Year())*12 + int(from.Month()-dtstart.Month())
+	default:
+		units = from.Year() - dtstart.Year()
+	}
+	// Запас в один период покрывает переходы на летнее время и неполные недели
+	if periods := units/r.Interval - 1; periods > 0 {
+		return periods
+	}
+	return 0
+}
+
+// candidates возвращает отсортированных кандидатов в повторения для периода с номером period
+func (r *Rule) candidates(dtstart time.Time, period int) []time.Time {
+	year, month, day := dtstart.Date()
+	hour, minute, second := dtstart.Clock()
+	loc := dtstart.Location()
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, hour, minute, second, 0, loc)
+	}
+
+	var result []time.Time
+	switch r.Freq {
+	case FrequencyDaily:
+		candidate := at(year, month, day+period*r.Interval)
+		if r.matchesWeekday(candidate) && r.matchesMonthDay(candidate) {
+			result = append(result, candidate)
+		}
+
+	case FrequencyWeekly:
+		// Неделя начинается с понедельника (WKST=MO)
+		offset := (int(dtstart.Weekday()) + 6) % 7
+		weekStart := at(year, month, day-offset+period*r.Interval*7)
+		if len(r.ByDay) == 0 {
+			result = append(result, weekStart.AddDate(0, 0, offset))
+			break
+		}
+		for i := 0; i < 7; i++ {
+			candidate := weekStart.AddDate(0, 0, i)
+			if r.matchesWeekday(candidate) {
+				result = append(result, candidate)
+			}
+		}
+
+	case FrequencyMonthly:
+		first := at(year, month+time.Month(period*r.Interval), 1)
+		daysInMonth := first.AddDate(0, 1, -1).Day()
+		for d := 1; d <= daysInMonth; d++ {
+			candidate := at(first.Year(), first.Month(), d)
+			switch {
+			case len(r.ByDay) == 0 && len(r.ByMonthDay) == 0:
+				if d == day {
+					result = append(result, candidate)
+				}
+			case len(r.ByDay) == 0:
+				if r.matchesMonthDay(candidate) {
+					result = append(result, candidate)
+				}
+			default:
+				if r.matchesMonthlyWeekday(candidate, daysInMonth) && r.matchesMonthDay(candidate) {
+					result = append(result, candidate)
+				}
+			}
+		}
+
+	case FrequencyYearly:
+		// Годы, в которых нет такого дня (29 февраля), пропускаются
+		candidate := at(year+period*r.Interval, month, day)
+		if candidate.Month() == month {
+			result = append(result, candidate)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Before(result[j]) })
+	return result
+}
+
+func (r *Rule) matchesWeekday(t time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, day := range r.ByDay {
+		if day.Weekday == t.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) matchesMonthDay(t time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	daysInMonth := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location()).Day()
+	for _, day := range r.ByMonthDay {
+		if day == t.Day() || (day < 0 && daysInMonth+day+1 == t.Day()) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesMonthlyWeekday проверяет BYDAY с порядковым номером внутри месяца (1MO - первый понедельник, -1FR - последняя пятница)
+func (r *Rule) matchesMonthlyWeekday(t time.Time, daysInMonth int) bool {
+	for _, day := range r.ByDay {
+		if day.Weekday != t.Weekday() {
+			continue
+		}
+		switch {
+		case day.N == 0:
+			return true
+		case day.N > 0 && (t.Day()-1)/7+1 == day.N:
+			return true
+		case day.N < 0 && (daysInMonth-t.Day())/7+1 == -day.N:
+			return true
+		}
+	}
+	return false
+}
+
+// Форматы даты и времени iCalendar
+const (
+	icalUTCLayout   = "20060102T150405Z"
+	icalLocalLayout = "20060102T150405"
+	icalDateLayout  = "20060102"
+)
+
+// ParseICalTime разбирает значение DATE-TIME или DATE из iCalendar.
+// Время без суффикса Z и даты интерпретируются в часовом поясе loc.
+func ParseICalTime(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(icalUTCLayout, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation(icalLocalLayout, value, loc); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(icalDateLayout, value, loc)
+}
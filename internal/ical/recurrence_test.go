@@ -0,0 +1,254 @@
+package ical
+
+import (
+	"errors"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string // Каноническая запись правила
+		wantErr error
+	}{
+		{value: "RRULE:FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10", want: "FREQ=WEEKLY;COUNT=10;BYDAY=MO,WE"},
+		{value: "freq=monthly;byday=-1fr;interval=2;until=20261231T235959Z", want: "FREQ=MONTHLY;INTERVAL=2;UNTIL=20261231T235959Z;BYDAY=-1FR"},
+		{value: "FREQ=MONTHLY;BYMONTHDAY=1,-1;COUNT=4;WKST=MO", want: "FREQ=MONTHLY;COUNT=4;BYMONTHDAY=1,-1"},
+		{value: "", wantErr: ErrInvalidRule},
+		{value: "FREQ=WEEKLY", wantErr: ErrUnboundedRule},
+		{value: "COUNT=3", wantErr: ErrInvalidRule},
+		{value: "FREQ=HOURLY;COUNT=3", wantErr: ErrInvalidRule},
+		{value: "FREQ=DAILY;INTERVAL=0;COUNT=3", wantErr: ErrInvalidRule},
+		{value: "FREQ=DAILY;COUNT=-1", wantErr: ErrInvalidRule},
+		{value: "FREQ=DAILY;COUNT=3;UNTIL=20261231T235959Z", wantErr: ErrInvalidRule},
+		{value: "FREQ=WEEKLY;BYDAY=1MO;COUNT=3", wantErr: ErrInvalidRule},
+		{value: "FREQ=MONTHLY;BYDAY=6MO;COUNT=3", wantErr: ErrInvalidRule},
+		{value: "FREQ=WEEKLY;BYMONTHDAY=1;COUNT=3", wantErr: ErrInvalidRule},
+		{value: "FREQ=YEARLY;BYDAY=MO;COUNT=3", wantErr: ErrInvalidRule},
+		{value: "FREQ=MONTHLY;BYMONTHDAY=32;COUNT=3", wantErr: ErrInvalidRule},
+		{value: "FREQ=DAILY;COUNT=3;WKST=SU", wantErr: ErrInvalidRule},
+		{value: "FREQ=DAILY;COUNT=3;BYHOUR=10", wantErr: ErrInvalidRule},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			rule, err := ParseRule(tt.value)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ParseRule() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRule() error = %v", err)
+			}
+			if got := rule.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleOccurrences(t *testing.T) {
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 10, 0, 0, 0, berlin)
+	}
+	monday := at(2026, time.March, 2)
+
+	tests := []struct {
+		name    string
+		rule    string
+		dtstart time.Time
+		exdates []time.Time
+		want    []time.Time
+	}{
+		{
+			name:    "daily",
+			rule:    "FREQ=DAILY;COUNT=3",
+			dtstart: monday,
+			want:    []time.Time{at(2026, time.March, 2), at(2026, time.March, 3), at(2026, time.March, 4)},
+		},
+		{
+			name:    "daily with interval",
+			rule:    "FREQ=DAILY;INTERVAL=2;COUNT=3",
+			dtstart: monday,
+			want:    []time.Time{at(2026, time.March, 2), at(2026, time.March, 4), at(2026, time.March, 6)},
+		},
+		{
+			name:    "daily on weekdays",
+			rule:    "FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR;COUNT=6",
+			dtstart: at(2026, time.March, 5),
+			want: []time.Time{at(2026, time.March, 5), at(2026, time.March, 6), at(2026, time.March, 9),
+				at(2026, time.March, 10), at(2026, time.March, 11), at(2026, time.March, 12)},
+		},
+		{
+			name:    "weekly on several days",
+			rule:    "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=4",
+			dtstart: monday,
+			want:    []time.Time{at(2026, time.March, 2), at(2026, time.March, 4), at(2026, time.March, 9), at(2026, time.March, 11)},
+		},
+		{
+			name:    "weekly keeps local time across DST",
+			rule:    "FREQ=WEEKLY;COUNT=3",
+			dtstart: at(2026, time.March, 23),
+			want:    []time.Time{at(2026, time.March, 23), at(2026, time.March, 30), at(2026, time.April, 6)},
+		},
+		{
+			name:    "biweekly until inclusive",
+			rule:    "FREQ=WEEKLY;INTERVAL=2;BYDAY=FR;UNTIL=20260320T090000Z",
+			dtstart: monday,
+			want:    []time.Time{at(2026, time.March, 6), at(2026, time.March, 20)},
+		},
+		{
+			name:    "monthly on the same day skips short months",
+			rule:    "FREQ=MONTHLY;COUNT=3",
+			dtstart: at(2026, time.January, 31),
+			want:    []time.Time{at(2026, time.January, 31), at(2026, time.March, 31), at(2026, time.May, 31)},
+		},
+		{
+			name:    "monthly on the first monday",
+			rule:    "FREQ=MONTHLY;BYDAY=1MO;COUNT=2",
+			dtstart: monday,
+			want:    []time.Time{at(2026, time.March, 2), at(2026, time.April, 6)},
+		},
+		{
+			name:    "monthly on the last friday",
+			rule:    "FREQ=MONTHLY;BYDAY=-1FR;COUNT=3",
+			dtstart: monday,
+			want:    []time.Time{at(2026, time.March, 27), at(2026, time.April, 24), at(2026, time.May, 29)},
+		},
+		{
+			name:    "monthly on the last day",
+			rule:    "FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=3",
+			dtstart: monday,
+			want:    []time.Time{at(2026, time.March, 31), at(2026, time.April, 30), at(2026, time.May, 31)},
+		},
+		{
+			name:    "yearly on february 29",
+			rule:    "FREQ=YEARLY;COUNT=2",
+			dtstart: at(2028, time.February, 29),
+			want:    []time.Time{at(2028, time.February, 29), at(2032, time.February, 29)},
+		},
+		{
+			name:    "exdate after count",
+			rule:    "FREQ=WEEKLY;BYDAY=MO;COUNT=3",
+			dtstart: monday,
+			exdates: []time.Time{at(2026, time.March, 9).UTC()},
+			want:    []time.Time{at(2026, time.March, 2), at(2026, time.March, 16)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := ParseRule(tt.rule)
+			if err != nil {
+				t.Fatalf("ParseRule() error = %v", err)
+			}
+			got, err := rule.Occurrences(tt.dtstart, tt.exdates)
+			if err != nil {
+				t.Fatalf("Occurrences() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Occurrences() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].Equal(tt.want[i]) {
+					t.Errorf("occurrence %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRuleOccurrencesLimit(t *testing.T) {
+	rule, err := ParseRule("FREQ=DAILY;COUNT=400")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rule.Occurrences(time.Date(2026, time.March, 2, 10, 0, 0, 0, time.UTC), nil); !errors.Is(err, ErrInvalidRule) {
+		t.Errorf("Occurrences() error = %v, want %v", err, ErrInvalidRule)
+	}
+}
+
+func TestRuleBetween(t *testing.T) {
+	dtstart := time.Date(2026, time.March, 2, 10, 0, 0, 0, time.UTC)
+	rule, err := parseRule("FREQ=WEEKLY;BYDAY=MO")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := rule.Occurrences(dtstart, nil); !errors.Is(err, ErrUnboundedRule) {
+		t.Fatalf("Occurrences() of an unbounded rule error = %v, want %v", err, ErrUnboundedRule)
+	}
+
+	from := time.Date(2026, time.March, 9, 10, 0, 0, 0, time.UTC)
+	to := time.Date(2026, time.March, 23, 10, 0, 0, 0, time.UTC)
+	got, err := rule.Between(dtstart, nil, from, to)
+	if err != nil {
+		t.Fatalf("Between() error = %v", err)
+	}
+	want := []time.Time{from, from.AddDate(0, 0, 7)}
+	if len(got) != len(want) || !got[0].Equal(want[0]) || !got[1].Equal(want[1]) {
+		t.Errorf("Between() = %v, want %v", got, want)
+	}
+}
+
+func TestRuleBetweenLongAgo(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    string
+		dtstart time.Time
+		want    int // Повторений в окне
+	}{
+		{name: "daily", rule: "FREQ=DAILY", dtstart: time.Date(1990, time.January, 1, 9, 0, 0, 0, time.UTC), want: 14},
+		{name: "weekly", rule: "FREQ=WEEKLY;BYDAY=MO,TH", dtstart: time.Date(1970, time.January, 5, 9, 0, 0, 0, time.UTC), want: 4},
+		{name: "monthly", rule: "FREQ=MONTHLY;BYMONTHDAY=10", dtstart: time.Date(1900, time.January, 10, 9, 0, 0, 0, time.UTC), want: 1},
+		{name: "daily until", rule: "FREQ=DAILY;UNTIL=20260305T235959Z", dtstart: time.Date(1990, time.January, 1, 9, 0, 0, 0, time.UTC), want: 4},
+	}
+
+	from := time.Date(2026, time.March, 2, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 14)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := parseRule(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := rule.Between(tt.dtstart, nil, from, to)
+			if err != nil {
+				t.Fatalf("Between() error = %v", err)
+			}
+			if len(got) != tt.want {
+				t.Fatalf("Between() = %v, want %d occurrences", got, tt.want)
+			}
+			for _, occurrence := range got {
+				if occurrence.Before(from) || !occurrence.Before(to) || occurrence.Hour() != 9 {
+					t.Errorf("occurrence %v outside [%v, %v) or at the wrong time", occurrence, from, to)
+				}
+			}
+		})
+	}
+}
+
+func TestRuleWithoutMatchesFails(t *testing.T) {
+	// Тридцатое число никогда не бывает пятой с конца пятницей месяца
+	rule, err := ParseRule("FREQ=MONTHLY;BYDAY=-5FR;BYMONTHDAY=30;COUNT=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rule.Occurrences(time.Date(2026, time.March, 2, 10, 0, 0, 0, time.UTC), nil); !errors.Is(err, ErrInvalidRule) {
+		t.Errorf("Occurrences() error = %v, want %v", err, ErrInvalidRule)
+	}
+}
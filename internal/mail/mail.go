@@ -0,0 +1,104 @@
+package mail
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Message - письмо пользователю
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender отправляет письма. Реализация выбирается при запуске: SMTP или хранение в памяти процесса.
+type Sender interface {
+	Send(msg Message) error
+}
+
+// SMTPSender отправляет письма через SMTP-сервер с авторизацией PLAIN
+type SMTPSender struct {
+	Addr     string // Адрес сервера в формате host:port
+	Username string
+	Password string
+	From     string // Адрес отправителя
+}
+
+func (s *SMTPSender) Send(msg Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return fmt.Errorf("некорректный адрес SMTP-сервера: %v", err)
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	// Переводы строк в заголовках позволили бы подставить в письмо чужие заголовки
+	subject := strings.NewReplacer("\r", " ", "\n", " ").Replace(msg.Subject)
+	body := "From: " + s.From + "\r\n" +
+		"To: " + msg.To + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + msg.Body
+	if err := smtp.SendMail(s.Addr, auth, s.From, []string{msg.To}, []byte(body)); err != nil {
+		return fmt.Errorf("не удалось отправить письмо: %v", err)
+	}
+	return nil
+}
+
+// MemorySender сохраняет письма в памяти процесса вместо отправки. Используется при разработке и в тестах.
+// Письма содержат одноразовые ссылки и токены, поэтому в журнал попадают только получатель и тема.
+type MemorySender struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemorySender() *MemorySender {
+	return &MemorySender{}
+}
+
+func (s *MemorySender) Send(msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msg)
+	log.Printf("Письмо для %s не отправлено (SMTP не настроен): %s", msg.To, msg.Subject)
+	return nil
+}
+
+// Messages возвращает копию сохраненных писем в порядке отправки
+func (s *MemorySender) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// ErrSMTPNotConfigured - SMTP не настроен вне режима разработки
+var ErrSMTPNotConfigured = errors.New("SMTP не настроен: задайте SMTP_ADDR или APP_ENV=dev для хранения писем в памяти")
+
+// NewSenderFromEnv создает SMTPSender по переменным SMTP_ADDR, SMTP_USERNAME, SMTP_PASSWORD и MAIL_FROM.
+// Без SMTP_ADDR письма сохраняются в памяти только в режиме разработки (APP_ENV=dev),
+// иначе возвращается ErrSMTPNotConfigured: пользователи не получили бы ссылок из писем.
+func NewSenderFromEnv() (Sender, error) {
+	addr := os.Getenv("SMTP_ADDR")
+	if addr == "" {
+		if os.Getenv("APP_ENV") != "dev" {
+			return nil, ErrSMTPNotConfigured
+		}
+		return NewMemorySender(), nil
+	}
+	return &SMTPSender{
+		Addr:     addr,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("MAIL_FROM"),
+	}, nil
+}
@@ -0,0 +1,64 @@
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestNewSenderFromEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		smtpAddr string
+		appEnv   string
+		want     Sender
+		wantErr  error
+	}{
+		{name: "smtp configured", smtpAddr: "smtp.example.com:587", want: &SMTPSender{}},
+		{name: "dev without smtp", appEnv: "dev", want: &MemorySender{}},
+		{name: "production without smtp", appEnv: "prod", wantErr: ErrSMTPNotConfigured},
+		{name: "no environment", wantErr: ErrSMTPNotConfigured},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SMTP_ADDR", tt.smtpAddr)
+			t.Setenv("APP_ENV", tt.appEnv)
+
+			sender, err := NewSenderFromEnv()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NewSenderFromEnv() error = %v, want %v", err, tt.wantErr)
+			}
+			switch tt.want.(type) {
+			case *SMTPSender:
+				if _, ok := sender.(*SMTPSender); !ok {
+					t.Errorf("NewSenderFromEnv() = %T, want *SMTPSender", sender)
+				}
+			case *MemorySender:
+				if _, ok := sender.(*MemorySender); !ok {
+					t.Errorf("NewSenderFromEnv() = %T, want *MemorySender", sender)
+				}
+			}
+		})
+	}
+}
+
+func TestMemorySenderDoesNotLogBody(t *testing.T) {
+	var buf bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&buf)
+
+	const secret = "secret-token"
+	sender := NewMemorySender()
+	if err := sender.Send(Message{To: "user@example.com", Subject: "Сброс пароля", Body: "token " + secret}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), secret) {
+		t.Errorf("log contains the message body: %q", buf.String())
+	}
+	if messages := sender.Messages(); len(messages) != 1 || messages[0].Body != "token "+secret {
+		t.Errorf("Messages() = %v, want the sent message", messages)
+	}
+}
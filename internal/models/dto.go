@@ -10,6 +10,7 @@ type UserDTO struct {
 	Department            *Department    `json:"department,omitempty"`  // Департамент, может быть nil
 	Image                 sql.NullString `json:"image,omitempty"`       // Изображение, может быть nil
 	Theme                 string         `json:"theme"`                 // Тема оформления
+	TimeZone              string         `json:"timeZone"`              // Часовой пояс IANA для отображения времени
 	Bookings              []Booking      `json:"bookings"`              // Список бронирований
 	Roles                 []Role         `json:"roles"`                 // Роли пользователя
 	CredentialsNonExpired bool           `json:"credentialsNonExpired"` // Флаг, указывающий, что учетные данные не истекли
@@ -32,6 +33,7 @@ func UserToUserResponse(user UserDTO) UserResponse {
 		Department:            user.Department,
 		Image:                 image,
 		Theme:                 user.Theme,
+		TimeZone:              user.TimeZone,
 		Bookings:              user.Bookings,
 		Roles:                 user.Roles,
 		CredentialsNonExpired: user.CredentialsNonExpired,
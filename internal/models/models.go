@@ -23,14 +23,100 @@ type Address struct {
 	City     string `json:"city"`     // City of the address
 	Street   string `json:"street"`   // Street name of the address
 	Building string `json:"building"` // Specific building or structure at the address
+	TimeZone string `json:"timeZone"` // IANA time zone of the address, e.g. "Europe/Moscow"; empty means the server zone
 }
 
 // Booking represents a room booking with details about the room, user, and time of booking.
 type Booking struct {
-	ID   int     `json:"id"`   // Unique identifier for the booking
-	Room Room    `json:"room"` // Room being booked (reference to Room struct)
-	User UserDTO `json:"user"` // User who made the booking (reference to UserDTO struct)
-	Time string  `json:"time"` // Booking time in "YYYY-MM-DDTHH:MM:SSZ" format
+	ID    int       `json:"id"`    // Unique identifier for the booking
+	Room  Room      `json:"room"`  // Room being booked (reference to Room struct)
+	User  UserDTO   `json:"user"`  // User who owns the booking (reference to UserDTO struct)
+	Time  string    `json:"time"`  // Booking time in "YYYY-MM-DDTHH:MM:SSZ" format (legacy, equals Start in UTC for new bookings)
+	Start time.Time `json:"start"` // Start of the booked interval (inclusive), rendered in the room's time zone by default
+	End   time.Time `json:"end"`   // End of the booked interval (exclusive)
+
+	CreatedBy *UserDTO `json:"createdBy,omitempty"` // User who created the booking, e.g. a delegate acting for the owner (nullable for legacy bookings)
+
+	Status      string     `json:"status"`                // Booking status, see BookingStatus* constants
+	CheckedInAt *time.Time `json:"checkedInAt,omitempty"` // When the owner checked in (nullable)
+
+	ApprovalExpiresAt *time.Time `json:"approvalExpiresAt,omitempty"` // Deadline for the decision on a pending booking (nullable)
+	SeriesID          *int       `json:"seriesId,omitempty"`          // Recurring series the booking belongs to (nullable)
+	RecurrenceID      *time.Time `json:"recurrenceId,omitempty"`      // Original start of the occurrence within the series (nullable)
+
+	Attendees []Attendee `json:"attendees"` // Invited people besides the owner
+}
+
+// InLocation renders the booking's instants in the given time zone. The instants themselves do not change.
+func (b *Booking) InLocation(loc *time.Location) {
+	b.Start, b.End = b.Start.In(loc), b.End.In(loc)
+	if b.CheckedInAt != nil {
+		checkedInAt := b.CheckedInAt.In(loc)
+		b.CheckedInAt = &checkedInAt
+	}
+	if b.ApprovalExpiresAt != nil {
+		expiresAt := b.ApprovalExpiresAt.In(loc)
+		b.ApprovalExpiresAt = &expiresAt
+	}
+}
+
+// Attendee represents a person invited to a booking: a registered user or an external guest.
+type Attendee struct {
+	Email     string `json:"email,omitempty"`     // Email of the user or the guest (optional for guests)
+	FirstName string `json:"firstName,omitempty"` // First name of a registered user
+	LastName  string `json:"lastName,omitempty"`  // Last name of a registered user
+	Name      string `json:"name,omitempty"`      // Free-text name of an external guest
+	Guest     bool   `json:"guest"`               // The attendee is not a registered user
+}
+
+// Booking statuses
+const (
+	BookingStatusActive    = "ACTIVE"    // The booking holds the room
+	BookingStatusCancelled = "CANCELLED" // The booking was cancelled and no longer holds the room
+	BookingStatusNoShow    = "NO_SHOW"   // Nobody checked in within the grace period, the room was released
+	BookingStatusOffered   = "OFFERED"   // The slot is held for a waitlisted user until they accept the offer
+	BookingStatusPending   = "PENDING"   // The booking waits for approval and tentatively holds the room
+	BookingStatusRejected  = "REJECTED"  // An approver rejected the booking
+	BookingStatusExpired   = "EXPIRED"   // Nobody decided on the pending booking in time
+)
+
+// ReleasedBookingStatuses lists statuses of bookings that no longer hold the room
+var ReleasedBookingStatuses = []string{BookingStatusCancelled, BookingStatusNoShow, BookingStatusRejected, BookingStatusExpired}
+
+// BookingHistoryEntry represents a single change of a booking together with its state after the change
+type BookingHistoryEntry struct {
+	ID        int       `json:"id"`                // Unique identifier for the entry
+	Action    string    `json:"action"`            // created, updated, cancelled, checked_in, no_show, approved, rejected or expired
+	ChangedBy string    `json:"changedBy"`         // Email of the user who made the change
+	ChangedAt time.Time `json:"changedAt"`         // When the change was made
+	RoomID    int       `json:"roomId"`            // Room after the change
+	Start     time.Time `json:"start"`             // Start of the interval after the change
+	End       time.Time `json:"end"`               // End of the interval after the change
+	Status    string    `json:"status"`            // Booking status after the change
+	Comment   string    `json:"comment,omitempty"` // Optional comment, e.g. the cancellation reason
+}
+
+// BookingSeries represents a recurring booking defined by an RFC 5545 recurrence rule.
+type BookingSeries struct {
+	ID       int         `json:"id"`       // Unique identifier for the series
+	Room     Room        `json:"room"`     // Room being booked (reference to Room struct)
+	User     UserDTO     `json:"user"`     // User who owns the series (reference to UserDTO struct)
+	RRule    string      `json:"rrule"`    // Recurrence rule, e.g. "FREQ=WEEKLY;BYDAY=MO;COUNT=10"
+	Start    time.Time   `json:"start"`    // Start of the first occurrence (DTSTART)
+	End      time.Time   `json:"end"`      // End of the first occurrence, defines the duration of every occurrence
+	ExDates  []time.Time `json:"exDates"`  // Excluded occurrence starts (EXDATE)
+	Bookings []Booking   `json:"bookings"` // Bookings created for the occurrences
+}
+
+// Closure represents a holiday or an office closure. A closure without an address and a room applies to all rooms,
+// with an address - to every room at that address, with a room - to that room only.
+type Closure struct {
+	ID        int    `json:"id"`                  // Unique identifier for the closure
+	Name      string `json:"name"`                // Holiday or closure reason, e.g. "New Year"
+	StartDate string `json:"startDate"`           // First closed day in "YYYY-MM-DD" format
+	EndDate   string `json:"endDate"`             // Last closed day in "YYYY-MM-DD" format (inclusive)
+	AddressID *int   `json:"addressId,omitempty"` // Closed address (building), nullable
+	RoomID    *int   `json:"roomId,omitempty"`    // Closed room, nullable
 }
 
 // Department represents a department with a list of associated users and other details.
@@ -55,9 +141,66 @@ type Room struct {
 	Capacity  int            `json:"capacity"`  // Maximum capacity of the room
 	Name      string         `json:"name"`      // Name of the room
 	Address   Address        `json:"address"`   // The address of the room (reference to Address struct)
-	ImagePath string         `json:"imagePath"` // Path to an image of the room
+	ImagePath string         `json:"imagePath"` // Path to the cover image of the room
 	Weekdays  []time.Weekday `json:"weekdays"`  // List of weekdays when the room is available
 	Active    bool           `json:"active"`    // Indicates if the room is currently active
+
+	ApprovalRequired bool        `json:"approvalRequired"`  // New bookings must be approved before they become active
+	Images           []RoomImage `json:"images"`            // Photos of the room, the cover first
+	Policy           RoomPolicy  `json:"policy"`            // Booking rules of the room
+	Amenities        []Amenity   `json:"amenities"`         // Equipment and facilities of the room
+	Floor            *Floor      `json:"floor,omitempty"`   // Floor of the building the room is on (nullable)
+	Section          *Section    `json:"section,omitempty"` // Section or zone of the floor (nullable)
+}
+
+// Floor represents a floor of a building (address).
+type Floor struct {
+	ID        int    `json:"id"`        // Unique identifier for the floor
+	AddressID int    `json:"addressId"` // Building the floor belongs to
+	Level     int    `json:"level"`     // Floor number used for ordering, may be negative for basements
+	Name      string `json:"name"`      // Display name, e.g. "3rd floor"
+}
+
+// Section represents a section or zone of a floor, e.g. a wing or an open space.
+type Section struct {
+	ID      int    `json:"id"`      // Unique identifier for the section
+	FloorID int    `json:"floorId"` // Floor the section belongs to
+	Name    string `json:"name"`    // Display name, e.g. "West wing"
+}
+
+// Amenity represents an entry of the equipment and facilities catalog, e.g. a projector or wheelchair access.
+type Amenity struct {
+	ID   int    `json:"id"`   // Unique identifier for the amenity
+	Code string `json:"code"` // Stable code used in search filters, e.g. "PROJECTOR"
+	Name string `json:"name"` // Human-readable name
+}
+
+// RoomPolicy holds per-room booking rules. Zero values mean no restriction.
+type RoomPolicy struct {
+	MinDurationMinutes   int `json:"minDurationMinutes"`   // Minimum booking length
+	MaxDurationMinutes   int `json:"maxDurationMinutes"`   // Maximum booking length
+	GranularityMinutes   int `json:"granularityMinutes"`   // Start and end must fall on this step counted from midnight
+	SetupBufferMinutes   int `json:"setupBufferMinutes"`   // Free time kept before each booking
+	CleanupBufferMinutes int `json:"cleanupBufferMinutes"` // Free time kept after each booking
+	HorizonDays          int `json:"horizonDays"`          // How many days ahead a booking may start
+}
+
+// RoomImage represents an uploaded photo of a room together with its resized copies.
+type RoomImage struct {
+	ID          int       `json:"id"`          // Unique identifier for the image
+	RoomID      int       `json:"roomId"`      // The room shown in the photo
+	ContentType string    `json:"contentType"` // MIME type of all sizes: image/jpeg or image/png
+	Width       int       `json:"width"`       // Width of the original in pixels
+	Height      int       `json:"height"`      // Height of the original in pixels
+	Cover       bool      `json:"cover"`       // The image represents the room in lists
+	CreatedAt   time.Time `json:"createdAt"`   // When the image was uploaded
+}
+
+// RoomApprover designates who may approve bookings of a room: holders of a role authority or members of a department.
+// Exactly one of the fields is set.
+type RoomApprover struct {
+	Authority    string `json:"authority,omitempty"`    // Role authority, e.g. ROLE_ADMIN
+	DepartmentID int    `json:"departmentId,omitempty"` // Department whose members may approve
 }
 
 // LocalTime represents a specific time with hour, minute, and second components.
@@ -77,6 +220,12 @@ type Weekday struct {
 	Active    bool   `json:"active"`    // Indicates if the room is available on this day
 }
 
+// TimeSlot represents a free interval of a room.
+type TimeSlot struct {
+	Start time.Time `json:"start"` // Start of the free interval (inclusive)
+	End   time.Time `json:"end"`   // End of the free interval (exclusive)
+}
+
 // ShortUserResponse is a simplified version of a user response, typically used in smaller data sets or summaries.
 type ShortUserResponse struct {
 	Email     string `json:"email"`     // User's email address
@@ -92,6 +241,7 @@ type UserResponse struct {
 	Department            *Department `json:"department"`            // Department the user belongs to (nullable)
 	Image                 *string     `json:"image"`                 // Optional image URL (nullable)
 	Theme                 string      `json:"theme"`                 // User's theme preference (e.g., light or dark mode)
+	TimeZone              string      `json:"timeZone"`              // IANA time zone for rendering times; empty means the room's zone
 	Bookings              []Booking   `json:"bookings"`              // List of bookings made by the user
 	Roles                 []Role      `json:"roles"`                 // List of roles assigned to the user
 	CredentialsNonExpired bool        `json:"credentialsNonExpired"` // Whether the user's credentials are expired
@@ -1 +1,38 @@
 package roles
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// AuthorityAdmin - роль администратора, которой разрешено управлять справочниками
+const AuthorityAdmin = "ROLE_ADMIN"
+
+type Service struct {
+	DB *sql.DB
+}
+
+func NewRolesService(db *sql.DB) *Service {
+	return &Service{DB: db}
+}
+
+// HasAuthority проверяет, назначена ли пользователю роль с указанными полномочиями
+func (s *Service) HasAuthority(email, authority string) (bool, error) {
+	var exists bool
+	err := s.DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM role r
+			WHERE r.authority = $2
+			  AND (r.user_email = $1 OR r.id IN (SELECT role_id FROM user_role WHERE user_email = $1))
+		)
+	`, email, authority).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("ошибка при проверке ролей пользователя: %v", err)
+	}
+	return exists, nil
+}
+
+// IsAdmin проверяет, является ли пользователь администратором
+func (s *Service) IsAdmin(email string) (bool, error) {
+	return s.HasAuthority(email, AuthorityAdmin)
+}
@@ -0,0 +1,184 @@
+package rooms
+
+import (
+	"book_talk/internal/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrAmenityNotFound = errors.New("оборудование не найдено")
+	ErrInvalidAmenity  = errors.New("у оборудования должны быть код из латинских букв, цифр и подчеркиваний и название")
+	ErrAmenityExists   = errors.New("оборудование с таким кодом уже есть")
+)
+
+// amenityCode - допустимый код оборудования после приведения к верхнему регистру
+var amenityCode = regexp.MustCompile(`^[A-Z0-9_]{1,64}$`)
+
+// normalizeAmenityCode приводит код оборудования к каноническому виду: без пробелов по краям, в верхнем регистре
+func normalizeAmenityCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// GetAmenities возвращает справочник оборудования, отсортированный по названию
+func (s *Service) GetAmenities() ([]models.Amenity, error) {
+	rows, err := s.DB.Query(`SELECT id, code, name FROM amenity ORDER BY name, id`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении оборудования: %v", err)
+	}
+	defer rows.Close()
+
+	amenities := []models.Amenity{}
+	for rows.Next() {
+		var amenity models.Amenity
+		if err := rows.Scan(&amenity.ID, &amenity.Code, &amenity.Name); err != nil {
+			return nil, fmt.Errorf("ошибка при обработке оборудования: %v", err)
+		}
+		amenities = append(amenities, amenity)
+	}
+
+	return amenities, rows.Err()
+}
+
+func validateAmenity(amenity *models.Amenity) error {
+	amenity.Code = normalizeAmenityCode(amenity.Code)
+	amenity.Name = strings.TrimSpace(amenity.Name)
+	if !amenityCode.MatchString(amenity.Code) || amenity.Name == "" {
+		return ErrInvalidAmenity
+	}
+	return nil
+}
+
+// CreateAmenity добавляет оборудование в справочник
+func (s *Service) CreateAmenity(amenity models.Amenity) (*models.Amenity, error) {
+	if err := validateAmenity(&amenity); err != nil {
+		return nil, err
+	}
+
+	err := s.DB.QueryRow(`INSERT INTO amenity (code, name) VALUES ($1, $2) RETURNING id`, amenity.Code, amenity.Name).Scan(&amenity.ID)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" { // unique_violation
+			return nil, ErrAmenityExists
+		}
+		return nil, fmt.Errorf("не удалось сохранить оборудование: %v", err)
+	}
+	return &amenity, nil
+}
+
+// UpdateAmenity изменяет код и название оборудования
+func (s *Service) UpdateAmenity(id int, amenity models.Amenity) (*models.Amenity, error) {
+	if err := validateAmenity(&amenity); err != nil {
+		return nil, err
+	}
+
+	err := s.DB.QueryRow(`UPDATE amenity SET code = $1, name = $2 WHERE id = $3 RETURNING id`,
+		amenity.Code, amenity.Name, id).Scan(&amenity.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAmenityNotFound
+		}
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" { // unique_violation
+			return nil, ErrAmenityExists
+		}
+		return nil, fmt.Errorf("не удалось обновить оборудование: %v", err)
+	}
+	return &amenity, nil
+}
+
+// DeleteAmenity удаляет оборудование из справочника и из всех комнат
+func (s *Service) DeleteAmenity(id int) error {
+	result, err := s.DB.Exec(`DELETE FROM amenity WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("не удалось удалить оборудование: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrAmenityNotFound
+	}
+	return nil
+}
+
+// SetRoomAmenities заменяет оборудование комнаты на оборудование из справочника с указанными идентификаторами
+func (s *Service) SetRoomAmenities(roomID int, amenityIDs []int) ([]models.Amenity, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM room WHERE id = $1)`, roomID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("ошибка при получении комнаты: %v", err)
+	}
+	if !exists {
+		return nil, ErrRoomNotFound
+	}
+
+	if _, err := tx.Exec(`DELETE FROM room_amenity WHERE room_id = $1`, roomID); err != nil {
+		return nil, fmt.Errorf("не удалось удалить оборудование комнаты: %v", err)
+	}
+	for _, amenityID := range amenityIDs {
+		_, err := tx.Exec(`INSERT INTO room_amenity (room_id, amenity_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, roomID, amenityID)
+		if err != nil {
+			var pqErr *pq.Error
+			if errors.As(err, &pqErr) && pqErr.Code == "23503" { // foreign_key_violation
+				return nil, fmt.Errorf("%w: %d", ErrAmenityNotFound, amenityID)
+			}
+			return nil, fmt.Errorf("не удалось сохранить оборудование комнаты: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+
+	room, err := s.GetRoom(roomID)
+	if err != nil {
+		return nil, err
+	}
+	return room.Amenities, nil
+}
+
+// loadAmenities заполняет оборудование комнат
+func (s *Service) loadAmenities(rooms []models.Room) error {
+	if len(rooms) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(rooms))
+	index := make(map[int]int, len(rooms))
+	for i, room := range rooms {
+		ids[i] = int64(room.ID)
+		index[room.ID] = i
+	}
+
+	rows, err := s.DB.Query(`
+		SELECT ra.room_id, a.id, a.code, a.name
+		FROM room_amenity ra
+		JOIN amenity a ON a.id = ra.amenity_id
+		WHERE ra.room_id = ANY($1)
+		ORDER BY a.name, a.id
+	`, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("ошибка при получении оборудования комнат: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var roomID int
+		var amenity models.Amenity
+		if err := rows.Scan(&roomID, &amenity.ID, &amenity.Code, &amenity.Name); err != nil {
+			return fmt.Errorf("ошибка при обработке оборудования комнаты: %v", err)
+		}
+		room := &rooms[index[roomID]]
+		room.Amenities = append(room.Amenities, amenity)
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,90 @@
+package rooms
+
+import (
+	"book_talk/internal/models"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrInvalidApprover    = errors.New("у согласующего должна быть указана либо роль, либо отдел")
+	ErrDepartmentNotFound = errors.New("отдел не найден")
+)
+
+// GetApprovers возвращает список согласующих бронирования комнаты
+func (s *Service) GetApprovers(roomID int) ([]models.RoomApprover, error) {
+	if _, err := s.GetRoom(roomID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.DB.Query(`
+		SELECT COALESCE(authority, ''), COALESCE(department_id, 0)
+		FROM room_approver
+		WHERE room_id = $1
+		ORDER BY id
+	`, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении согласующих комнаты: %v", err)
+	}
+	defer rows.Close()
+
+	approvers := []models.RoomApprover{}
+	for rows.Next() {
+		var approver models.RoomApprover
+		if err := rows.Scan(&approver.Authority, &approver.DepartmentID); err != nil {
+			return nil, fmt.Errorf("ошибка при обработке согласующих комнаты: %v", err)
+		}
+		approvers = append(approvers, approver)
+	}
+
+	return approvers, rows.Err()
+}
+
+// SetApprovers заменяет список согласующих бронирования комнаты
+func (s *Service) SetApprovers(roomID int, approvers []models.RoomApprover) ([]models.RoomApprover, error) {
+	for i := range approvers {
+		approvers[i].Authority = strings.TrimSpace(approvers[i].Authority)
+		if (approvers[i].Authority == "") == (approvers[i].DepartmentID == 0) {
+			return nil, ErrInvalidApprover
+		}
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM room WHERE id = $1)`, roomID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("ошибка при получении комнаты: %v", err)
+	}
+	if !exists {
+		return nil, ErrRoomNotFound
+	}
+
+	if _, err := tx.Exec(`DELETE FROM room_approver WHERE room_id = $1`, roomID); err != nil {
+		return nil, fmt.Errorf("не удалось удалить согласующих комнаты: %v", err)
+	}
+	for _, approver := range approvers {
+		_, err := tx.Exec(`
+			INSERT INTO room_approver (room_id, authority, department_id) VALUES ($1, NULLIF($2, ''), NULLIF($3, 0))
+		`, roomID, approver.Authority, approver.DepartmentID)
+		if err != nil {
+			var pqErr *pq.Error
+			if errors.As(err, &pqErr) && pqErr.Code == "23503" { // foreign_key_violation
+				return nil, ErrDepartmentNotFound
+			}
+			return nil, fmt.Errorf("не удалось сохранить согласующих комнаты: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+
+	return s.GetApprovers(roomID)
+}
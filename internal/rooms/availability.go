@@ -0,0 +1,257 @@
+package rooms
+
+import (
+	"book_talk/internal/models"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// MaxAvailabilityDays - максимальная длина периода, для которого рассчитывается доступность
+const MaxAvailabilityDays = 31
+
+var ErrInvalidRange = fmt.Errorf("некорректный период: дата окончания должна быть не раньше даты начала и не дальше %d дней от нее", MaxAvailabilityDays)
+
+// interval - полуоткрытый интервал времени [start, end)
+type interval struct {
+	start time.Time
+	end   time.Time
+}
+
+// openingHours - часы работы комнаты в один день недели, минуты от начала суток
+type openingHours struct {
+	day   time.Weekday
+	start int
+	end   int
+}
+
+// GetAvailability возвращает свободные интервалы комнаты с даты from по дату to включительно.
+// Даты и часы работы интерпретируются в часовом поясе комнаты, в нем же возвращаются интервалы.
+// Нулевая дата from означает сегодняшний день комнаты, нулевая to - неделю от from.
+// Свободное время - часы работы из таблицы weekday за вычетом праздников и закрытий, существующих бронирований
+// с их буферами и уже прошедшего времени.
+// Интервалы учитывают правила комнаты: границы выровнены по шагу, интервалы короче минимальной длительности
+// не возвращаются, а время за горизонтом бронирования отсекается.
+func (s *Service) GetAvailability(roomID int, from, to time.Time) ([]models.TimeSlot, error) {
+	room, err := s.GetRoom(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	loc := Location(*room)
+	now := time.Now()
+	if from.IsZero() {
+		from = now.In(loc)
+	}
+	from = dateIn(from, loc)
+	if to.IsZero() {
+		to = from.AddDate(0, 0, 6)
+	}
+	to = dateIn(to, loc)
+	if to.Before(from) || to.Sub(from) > MaxAvailabilityDays*24*time.Hour+time.Hour {
+		return nil, ErrInvalidRange
+	}
+
+	slots := []models.TimeSlot{}
+	if !room.Active {
+		return slots, nil
+	}
+
+	hours, err := s.getOpeningHours(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	closed, err := s.closedDays(roomID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	periodEnd := to.AddDate(0, 0, 1)
+	busy, err := s.getBusyIntervals(roomID, from, periodEnd, room.Policy)
+	if err != nil {
+		return nil, err
+	}
+
+	for day := from; day.Before(periodEnd); day = day.AddDate(0, 0, 1) {
+		if closed[day.Format(time.DateOnly)] {
+			continue
+		}
+
+		for _, free := range subtractIntervals(openingWindows(day, hours, now), busy) {
+			if slot, ok := fitPolicy(free, room.Policy, loc, now); ok {
+				slots = append(slots, models.TimeSlot{Start: slot.start.In(loc), End: slot.end.In(loc)})
+			}
+		}
+	}
+
+	return slots, nil
+}
+
+// openingWindows возвращает часы работы комнаты в день day без уже прошедшего времени.
+// Часы работы отсчитываются по местным часам дня, поэтому в день перехода на летнее или зимнее время
+// окно до конца суток становится короче или длиннее на час.
+func openingWindows(day time.Time, hours []openingHours, now time.Time) []interval {
+	var windows []interval
+	for _, h := range hours {
+		if h.day != day.Weekday() {
+			continue
+		}
+		window := interval{
+			start: atMinute(day, h.start),
+			end:   atMinute(day, h.end),
+		}
+		if window.start.Before(now) {
+			window.start = now.Truncate(time.Minute).In(day.Location())
+		}
+		if window.end.After(window.start) {
+			windows = append(windows, window)
+		}
+	}
+	return windows
+}
+
+// getOpeningHours читает активные часы работы комнаты из таблицы weekday
+func (s *Service) getOpeningHours(roomID int) ([]openingHours, error) {
+	rows, err := s.DB.Query(`
+		SELECT day, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI')
+		FROM weekday
+		WHERE room_id = $1 AND COALESCE(active, true)
+	`, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении расписания комнаты: %v", err)
+	}
+	defer rows.Close()
+
+	var hours []openingHours
+	for rows.Next() {
+		var day, start, end string
+		if err := rows.Scan(&day, &start, &end); err != nil {
+			return nil, fmt.Errorf("ошибка при обработке расписания комнаты: %v", err)
+		}
+
+		weekday, ok := parseWeekday(day)
+		if !ok {
+			continue
+		}
+		startMinutes, err := parseClock(start)
+		if err != nil {
+			return nil, err
+		}
+		endMinutes, err := parseClock(end)
+		if err != nil {
+			return nil, err
+		}
+		// Время окончания 00:00 означает работу до конца суток
+		if endMinutes == 0 {
+			endMinutes = 24 * 60
+		}
+		if endMinutes <= startMinutes {
+			continue
+		}
+
+		hours = append(hours, openingHours{day: weekday, start: startMinutes, end: endMinutes})
+	}
+
+	return hours, rows.Err()
+}
+
+// getBusyIntervals возвращает отсортированные интервалы, в которые нельзя начинать или продолжать новое бронирование.
+// Каждое бронирование занимает комнату вместе со своими буферами, а новому бронированию нужны собственные буферы,
+// поэтому занятый интервал дополнительно расширяется на буфер уборки перед ним и на буфер подготовки после него.
+func (s *Service) getBusyIntervals(roomID int, from, to time.Time, policy models.RoomPolicy) ([]interval, error) {
+	setup := time.Duration(policy.SetupBufferMinutes) * time.Minute
+	cleanup := time.Duration(policy.CleanupBufferMinutes) * time.Minute
+
+	rows, err := s.DB.Query(`
+		SELECT lower(blocked_period), upper(blocked_period)
+		FROM booking
+		WHERE room_id = $1 AND blocked_period && tstzrange($2, $3, '[)') AND status <> ALL($4)
+		ORDER BY lower(blocked_period)
+	`, roomID, from.Add(-setup), to.Add(cleanup), pq.Array(models.ReleasedBookingStatuses))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении бронирований комнаты: %v", err)
+	}
+	defer rows.Close()
+
+	var busy []interval
+	for rows.Next() {
+		var b interval
+		if err := rows.Scan(&b.start, &b.end); err != nil {
+			return nil, fmt.Errorf("ошибка при обработке бронирований комнаты: %v", err)
+		}
+		b.start, b.end = b.start.Add(-cleanup), b.end.Add(setup)
+		busy = append(busy, b)
+	}
+
+	return busy, rows.Err()
+}
+
+// fitPolicy приводит свободный интервал к правилам комнаты. Возвращает false, если в нем нельзя ничего забронировать.
+func fitPolicy(free interval, policy models.RoomPolicy, loc *time.Location, now time.Time) (interval, bool) {
+	if policy.HorizonDays > 0 {
+		if horizon := now.AddDate(0, 0, policy.HorizonDays); free.end.After(horizon) {
+			free.end = horizon
+		}
+	}
+	if policy.GranularityMinutes > 0 {
+		step := time.Duration(policy.GranularityMinutes) * time.Minute
+		free.start, free.end = alignUp(free.start, step, loc), alignDown(free.end, step, loc)
+	}
+	if !free.end.After(free.start) {
+		return free, false
+	}
+	if policy.MinDurationMinutes > 0 && free.end.Sub(free.start) < time.Duration(policy.MinDurationMinutes)*time.Minute {
+		return free, false
+	}
+	return free, true
+}
+
+// subtractIntervals вычитает из окон занятые интервалы. busy должен быть отсортирован по началу.
+func subtractIntervals(windows, busy []interval) []interval {
+	sort.Slice(windows, func(i, j int) bool { return windows[i].start.Before(windows[j].start) })
+
+	var free []interval
+	for _, window := range windows {
+		cursor := window.start
+		for _, b := range busy {
+			if !b.end.After(cursor) || !b.start.Before(window.end) {
+				continue
+			}
+			if b.start.After(cursor) {
+				free = append(free, interval{start: cursor, end: b.start})
+			}
+			cursor = b.end
+			if !cursor.Before(window.end) {
+				break
+			}
+		}
+		if cursor.Before(window.end) {
+			free = append(free, interval{start: cursor, end: window.end})
+		}
+	}
+
+	return free
+}
+
+// parseClock разбирает время в формате "HH:MM" в минуты от начала суток
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("некорректное время в расписании комнаты: %s", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// atMinute возвращает момент, отстоящий от начала суток day на указанное число минут по часам этого дня
+func atMinute(day time.Time, minutes int) time.Time {
+	year, month, d := day.Date()
+	return time.Date(year, month, d, 0, minutes, 0, 0, day.Location())
+}
+
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
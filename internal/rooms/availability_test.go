@@ -0,0 +1,215 @@
+package rooms
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func TestSubtractIntervals(t *testing.T) {
+	base := time.Date(2026, time.March, 2, 0, 0, 0, 0, time.UTC)
+	at := func(hour, minute int) time.Time {
+		return base.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+	}
+	span := func(fromHour, toHour int) interval { return interval{start: at(fromHour, 0), end: at(toHour, 0)} }
+
+	tests := []struct {
+		name    string
+		windows []interval
+		busy    []interval
+		want    []interval
+	}{
+		{name: "no windows", busy: []interval{span(9, 10)}},
+		{name: "no busy", windows: []interval{span(9, 18)}, want: []interval{span(9, 18)}},
+		{name: "busy before window", windows: []interval{span(9, 18)}, busy: []interval{span(7, 8)}, want: []interval{span(9, 18)}},
+		{name: "busy after window", windows: []interval{span(9, 18)}, busy: []interval{span(19, 20)}, want: []interval{span(9, 18)}},
+		{name: "busy ends at window start", windows: []interval{span(9, 18)}, busy: []interval{span(8, 9)}, want: []interval{span(9, 18)}},
+		{name: "busy starts at window end", windows: []interval{span(9, 18)}, busy: []interval{span(18, 19)}, want: []interval{span(9, 18)}},
+		{
+			name:    "touching busy intervals",
+			windows: []interval{span(9, 18)},
+			busy:    []interval{span(10, 11), span(11, 12)},
+			want:    []interval{span(9, 10), span(12, 18)},
+		},
+		{name: "busy nested in window", windows: []interval{span(9, 18)}, busy: []interval{span(12, 13)}, want: []interval{span(9, 12), span(13, 18)}},
+		{name: "window nested in busy", windows: []interval{span(9, 18)}, busy: []interval{span(8, 19)}},
+		{name: "busy equals window", windows: []interval{span(9, 18)}, busy: []interval{span(9, 18)}},
+		{name: "busy overlaps window start", windows: []interval{span(9, 18)}, busy: []interval{span(8, 10)}, want: []interval{span(10, 18)}},
+		{name: "busy overlaps window end", windows: []interval{span(9, 18)}, busy: []interval{span(17, 19)}, want: []interval{span(9, 17)}},
+		{
+			name:    "overlapping busy intervals",
+			windows: []interval{span(9, 18)},
+			busy:    []interval{span(10, 13), span(11, 12), span(12, 14)},
+			want:    []interval{span(9, 10), span(14, 18)},
+		},
+		{
+			name:    "busy spans two windows",
+			windows: []interval{span(14, 18), span(9, 12)},
+			busy:    []interval{span(11, 15)},
+			want:    []interval{span(9, 11), span(15, 18)},
+		},
+		{
+			name:    "minute precision",
+			windows: []interval{span(9, 10)},
+			busy:    []interval{{start: at(9, 15), end: at(9, 45)}},
+			want:    []interval{{start: at(9, 0), end: at(9, 15)}, {start: at(9, 45), end: at(10, 0)}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := subtractIntervals(tt.windows, tt.busy)
+			if len(got) != len(tt.want) {
+				t.Fatalf("subtractIntervals() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].start.Equal(tt.want[i].start) || !got[i].end.Equal(tt.want[i].end) {
+					t.Errorf("interval %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestOpeningWindowsAcrossDST(t *testing.T) {
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+	newYork := mustLoadLocation(t, "America/New_York")
+	allDay := func(day time.Weekday) []openingHours { return []openingHours{{day: day, start: 0, end: 24 * 60}} }
+	office := func(day time.Weekday) []openingHours { return []openingHours{{day: day, start: 9 * 60, end: 18 * 60}} }
+	longAgo := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		day       time.Time
+		hours     []openingHours
+		now       time.Time
+		wantStart string // Местное время начала окна
+		wantLen   time.Duration
+	}{
+		{
+			name:      "whole day before spring forward",
+			day:       time.Date(2026, time.March, 28, 0, 0, 0, 0, berlin),
+			hours:     allDay(time.Saturday),
+			now:       longAgo,
+			wantStart: "2026-03-28 00:00 +0100",
+			wantLen:   24 * time.Hour,
+		},
+		{
+			name:      "whole day of spring forward",
+			day:       time.Date(2026, time.March, 29, 0, 0, 0, 0, berlin),
+			hours:     allDay(time.Sunday),
+			now:       longAgo,
+			wantStart: "2026-03-29 00:00 +0100",
+			wantLen:   23 * time.Hour,
+		},
+		{
+			name:      "office hours on spring forward",
+			day:       time.Date(2026, time.March, 29, 0, 0, 0, 0, berlin),
+			hours:     office(time.Sunday),
+			now:       longAgo,
+			wantStart: "2026-03-29 09:00 +0200",
+			wantLen:   9 * time.Hour,
+		},
+		{
+			name:      "whole day of fall back",
+			day:       time.Date(2026, time.October, 25, 0, 0, 0, 0, berlin),
+			hours:     allDay(time.Sunday),
+			now:       longAgo,
+			wantStart: "2026-10-25 00:00 +0200",
+			wantLen:   25 * time.Hour,
+		},
+		{
+			name:      "office hours on fall back",
+			day:       time.Date(2026, time.October, 25, 0, 0, 0, 0, berlin),
+			hours:     office(time.Sunday),
+			now:       longAgo,
+			wantStart: "2026-10-25 09:00 +0100",
+			wantLen:   9 * time.Hour,
+		},
+		{
+			name:      "past part cut on spring forward",
+			day:       time.Date(2026, time.March, 29, 0, 0, 0, 0, berlin),
+			hours:     allDay(time.Sunday),
+			now:       time.Date(2026, time.March, 29, 1, 30, 20, 0, time.UTC), // 03:30 CEST
+			wantStart: "2026-03-29 03:30 +0200",
+			wantLen:   20*time.Hour + 30*time.Minute,
+		},
+		{
+			name:      "office hours on spring forward in another zone",
+			day:       time.Date(2026, time.March, 8, 0, 0, 0, 0, newYork),
+			hours:     office(time.Sunday),
+			now:       longAgo,
+			wantStart: "2026-03-08 09:00 -0400",
+			wantLen:   9 * time.Hour,
+		},
+		{
+			name:      "whole day of fall back in another zone",
+			day:       time.Date(2026, time.November, 1, 0, 0, 0, 0, newYork),
+			hours:     allDay(time.Sunday),
+			now:       longAgo,
+			wantStart: "2026-11-01 00:00 -0400",
+			wantLen:   25 * time.Hour,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := openingWindows(tt.day, tt.hours, tt.now)
+			if len(got) != 1 {
+				t.Fatalf("openingWindows() = %v, want one window", got)
+			}
+			if start := got[0].start.Format("2006-01-02 15:04 -0700"); start != tt.wantStart {
+				t.Errorf("window start = %s, want %s", start, tt.wantStart)
+			}
+			if length := got[0].end.Sub(got[0].start); length != tt.wantLen {
+				t.Errorf("window length = %v, want %v", length, tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestOpeningWindowsSkipsOtherDaysAndPast(t *testing.T) {
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+	day := time.Date(2026, time.March, 29, 0, 0, 0, 0, berlin)
+	hours := []openingHours{{day: time.Monday, start: 9 * 60, end: 18 * 60}, {day: time.Sunday, start: 9 * 60, end: 12 * 60}}
+
+	if got := openingWindows(day, hours, time.Date(2026, time.March, 29, 12, 0, 0, 0, berlin)); len(got) != 0 {
+		t.Errorf("openingWindows() after closing = %v, want none", got)
+	}
+	if got := openingWindows(day.AddDate(0, 0, 2), hours, day); len(got) != 0 {
+		t.Errorf("openingWindows() on a day without hours = %v, want none", got)
+	}
+}
+
+func TestAvailabilityDaysStayAtLocalMidnight(t *testing.T) {
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+	// Так же, как GetAvailability, перебираем дни периода от полуночи даты начала
+	from := dateIn(time.Date(2026, time.March, 27, 15, 0, 0, 0, time.UTC), berlin)
+	to := dateIn(time.Date(2026, time.March, 31, 0, 0, 0, 0, time.UTC), berlin)
+
+	var days []string
+	for day := from; day.Before(to.AddDate(0, 0, 1)); day = day.AddDate(0, 0, 1) {
+		if day.Hour() != 0 || day.Minute() != 0 {
+			t.Errorf("day %v does not start at local midnight", day)
+		}
+		days = append(days, day.Format(time.DateOnly))
+	}
+	want := []string{"2026-03-27", "2026-03-28", "2026-03-29", "2026-03-30", "2026-03-31"}
+	if len(days) != len(want) {
+		t.Fatalf("days = %v, want %v", days, want)
+	}
+	for i := range days {
+		if days[i] != want[i] {
+			t.Errorf("day %d = %s, want %s", i, days[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,433 @@
+package rooms
+
+import (
+	"book_talk/internal/ical"
+	"book_talk/internal/models"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Ограничения импорта закрытий
+const (
+	MaxClosureImportSize = 1 << 20 // Максимальный размер файла с праздниками
+	MaxImportClosures    = 1000    // Максимальное число закрытий в одном файле после разворачивания повторений
+)
+
+// Форматы файлов с праздниками
+const (
+	ClosureFormatCSV = "csv"
+	ClosureFormatICS = "ics"
+)
+
+var (
+	ErrClosureNotFound    = errors.New("закрытие не найдено")
+	ErrInvalidClosure     = errors.New("у закрытия должны быть название и даты в формате YYYY-MM-DD, окончание не раньше начала; можно указать либо адрес, либо комнату")
+	ErrClosureExists      = errors.New("закрытие с такими датами уже задано")
+	ErrInvalidClosureFile = errors.New("некорректный файл с праздниками")
+	ErrClosureImportLimit = fmt.Errorf("файл содержит больше %d закрытий", MaxImportClosures)
+	ErrRoomClosed         = errors.New("комната закрыта в это время")
+)
+
+// ClosureFilter описывает условия отбора закрытий
+type ClosureFilter struct {
+	From      time.Time // Закрытия, заканчивающиеся не раньше этой даты
+	To        time.Time // Закрытия, начинающиеся не позже этой даты
+	AddressID int       // Закрытия, действующие для адреса: общие и самого адреса
+	RoomID    int       // Закрытия, действующие для комнаты: общие, ее адреса и самой комнаты
+}
+
+// ClosureImportResult - отчет об импорте файла с праздниками
+type ClosureImportResult struct {
+	Created    int              `json:"created"`    // Число созданных закрытий
+	Duplicates int              `json:"duplicates"` // Число закрытий, которые уже были заданы
+	Closures   []models.Closure `json:"closures"`   // Созданные закрытия
+}
+
+const closureSelect = `SELECT c.id, c.name, c.start_date, c.end_date, c.address_id, c.room_id FROM closure c`
+
+func scanClosure(row rowScanner) (models.Closure, error) {
+	var closure models.Closure
+	var start, end time.Time
+	var addressID, roomID sql.NullInt64
+	if err := row.Scan(&closure.ID, &closure.Name, &start, &end, &addressID, &roomID); err != nil {
+		return closure, err
+	}
+	closure.StartDate, closure.EndDate = start.Format(time.DateOnly), end.Format(time.DateOnly)
+	if addressID.Valid {
+		id := int(addressID.Int64)
+		closure.AddressID = &id
+	}
+	if roomID.Valid {
+		id := int(roomID.Int64)
+		closure.RoomID = &id
+	}
+	return closure, nil
+}
+
+// closureAppliesTo - условие, при котором закрытие c действует для комнаты r
+const closureAppliesTo = `(c.room_id = r.id OR c.address_id = r.address_id OR (c.room_id IS NULL AND c.address_id IS NULL))`
+
+// GetClosures возвращает закрытия, отсортированные по дате начала
+func (s *Service) GetClosures(filter ClosureFilter) ([]models.Closure, error) {
+	var conditions []string
+	var args []interface{}
+
+	if !filter.From.IsZero() {
+		args = append(args, filter.From.Format(time.DateOnly))
+		conditions = append(conditions, fmt.Sprintf("c.end_date >= $%d", len(args)))
+	}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To.Format(time.DateOnly))
+		conditions = append(conditions, fmt.Sprintf("c.start_date <= $%d", len(args)))
+	}
+	if filter.RoomID != 0 {
+		args = append(args, filter.RoomID)
+		conditions = append(conditions, fmt.Sprintf(
+			"EXISTS (SELECT 1 FROM room r WHERE r.id = $%d AND %s)", len(args), closureAppliesTo))
+	} else if filter.AddressID != 0 {
+		args = append(args, filter.AddressID)
+		conditions = append(conditions, fmt.Sprintf(
+			"(c.address_id = $%[1]d OR (c.room_id IS NULL AND c.address_id IS NULL))", len(args)))
+	}
+
+	query := closureSelect
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	rows, err := s.DB.Query(query+" ORDER BY c.start_date, c.id", args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении закрытий: %v", err)
+	}
+	defer rows.Close()
+
+	closures := []models.Closure{}
+	for rows.Next() {
+		closure, err := scanClosure(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при обработке закрытий: %v", err)
+		}
+		closures = append(closures, closure)
+	}
+
+	return closures, rows.Err()
+}
+
+// validateClosure проверяет закрытие и приводит его название и даты к каноническому виду
+func validateClosure(closure *models.Closure) error {
+	closure.Name = strings.TrimSpace(closure.Name)
+	if closure.Name == "" || (closure.AddressID != nil && closure.RoomID != nil) {
+		return ErrInvalidClosure
+	}
+	start, err := time.Parse(time.DateOnly, closure.StartDate)
+	if err != nil {
+		return ErrInvalidClosure
+	}
+	end := start
+	if closure.EndDate != "" {
+		if end, err = time.Parse(time.DateOnly, closure.EndDate); err != nil {
+			return ErrInvalidClosure
+		}
+	}
+	if end.Before(start) {
+		return ErrInvalidClosure
+	}
+	closure.StartDate, closure.EndDate = start.Format(time.DateOnly), end.Format(time.DateOnly)
+	return nil
+}
+
+// insertClosure сохраняет закрытие. Возвращает false, если такое закрытие уже есть и skipDuplicate установлен.
+func insertClosure(tx *sql.Tx, closure *models.Closure, skipDuplicate bool) (bool, error) {
+	query := `
+		INSERT INTO closure (name, start_date, end_date, address_id, room_id) VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`
+	if skipDuplicate {
+		query = `
+		INSERT INTO closure (name, start_date, end_date, address_id, room_id) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT DO NOTHING
+		RETURNING id`
+	}
+
+	err := tx.QueryRow(query, closure.Name, closure.StartDate, closure.EndDate,
+		nullInt(closure.AddressID), nullInt(closure.RoomID)).Scan(&closure.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) {
+			switch {
+			case pqErr.Code == "23505": // unique_violation
+				return false, ErrClosureExists
+			case pqErr.Code == "23503" && strings.Contains(pqErr.Constraint, "address"): // foreign_key_violation
+				return false, ErrAddressNotFound
+			case pqErr.Code == "23503":
+				return false, ErrRoomNotFound
+			}
+		}
+		return false, fmt.Errorf("не удалось сохранить закрытие: %v", err)
+	}
+	return true, nil
+}
+
+func nullInt(value *int) sql.NullInt64 {
+	if value == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(*value), Valid: true}
+}
+
+// CreateClosure добавляет закрытие. Уже существующие бронирования на закрытые дни не отменяются.
+func (s *Service) CreateClosure(closure models.Closure) (*models.Closure, error) {
+	if err := validateClosure(&closure); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := insertClosure(tx, &closure, false); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+	return &closure, nil
+}
+
+// DeleteClosure удаляет закрытие
+func (s *Service) DeleteClosure(id int) error {
+	result, err := s.DB.Exec(`DELETE FROM closure WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("не удалось удалить закрытие: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrClosureNotFound
+	}
+	return nil
+}
+
+// ImportClosures создает закрытия из файла CSV или iCalendar для всех комнат, адреса или комнаты (target).
+// Строка CSV: дата начала, необязательная дата окончания и название; первая строка может быть заголовком.
+// Даты принимаются в форматах YYYY-MM-DD и DD.MM.YYYY. Из iCalendar берутся события на весь день,
+// ежегодные события разворачиваются на текущий и следующий год. Уже заданные закрытия пропускаются,
+// а ошибка в любой строке отменяет весь импорт.
+func (s *Service) ImportClosures(r io.Reader, format string, target models.Closure) (*ClosureImportResult, error) {
+	var closures []models.Closure
+	var err error
+	switch format {
+	case ClosureFormatCSV:
+		closures, err = parseClosuresCSV(r)
+	case ClosureFormatICS:
+		closures, err = parseClosuresICS(r, time.Now())
+	default:
+		return nil, fmt.Errorf("%w: поддерживаются форматы csv и ics", ErrInvalidClosureFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(closures) > MaxImportClosures {
+		return nil, ErrClosureImportLimit
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	result := &ClosureImportResult{Closures: []models.Closure{}}
+	for _, closure := range closures {
+		closure.AddressID, closure.RoomID = target.AddressID, target.RoomID
+		if err := validateClosure(&closure); err != nil {
+			return nil, fmt.Errorf("%w: %s", err, closure.Name)
+		}
+		created, err := insertClosure(tx, &closure, true)
+		if err != nil {
+			return nil, err
+		}
+		if !created {
+			result.Duplicates++
+			continue
+		}
+		result.Created++
+		result.Closures = append(result.Closures, closure)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+	return result, nil
+}
+
+// parseClosuresCSV разбирает строки "дата начала[,дата окончания],название"
+func parseClosuresCSV(r io.Reader) ([]models.Closure, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	var closures []models.Closure
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidClosureFile, err)
+		}
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+
+		start, ok := parseClosureDate(record[0])
+		if !ok {
+			// Первая строка, которая не начинается с даты, считается заголовком
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("%w: строка %d: некорректная дата %q", ErrInvalidClosureFile, line, record[0])
+		}
+
+		closure := models.Closure{StartDate: start.Format(time.DateOnly), EndDate: start.Format(time.DateOnly)}
+		switch len(record) {
+		case 2:
+			closure.Name = record[1]
+		case 3:
+			end, ok := parseClosureDate(record[1])
+			if !ok {
+				return nil, fmt.Errorf("%w: строка %d: некорректная дата %q", ErrInvalidClosureFile, line, record[1])
+			}
+			closure.EndDate, closure.Name = end.Format(time.DateOnly), record[2]
+		default:
+			return nil, fmt.Errorf("%w: строка %d: ожидается дата, необязательная дата окончания и название", ErrInvalidClosureFile, line)
+		}
+		if err := validateClosure(&closure); err != nil {
+			return nil, fmt.Errorf("%w: строка %d: %v", ErrInvalidClosureFile, line, err)
+		}
+		closures = append(closures, closure)
+		if len(closures) > MaxImportClosures {
+			return nil, ErrClosureImportLimit
+		}
+	}
+
+	return closures, nil
+}
+
+func parseClosureDate(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{time.DateOnly, "02.01.2006"} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseClosuresICS берет из календаря события на весь день. Повторяющиеся события разворачиваются
+// с начала текущего года до конца следующего, отмененные события и события со временем пропускаются.
+func parseClosuresICS(r io.Reader, now time.Time) ([]models.Closure, error) {
+	calendar, err := ical.Decode(r, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidClosureFile, err)
+	}
+
+	from := time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, time.Local)
+	to := from.AddDate(2, 0, 0)
+
+	var closures []models.Closure
+	for _, event := range calendar.Events {
+		if event.Err != nil || !event.AllDay || strings.EqualFold(event.Status, "CANCELLED") {
+			continue
+		}
+		name := strings.TrimSpace(event.Summary)
+		if name == "" {
+			name = "Выходной день"
+		}
+
+		// DTEND события на весь день - следующий за последним день
+		days := 1
+		if event.End.After(event.Start) {
+			days = int(event.End.Sub(event.Start).Hours()/24 + 0.5)
+		}
+		starts, err := event.Instances(from, to)
+		if err != nil {
+			continue
+		}
+		for _, start := range starts {
+			closures = append(closures, models.Closure{
+				Name:      name,
+				StartDate: start.Format(time.DateOnly),
+				EndDate:   start.AddDate(0, 0, days-1).Format(time.DateOnly),
+			})
+			if len(closures) > MaxImportClosures {
+				return nil, ErrClosureImportLimit
+			}
+		}
+	}
+
+	return closures, nil
+}
+
+// closedDays возвращает дни с from по to включительно, в которые комната закрыта, в формате YYYY-MM-DD
+func (s *Service) closedDays(roomID int, from, to time.Time) (map[string]bool, error) {
+	rows, err := s.DB.Query(`
+		SELECT c.start_date, c.end_date
+		FROM closure c, room r
+		WHERE r.id = $1 AND `+closureAppliesTo+` AND c.end_date >= $2 AND c.start_date <= $3
+	`, roomID, from.Format(time.DateOnly), to.Format(time.DateOnly))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении закрытий комнаты: %v", err)
+	}
+	defer rows.Close()
+
+	closed := map[string]bool{}
+	for rows.Next() {
+		var start, end time.Time
+		if err := rows.Scan(&start, &end); err != nil {
+			return nil, fmt.Errorf("ошибка при обработке закрытий комнаты: %v", err)
+		}
+		for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+			closed[day.Format(time.DateOnly)] = true
+		}
+	}
+
+	return closed, rows.Err()
+}
+
+// CheckClosedTx возвращает ErrRoomClosed, если интервал [start, end) задевает день, в который комната закрыта.
+// Дни определяются в часовом поясе комнаты loc.
+func CheckClosedTx(tx *sql.Tx, roomID int, loc *time.Location, start, end time.Time) error {
+	first, last := start.In(loc), end.Add(-time.Nanosecond).In(loc)
+
+	var name string
+	var closedFrom, closedTo time.Time
+	err := tx.QueryRow(`
+		SELECT c.name, c.start_date, c.end_date
+		FROM closure c, room r
+		WHERE r.id = $1 AND `+closureAppliesTo+` AND c.end_date >= $2 AND c.start_date <= $3
+		ORDER BY c.start_date
+		LIMIT 1
+	`, roomID, first.Format(time.DateOnly), last.Format(time.DateOnly)).Scan(&name, &closedFrom, &closedTo)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("ошибка при проверке закрытий комнаты: %v", err)
+	}
+
+	if closedFrom.Equal(closedTo) {
+		return fmt.Errorf("%w: %s, %s", ErrRoomClosed, name, closedFrom.Format("02.01.2006"))
+	}
+	return fmt.Errorf("%w: %s, %s - %s", ErrRoomClosed, name, closedFrom.Format("02.01.2006"), closedTo.Format("02.01.2006"))
+}
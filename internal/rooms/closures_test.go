@@ -0,0 +1,215 @@
+package rooms
+
+import (
+	"book_talk/internal/models"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// closureDates возвращает закрытия в виде "начало..окончание название" для сравнения
+func closureDates(closures []models.Closure) []string {
+	var dates []string
+	for _, closure := range closures {
+		dates = append(dates, closure.StartDate+".."+closure.EndDate+" "+closure.Name)
+	}
+	return dates
+}
+
+func assertClosures(t *testing.T, got []models.Closure, want []string) {
+	t.Helper()
+	dates := closureDates(got)
+	if len(dates) != len(want) {
+		t.Fatalf("closures = %q, want %q", dates, want)
+	}
+	for i := range dates {
+		if dates[i] != want[i] {
+			t.Errorf("closure %d = %q, want %q", i, dates[i], want[i])
+		}
+	}
+}
+
+// oversizedBody возвращает тело запроса больше MaxClosureImportSize, ограниченное так же, как в ImportClosures хэндлера
+func oversizedBody(prefix, filler, suffix string) io.Reader {
+	content := prefix + strings.Repeat(filler, MaxClosureImportSize/len(filler)+1) + suffix
+	return http.MaxBytesReader(httptest.NewRecorder(), io.NopCloser(strings.NewReader(content)), MaxClosureImportSize)
+}
+
+func TestParseClosuresCSV(t *testing.T) {
+	atLimit := make([]string, MaxImportClosures)
+	for i := range atLimit {
+		atLimit[i] = "2026-01-01..2026-01-01 Новый год"
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr error
+	}{
+		{
+			name:  "single days with header",
+			input: "date,name\n2026-01-01,Новый год\n08.03.2026, Женский день\n",
+			want:  []string{"2026-01-01..2026-01-01 Новый год", "2026-03-08..2026-03-08 Женский день"},
+		},
+		{
+			name:  "date range",
+			input: "2026-05-01,2026-05-03,Майские праздники\n30.12.2026,08.01.2027,Новогодние каникулы\n",
+			want:  []string{"2026-05-01..2026-05-03 Майские праздники", "2026-12-30..2027-01-08 Новогодние каникулы"},
+		},
+		{
+			name:  "comments and blank lines",
+			input: "# праздники\n\n2026-06-12,День России\n\n",
+			want:  []string{"2026-06-12..2026-06-12 День России"},
+		},
+		{name: "empty file"},
+		{name: "header only", input: "date,end,name\n"},
+		{name: "bad date after header", input: "date,name\n2026-02-30,Нет такого дня\n", wantErr: ErrInvalidClosureFile},
+		{name: "bad date on second line", input: "2026-01-01,Новый год\nзавтра,Выходной\n", wantErr: ErrInvalidClosureFile},
+		{name: "bad end date", input: "2026-05-01,3 мая,Майские праздники\n", wantErr: ErrInvalidClosureFile},
+		{name: "end before start", input: "2026-05-03,2026-05-01,Майские праздники\n", wantErr: ErrInvalidClosureFile},
+		{name: "date without name", input: "2026-01-01\n", wantErr: ErrInvalidClosureFile},
+		{name: "empty name", input: "2026-01-01, \n", wantErr: ErrInvalidClosureFile},
+		{name: "too many fields", input: "2026-01-01,2026-01-02,Новый год,лишнее\n", wantErr: ErrInvalidClosureFile},
+		{name: "unterminated quote", input: "2026-01-01,\"Новый год\n", wantErr: ErrInvalidClosureFile},
+		{name: "limit", input: strings.Repeat("2026-01-01,Новый год\n", MaxImportClosures), want: atLimit},
+		{name: "over limit", input: strings.Repeat("2026-01-01,Новый год\n", MaxImportClosures+1), wantErr: ErrClosureImportLimit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseClosuresCSV(strings.NewReader(tt.input))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("parseClosuresCSV() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseClosuresCSV() error = %v", err)
+			}
+			assertClosures(t, got, tt.want)
+		})
+	}
+}
+
+// icsCalendar оборачивает строки событий в календарь
+func icsCalendar(lines ...string) string {
+	return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n" + strings.Join(lines, "\r\n") + "\r\nEND:VCALENDAR\r\n"
+}
+
+// icsEvent возвращает строки события с указанными свойствами
+func icsEvent(uid string, props ...string) string {
+	return strings.Join(append(append([]string{"BEGIN:VEVENT", "UID:" + uid}, props...), "END:VEVENT"), "\r\n")
+}
+
+func TestParseClosuresICS(t *testing.T) {
+	now := time.Date(2026, time.June, 1, 12, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr error
+	}{
+		{
+			name:  "single day with exclusive end",
+			input: icsCalendar(icsEvent("1", "DTSTART;VALUE=DATE:20260612", "DTEND;VALUE=DATE:20260613", "SUMMARY:День России")),
+			want:  []string{"2026-06-12..2026-06-12 День России"},
+		},
+		{
+			name:  "single day without end",
+			input: icsCalendar(icsEvent("1", "DTSTART;VALUE=DATE:20260612", "SUMMARY:День России")),
+			want:  []string{"2026-06-12..2026-06-12 День России"},
+		},
+		{
+			name:  "several days with exclusive end",
+			input: icsCalendar(icsEvent("1", "DTSTART;VALUE=DATE:20260501", "DTEND;VALUE=DATE:20260504", "SUMMARY:Майские праздники")),
+			want:  []string{"2026-05-01..2026-05-03 Майские праздники"},
+		},
+		{
+			name:  "range across new year",
+			input: icsCalendar(icsEvent("1", "DTSTART;VALUE=DATE:20261231", "DTEND;VALUE=DATE:20270109", "SUMMARY:Каникулы")),
+			want:  []string{"2026-12-31..2027-01-08 Каникулы"},
+		},
+		{
+			name: "recurring yearly holiday",
+			input: icsCalendar(icsEvent("1", "DTSTART;VALUE=DATE:20000101", "DTEND;VALUE=DATE:20000103",
+				"RRULE:FREQ=YEARLY", "SUMMARY:Новый год")),
+			want: []string{"2026-01-01..2026-01-02 Новый год", "2027-01-01..2027-01-02 Новый год"},
+		},
+		{
+			name: "recurring holiday with exception",
+			input: icsCalendar(icsEvent("1", "DTSTART;VALUE=DATE:20240309", "RRULE:FREQ=YEARLY;UNTIL=20300101",
+				"EXDATE;VALUE=DATE:20260309", "SUMMARY:Перенос праздника")),
+			want: []string{"2027-03-09..2027-03-09 Перенос праздника"},
+		},
+		{
+			name: "timed, cancelled and untitled events",
+			input: icsCalendar(
+				icsEvent("1", "DTSTART:20260612T090000Z", "DTEND:20260612T100000Z", "SUMMARY:Совещание"),
+				icsEvent("2", "DTSTART;VALUE=DATE:20260704", "STATUS:CANCELLED", "SUMMARY:Отменен"),
+				icsEvent("3", "DTSTART;VALUE=DATE:20260705"),
+			),
+			want: []string{"2026-07-05..2026-07-05 Выходной день"},
+		},
+		{name: "not a calendar", input: "2026-01-01,Новый год\n", wantErr: ErrInvalidClosureFile},
+		{name: "unterminated event", input: "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTART;VALUE=DATE:20260101\r\n", wantErr: ErrInvalidClosureFile},
+		{
+			name: "over limit",
+			input: icsCalendar(
+				icsEvent("1", "DTSTART;VALUE=DATE:20260101", "RRULE:FREQ=DAILY;UNTIL=20261231", "SUMMARY:Каждый день"),
+				icsEvent("2", "DTSTART;VALUE=DATE:20260101", "RRULE:FREQ=DAILY;UNTIL=20261231", "SUMMARY:Снова каждый день"),
+				icsEvent("3", "DTSTART;VALUE=DATE:20260101", "RRULE:FREQ=DAILY;UNTIL=20261231", "SUMMARY:И еще раз"),
+			),
+			wantErr: ErrClosureImportLimit,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseClosuresICS(strings.NewReader(tt.input), now)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("parseClosuresICS() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseClosuresICS() error = %v", err)
+			}
+			assertClosures(t, got, tt.want)
+		})
+	}
+}
+
+func TestParseClosuresSizeLimit(t *testing.T) {
+	tests := []struct {
+		format string
+		body   io.Reader
+	}{
+		{format: ClosureFormatCSV, body: oversizedBody("2026-01-01,Новый год\n", "# комментарий\n", "")},
+		{format: ClosureFormatICS, body: oversizedBody("BEGIN:VCALENDAR\r\n", "X-FILLER:комментарий\r\n", "END:VCALENDAR\r\n")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var err error
+			switch tt.format {
+			case ClosureFormatCSV:
+				_, err = parseClosuresCSV(tt.body)
+			case ClosureFormatICS:
+				_, err = parseClosuresICS(tt.body, time.Now())
+			}
+			// Хэндлер отвечает 413 только если ошибка чтения сохранилась в цепочке
+			var maxBytesErr *http.MaxBytesError
+			if !errors.As(err, &maxBytesErr) || !errors.Is(err, ErrInvalidClosureFile) {
+				t.Fatalf("error = %v, want %v wrapping %T", err, ErrInvalidClosureFile, maxBytesErr)
+			}
+		})
+	}
+}
@@ -1 +1,719 @@
 package rooms
+
+import (
+	"book_talk/internal/models"
+	mw "book_talk/middleware"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	RoomService *Service
+}
+
+// Новый хэндлер для инициализации с сервисом
+func NewRoomsHandler(db *sql.DB) *Handler {
+	return &Handler{
+		RoomService: NewRoomsService(db),
+	}
+}
+
+// sendRoomError отправляет ответ с кодом, соответствующим ошибке сервиса
+func sendRoomError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrRoomNotFound), errors.Is(err, ErrAddressNotFound), errors.Is(err, ErrDepartmentNotFound),
+		errors.Is(err, ErrImageNotFound), errors.Is(err, ErrClosureNotFound), errors.Is(err, ErrAmenityNotFound):
+		mw.SendJSONResponse(w, &models.Response{Message: err.Error()}, http.StatusNotFound) // 404
+	case errors.Is(err, ErrInvalidRoom), errors.Is(err, ErrInvalidAddress), errors.Is(err, ErrInvalidRange),
+		errors.Is(err, ErrInvalidFreeTime), errors.Is(err, ErrInvalidClosure), errors.Is(err, ErrInvalidClosureFile),
+		errors.Is(err, ErrClosureImportLimit), errors.Is(err, ErrInvalidTimeZone), errors.Is(err, ErrInvalidAmenity),
+		errors.Is(err, ErrInvalidApprover), errors.Is(err, ErrInvalidPolicy), errors.Is(err, ErrUnsupportedImage), errors.Is(err, ErrInvalidImageSize):
+		mw.SendJSONResponse(w, &models.Response{Message: err.Error()}, http.StatusBadRequest) // 400
+	case errors.Is(err, ErrRoomHasBookings), errors.Is(err, ErrClosureExists), errors.Is(err, ErrAmenityExists):
+		mw.SendJSONResponse(w, &models.Response{Message: err.Error()}, http.StatusConflict) // 409
+	case errors.Is(err, ErrImageTooLarge):
+		mw.SendJSONResponse(w, &models.Response{Message: err.Error()}, http.StatusRequestEntityTooLarge) // 413
+	default:
+		mw.SendJSONResponse(w, &models.Response{Message: "Внутренняя ошибка сервера: " + err.Error()}, http.StatusInternalServerError) // 500
+	}
+}
+
+// roomID извлекает идентификатор комнаты из пути запроса
+func roomID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id <= 0 {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный идентификатор комнаты"}, http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func (h *Handler) GetRooms(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	// Преобразуем параметры пагинации в числа
+	page, err := strconv.Atoi(query.Get("page"))
+	if err != nil || page < 0 {
+		page = 0
+	}
+	size, err := strconv.Atoi(query.Get("size"))
+	if err != nil || size <= 0 {
+		size = 10
+	}
+
+	filter := Filter{
+		Name:     query.Get("name"),
+		City:     query.Get("city"),
+		Region:   query.Get("region"),
+		Building: query.Get("building"),
+		Page:     page,
+		Size:     size,
+	}
+
+	if capacityStr := query.Get("capacity"); capacityStr != "" {
+		capacity, err := strconv.Atoi(capacityStr)
+		if err != nil || capacity < 0 {
+			mw.SendJSONResponse(w, &models.Response{Message: "Некорректное значение capacity"}, http.StatusBadRequest)
+			return
+		}
+		filter.MinCapacity = capacity
+	}
+
+	if activeStr := query.Get("active"); activeStr != "" {
+		active, err := strconv.ParseBool(activeStr)
+		if err != nil {
+			mw.SendJSONResponse(w, &models.Response{Message: "Некорректное значение active"}, http.StatusBadRequest)
+			return
+		}
+		filter.Active = &active
+	}
+
+	// Дни работы перечисляются через запятую: days=MONDAY,FRIDAY
+	if daysStr := query.Get("days"); daysStr != "" {
+		for _, name := range strings.Split(daysStr, ",") {
+			day, ok := parseWeekday(name)
+			if !ok {
+				mw.SendJSONResponse(w, &models.Response{Message: "Некорректный день недели: " + name}, http.StatusBadRequest)
+				return
+			}
+			filter.Days = append(filter.Days, day)
+		}
+	}
+
+	// Этаж и секция задаются идентификаторами
+	for name, target := range map[string]*int{"floorId": &filter.FloorID, "sectionId": &filter.SectionID} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil || id <= 0 {
+			mw.SendJSONResponse(w, &models.Response{Message: "Некорректное значение " + name}, http.StatusBadRequest)
+			return
+		}
+		*target = id
+	}
+
+	// Оборудование перечисляется кодами через запятую: amenities=PROJECTOR,WHITEBOARD
+	if amenitiesStr := query.Get("amenities"); amenitiesStr != "" {
+		for _, code := range strings.Split(amenitiesStr, ",") {
+			if code = strings.TrimSpace(code); code != "" {
+				filter.Amenities = append(filter.Amenities, code)
+			}
+		}
+	}
+
+	// Интервал, в который комната должна быть свободна, задается в формате RFC 3339
+	if freeFromStr := query.Get("freeFrom"); freeFromStr != "" {
+		freeFrom, err := time.Parse(time.RFC3339, freeFromStr)
+		if err != nil {
+			mw.SendJSONResponse(w, &models.Response{Message: "Некорректное значение freeFrom, ожидается RFC 3339"}, http.StatusBadRequest)
+			return
+		}
+		filter.FreeFrom = freeFrom
+	}
+	if freeToStr := query.Get("freeTo"); freeToStr != "" {
+		freeTo, err := time.Parse(time.RFC3339, freeToStr)
+		if err != nil {
+			mw.SendJSONResponse(w, &models.Response{Message: "Некорректное значение freeTo, ожидается RFC 3339"}, http.StatusBadRequest)
+			return
+		}
+		filter.FreeTo = freeTo
+	}
+
+	rooms, err := h.RoomService.GetRooms(filter)
+	if err != nil {
+		sendRoomError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Комнаты успешно получены",
+		Data:    map[string][]models.Room{"rooms": rooms},
+	}, http.StatusOK)
+}
+
+func (h *Handler) GetRoom(w http.ResponseWriter, r *http.Request) {
+	id, ok := roomID(w, r)
+	if !ok {
+		return
+	}
+
+	room, err := h.RoomService.GetRoom(id)
+	if err != nil {
+		sendRoomError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Комната успешно получена",
+		Data:    map[string]models.Room{"room": *room},
+	}, http.StatusOK)
+}
+
+func (h *Handler) CreateRoom(w http.ResponseWriter, r *http.Request) {
+	var room models.Room
+	if err := json.NewDecoder(r.Body).Decode(&room); err != nil {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.RoomService.CreateRoom(room)
+	if err != nil {
+		sendRoomError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Комната создана",
+		Data:    map[string]models.Room{"room": *created},
+	}, http.StatusCreated)
+}
+
+func (h *Handler) UpdateRoom(w http.ResponseWriter, r *http.Request) {
+	id, ok := roomID(w, r)
+	if !ok {
+		return
+	}
+
+	var room models.Room
+	if err := json.NewDecoder(r.Body).Decode(&room); err != nil {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	updated, err := h.RoomService.UpdateRoom(id, room)
+	if err != nil {
+		sendRoomError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Комната обновлена",
+		Data:    map[string]models.Room{"room": *updated},
+	}, http.StatusOK)
+}
+
+func (h *Handler) ToggleRoomActive(w http.ResponseWriter, r *http.Request) {
+	id, ok := roomID(w, r)
+	if !ok {
+		return
+	}
+
+	room, err := h.RoomService.ToggleRoomActive(id)
+	if err != nil {
+		sendRoomError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Активность комнаты изменена",
+		Data:    map[string]models.Room{"room": *room},
+	}, http.StatusOK)
+}
+
+func (h *Handler) DeleteRoom(w http.ResponseWriter, r *http.Request) {
+	id, ok := roomID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.RoomService.DeleteRoom(id); err != nil {
+		sendRoomError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{Message: "Комната удалена"}, http.StatusOK)
+}
+
+func (h *Handler) GetApprovers(w http.ResponseWriter, r *http.Request) {
+	id, ok := roomID(w, r)
+	if !ok {
+		return
+	}
+
+	approvers, err := h.RoomService.GetApprovers(id)
+	if err != nil {
+		sendRoomError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Согласующие комнаты получены",
+		Data:    map[string][]models.RoomApprover{"approvers": approvers},
+	}, http.StatusOK)
+}
+
+// SetApprovers заменяет список согласующих комнаты. Тело запроса - массив согласующих.
+func (h *Handler) SetApprovers(w http.ResponseWriter, r *http.Request) {
+	id, ok := roomID(w, r)
+	if !ok {
+		return
+	}
+
+	var approvers []models.RoomApprover
+	if err := json.NewDecoder(r.Body).Decode(&approvers); err != nil {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	saved, err := h.RoomService.SetApprovers(id, approvers)
+	if err != nil {
+		sendRoomError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Согласующие комнаты обновлены",
+		Data:    map[string][]models.RoomApprover{"approvers": saved},
+	}, http.StatusOK)
+}
+
+// SetRoomAmenities заменяет оборудование комнаты. Тело запроса - массив идентификаторов из справочника.
+func (h *Handler) SetRoomAmenities(w http.ResponseWriter, r *http.Request) {
+	id, ok := roomID(w, r)
+	if !ok {
+		return
+	}
+
+	var amenityIDs []int
+	if err := json.NewDecoder(r.Body).Decode(&amenityIDs); err != nil {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	amenities, err := h.RoomService.SetRoomAmenities(id, amenityIDs)
+	if err != nil {
+		sendRoomError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Оборудование комнаты обновлено",
+		Data:    map[string][]models.Amenity{"amenities": amenities},
+	}, http.StatusOK)
+}
+
+func (h *Handler) GetAvailability(w http.ResponseWriter, r *http.Request) {
+	id, ok := roomID(w, r)
+	if !ok {
+		return
+	}
+
+	// Период задается датами в формате YYYY-MM-DD в часовом поясе комнаты, по умолчанию - ближайшая неделя
+	var from, to time.Time
+	if fromStr := r.URL.Query().Get("from"); fromStr != "" {
+		parsed, err := time.ParseInLocation(time.DateOnly, fromStr, time.Local)
+		if err != nil {
+			mw.SendJSONResponse(w, &models.Response{Message: "Некорректная дата from, ожидается YYYY-MM-DD"}, http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+
+	if toStr := r.URL.Query().Get("to"); toStr != "" {
+		parsed, err := time.ParseInLocation(time.DateOnly, toStr, time.Local)
+		if err != nil {
+			mw.SendJSONResponse(w, &models.Response{Message: "Некорректная дата to, ожидается YYYY-MM-DD"}, http.StatusBadRequest)
+			return
+		}
+		to = parsed
+	}
+
+	slots, err := h.RoomService.GetAvailability(id, from, to)
+	if err != nil {
+		sendRoomError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Свободное время комнаты успешно получено",
+		Data:    map[string][]models.TimeSlot{"slots": slots},
+	}, http.StatusOK)
+}
+
+// imageID извлекает идентификатор фотографии из пути запроса
+func imageID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["imageId"])
+	if err != nil || id <= 0 {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный идентификатор фотографии"}, http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func (h *Handler) GetImages(w http.ResponseWriter, r *http.Request) {
+	id, ok := roomID(w, r)
+	if !ok {
+		return
+	}
+
+	images, err := h.RoomService.GetImages(id)
+	if err != nil {
+		sendRoomError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Фотографии комнаты получены",
+		Data:    map[string][]models.RoomImage{"images": images},
+	}, http.StatusOK)
+}
+
+// AddImage загружает фотографию комнаты. Тело запроса - содержимое файла JPEG или PNG.
+func (h *Handler) AddImage(w http.ResponseWriter, r *http.Request) {
+	id, ok := roomID(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxImageSize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			mw.SendJSONResponse(w, &models.Response{Message: ErrImageTooLarge.Error()}, http.StatusRequestEntityTooLarge)
+			return
+		}
+		mw.SendJSONResponse(w, &models.Response{Message: "Не удалось прочитать изображение"}, http.StatusBadRequest)
+		return
+	}
+
+	image, err := h.RoomService.AddImage(id, data)
+	if err != nil {
+		sendRoomError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Фотография загружена",
+		Data:    map[string]models.RoomImage{"image": *image},
+	}, http.StatusCreated)
+}
+
+// GetImage отдает файл фотографии. Размер выбирается параметром size: original (по умолчанию), medium или thumbnail.
+// Файлы фотографий не меняются после загрузки, поэтому клиент может хранить их в кэше неограниченно долго.
+func (h *Handler) GetImage(w http.ResponseWriter, r *http.Request) {
+	id, ok := roomID(w, r)
+	if !ok {
+		return
+	}
+	imgID, ok := imageID(w, r)
+	if !ok {
+		return
+	}
+
+	size := r.URL.Query().Get("size")
+	if size == "" {
+		size = ImageSizeOriginal
+	}
+
+	path, image, err := h.RoomService.ImageFile(id, imgID, size)
+	if err != nil {
+		sendRoomError(w, err)
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			sendRoomError(w, ErrImageNotFound)
+			return
+		}
+		sendRoomError(w, err)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", image.ContentType)
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.Header().Set("ETag", fmt.Sprintf(`"%d-%s"`, image.ID, size))
+	http.ServeContent(w, r, "", image.CreatedAt, file)
+}
+
+func (h *Handler) SetCoverImage(w http.ResponseWriter, r *http.Request) {
+	id, ok := roomID(w, r)
+	if !ok {
+		return
+	}
+	imgID, ok := imageID(w, r)
+	if !ok {
+		return
+	}
+
+	image, err := h.RoomService.SetCoverImage(id, imgID)
+	if err != nil {
+		sendRoomError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Обложка комнаты изменена",
+		Data:    map[string]models.RoomImage{"image": *image},
+	}, http.StatusOK)
+}
+
+func (h *Handler) DeleteImage(w http.ResponseWriter, r *http.Request) {
+	id, ok := roomID(w, r)
+	if !ok {
+		return
+	}
+	imgID, ok := imageID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.RoomService.DeleteImage(id, imgID); err != nil {
+		sendRoomError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{Message: "Фотография удалена"}, http.StatusOK)
+}
+
+// closureDate разбирает необязательный параметр запроса с датой в формате YYYY-MM-DD
+func closureDate(w http.ResponseWriter, r *http.Request, name string) (time.Time, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return time.Time{}, true
+	}
+	date, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		mw.SendJSONResponse(w, &models.Response{Message: fmt.Sprintf("Некорректная дата %s, ожидается YYYY-MM-DD", name)}, http.StatusBadRequest)
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+// closureTarget разбирает необязательные параметры roomId и addressId
+func closureTarget(w http.ResponseWriter, r *http.Request) (addressID, roomID int, ok bool) {
+	for name, target := range map[string]*int{"addressId": &addressID, "roomId": &roomID} {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil || id <= 0 {
+			mw.SendJSONResponse(w, &models.Response{Message: "Некорректное значение " + name}, http.StatusBadRequest)
+			return 0, 0, false
+		}
+		*target = id
+	}
+	return addressID, roomID, true
+}
+
+// GetClosures возвращает праздники и закрытия. Параметры from и to ограничивают период,
+// roomId и addressId оставляют только закрытия, действующие для комнаты или адреса.
+func (h *Handler) GetClosures(w http.ResponseWriter, r *http.Request) {
+	from, ok := closureDate(w, r, "from")
+	if !ok {
+		return
+	}
+	to, ok := closureDate(w, r, "to")
+	if !ok {
+		return
+	}
+	addressID, roomID, ok := closureTarget(w, r)
+	if !ok {
+		return
+	}
+
+	closures, err := h.RoomService.GetClosures(ClosureFilter{From: from, To: to, AddressID: addressID, RoomID: roomID})
+	if err != nil {
+		sendRoomError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Закрытия успешно получены",
+		Data:    map[string][]models.Closure{"closures": closures},
+	}, http.StatusOK)
+}
+
+func (h *Handler) CreateClosure(w http.ResponseWriter, r *http.Request) {
+	var closure models.Closure
+	if err := json.NewDecoder(r.Body).Decode(&closure); err != nil {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.RoomService.CreateClosure(closure)
+	if err != nil {
+		sendRoomError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Закрытие успешно создано",
+		Data:    map[string]models.Closure{"closure": *created},
+	}, http.StatusCreated)
+}
+
+func (h *Handler) DeleteClosure(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id <= 0 {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный идентификатор закрытия"}, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.RoomService.DeleteClosure(id); err != nil {
+		sendRoomError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{Message: "Закрытие успешно удалено"}, http.StatusOK)
+}
+
+// ImportClosures загружает список праздников из тела запроса. Формат задается параметром format (csv или ics),
+// а если он не указан - по Content-Type. Параметры roomId или addressId ограничивают закрытия комнатой или адресом.
+func (h *Handler) ImportClosures(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	addressID, roomID, ok := closureTarget(w, r)
+	if !ok {
+		return
+	}
+	target := models.Closure{}
+	if addressID != 0 {
+		target.AddressID = &addressID
+	}
+	if roomID != 0 {
+		target.RoomID = &roomID
+	}
+
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		switch contentType := r.Header.Get("Content-Type"); {
+		case strings.HasPrefix(contentType, "text/calendar"):
+			format = ClosureFormatICS
+		default:
+			format = ClosureFormatCSV
+		}
+	}
+
+	body := http.MaxBytesReader(w, r.Body, MaxClosureImportSize)
+	result, err := h.RoomService.ImportClosures(body, format, target)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			mw.SendJSONResponse(w, &models.Response{Message: "Файл слишком большой"}, http.StatusRequestEntityTooLarge)
+			return
+		}
+		sendRoomError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: fmt.Sprintf("Импорт завершен: создано %d, уже было задано %d", result.Created, result.Duplicates),
+		Data:    map[string]ClosureImportResult{"result": *result},
+	}, http.StatusOK)
+}
+
+// amenityID извлекает идентификатор оборудования из пути запроса
+func amenityID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id <= 0 {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный идентификатор оборудования"}, http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// GetAmenities возвращает справочник оборудования комнат
+func (h *Handler) GetAmenities(w http.ResponseWriter, r *http.Request) {
+	amenities, err := h.RoomService.GetAmenities()
+	if err != nil {
+		sendRoomError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Оборудование успешно получено",
+		Data:    map[string][]models.Amenity{"amenities": amenities},
+	}, http.StatusOK)
+}
+
+func (h *Handler) CreateAmenity(w http.ResponseWriter, r *http.Request) {
+	var amenity models.Amenity
+	if err := json.NewDecoder(r.Body).Decode(&amenity); err != nil {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.RoomService.CreateAmenity(amenity)
+	if err != nil {
+		sendRoomError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Оборудование добавлено",
+		Data:    map[string]models.Amenity{"amenity": *created},
+	}, http.StatusCreated)
+}
+
+func (h *Handler) UpdateAmenity(w http.ResponseWriter, r *http.Request) {
+	id, ok := amenityID(w, r)
+	if !ok {
+		return
+	}
+
+	var amenity models.Amenity
+	if err := json.NewDecoder(r.Body).Decode(&amenity); err != nil {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	updated, err := h.RoomService.UpdateAmenity(id, amenity)
+	if err != nil {
+		sendRoomError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Оборудование обновлено",
+		Data:    map[string]models.Amenity{"amenity": *updated},
+	}, http.StatusOK)
+}
+
+func (h *Handler) DeleteAmenity(w http.ResponseWriter, r *http.Request) {
+	id, ok := amenityID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.RoomService.DeleteAmenity(id); err != nil {
+		sendRoomError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{Message: "Оборудование удалено"}, http.StatusOK)
+}
@@ -0,0 +1,407 @@
+package rooms
+
+import (
+	"book_talk/internal/models"
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/lib/pq"
+)
+
+// Размеры фотографий комнат
+const (
+	ImageSizeOriginal  = "original"
+	ImageSizeMedium    = "medium"
+	ImageSizeThumbnail = "thumbnail"
+)
+
+// Ограничения загружаемых фотографий
+const (
+	MaxImageSize   = 10 << 20   // Максимальный размер файла в байтах
+	maxImagePixels = 40_000_000 // Максимальное число пикселей, чтобы не распаковывать огромные изображения
+
+	mediumImageSide    = 1024 // Наибольшая сторона среднего размера в пикселях
+	thumbnailImageSide = 256  // Наибольшая сторона миниатюры в пикселях
+	jpegQuality        = 85
+)
+
+// roomImagesDir - каталог, в котором хранятся фотографии комнат, по подкаталогу на комнату
+const roomImagesDir = "images/rooms"
+
+var (
+	ErrImageNotFound    = errors.New("фотография не найдена")
+	ErrUnsupportedImage = errors.New("поддерживаются только изображения JPEG и PNG")
+	ErrImageTooLarge    = fmt.Errorf("изображение слишком большое: не более %d МБ и %d мегапикселей", MaxImageSize>>20, maxImagePixels/1_000_000)
+	ErrInvalidImageSize = errors.New("некорректный размер фотографии, ожидается original, medium или thumbnail")
+)
+
+const roomImageSelect = `
+	SELECT id, room_id, content_type, width, height, is_cover, created_at
+	FROM room_image
+`
+
+func scanRoomImage(row rowScanner) (models.RoomImage, error) {
+	var img models.RoomImage
+	err := row.Scan(&img.ID, &img.RoomID, &img.ContentType, &img.Width, &img.Height, &img.Cover, &img.CreatedAt)
+	return img, err
+}
+
+// loadImages заполняет фотографии комнат, обложка идет первой
+func (s *Service) loadImages(rooms []models.Room) error {
+	if len(rooms) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(rooms))
+	index := make(map[int]int, len(rooms))
+	for i, room := range rooms {
+		ids[i] = int64(room.ID)
+		index[room.ID] = i
+	}
+
+	rows, err := s.DB.Query(roomImageSelect+` WHERE room_id = ANY($1) ORDER BY is_cover DESC, id`, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("ошибка при получении фотографий комнат: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		img, err := scanRoomImage(rows)
+		if err != nil {
+			return fmt.Errorf("ошибка при обработке фотографии комнаты: %v", err)
+		}
+		room := &rooms[index[img.RoomID]]
+		room.Images = append(room.Images, img)
+	}
+
+	return rows.Err()
+}
+
+// GetImages возвращает фотографии комнаты, обложка идет первой
+func (s *Service) GetImages(roomID int) ([]models.RoomImage, error) {
+	room, err := s.GetRoom(roomID)
+	if err != nil {
+		return nil, err
+	}
+	return room.Images, nil
+}
+
+// AddImage сохраняет фотографию комнаты вместе со средней копией и миниатюрой.
+// Первая фотография комнаты становится обложкой.
+func (s *Service) AddImage(roomID int, data []byte) (*models.RoomImage, error) {
+	if len(data) > MaxImageSize {
+		return nil, ErrImageTooLarge
+	}
+	contentType := http.DetectContentType(data)
+	if contentType != "image/jpeg" && contentType != "image/png" {
+		return nil, ErrUnsupportedImage
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return nil, ErrImageTooLarge
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	medium, err := encodeImage(resizeToFit(src, mediumImageSide), contentType)
+	if err != nil {
+		return nil, err
+	}
+	thumbnail, err := encodeImage(resizeToFit(src, thumbnailImageSide), contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Блокируем комнату, чтобы одновременные загрузки не сделали обложкой две фотографии
+	var hasCover bool
+	err = tx.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM room_image WHERE room_id = r.id AND is_cover)
+		FROM room r WHERE r.id = $1 FOR UPDATE
+	`, roomID).Scan(&hasCover)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRoomNotFound
+		}
+		return nil, fmt.Errorf("ошибка при получении комнаты: %v", err)
+	}
+
+	var id int
+	err = tx.QueryRow(`SELECT nextval(pg_get_serial_sequence('room_image', 'id'))`).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось получить идентификатор фотографии: %v", err)
+	}
+
+	dir := filepath.Join(roomImagesDir, fmt.Sprint(roomID))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("не удалось создать каталог фотографий: %v", err)
+	}
+	ext := ".jpg"
+	if contentType == "image/png" {
+		ext = ".png"
+	}
+	paths := map[string]string{
+		ImageSizeOriginal:  filepath.Join(dir, fmt.Sprintf("%d%s", id, ext)),
+		ImageSizeMedium:    filepath.Join(dir, fmt.Sprintf("%d_%s%s", id, ImageSizeMedium, ext)),
+		ImageSizeThumbnail: filepath.Join(dir, fmt.Sprintf("%d_%s%s", id, ImageSizeThumbnail, ext)),
+	}
+	files := map[string][]byte{ImageSizeOriginal: data, ImageSizeMedium: medium, ImageSizeThumbnail: thumbnail}
+
+	committed := false
+	defer func() {
+		if !committed {
+			removeImageFiles(paths)
+		}
+	}()
+	for size, path := range paths {
+		if err := os.WriteFile(path, files[size], 0644); err != nil {
+			return nil, fmt.Errorf("не удалось сохранить фотографию: %v", err)
+		}
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO room_image (id, room_id, content_type, width, height, original_path, medium_path, thumbnail_path, is_cover)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, id, roomID, contentType, config.Width, config.Height,
+		paths[ImageSizeOriginal], paths[ImageSizeMedium], paths[ImageSizeThumbnail], !hasCover)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось сохранить фотографию: %v", err)
+	}
+	if !hasCover {
+		if err := syncCoverPathTx(tx, roomID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+	committed = true
+
+	return s.getImage(roomID, id)
+}
+
+func (s *Service) getImage(roomID, id int) (*models.RoomImage, error) {
+	img, err := scanRoomImage(s.DB.QueryRow(roomImageSelect+` WHERE room_id = $1 AND id = $2`, roomID, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrImageNotFound
+		}
+		return nil, fmt.Errorf("ошибка при получении фотографии: %v", err)
+	}
+	return &img, nil
+}
+
+// ImageFile возвращает путь к файлу фотографии нужного размера и сведения о ней
+func (s *Service) ImageFile(roomID, id int, size string) (string, *models.RoomImage, error) {
+	column := map[string]string{
+		ImageSizeOriginal:  "original_path",
+		ImageSizeMedium:    "medium_path",
+		ImageSizeThumbnail: "thumbnail_path",
+	}[size]
+	if column == "" {
+		return "", nil, ErrInvalidImageSize
+	}
+
+	var path string
+	var img models.RoomImage
+	err := s.DB.QueryRow(`
+		SELECT `+column+`, id, room_id, content_type, width, height, is_cover, created_at
+		FROM room_image WHERE room_id = $1 AND id = $2
+	`, roomID, id).Scan(&path, &img.ID, &img.RoomID, &img.ContentType, &img.Width, &img.Height, &img.Cover, &img.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil, ErrImageNotFound
+		}
+		return "", nil, fmt.Errorf("ошибка при получении фотографии: %v", err)
+	}
+
+	return path, &img, nil
+}
+
+// SetCoverImage делает фотографию обложкой комнаты
+func (s *Service) SetCoverImage(roomID, id int) (*models.RoomImage, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM room_image WHERE room_id = $1 AND id = $2)`, roomID, id).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении фотографии: %v", err)
+	}
+	if !exists {
+		return nil, ErrImageNotFound
+	}
+
+	// Снимаем старую обложку отдельным запросом, иначе уникальный индекс room_image_cover_idx сработает до конца обновления
+	if _, err := tx.Exec(`UPDATE room_image SET is_cover = false WHERE room_id = $1 AND is_cover AND id <> $2`, roomID, id); err != nil {
+		return nil, fmt.Errorf("не удалось сменить обложку: %v", err)
+	}
+	if _, err := tx.Exec(`UPDATE room_image SET is_cover = true WHERE id = $1`, id); err != nil {
+		return nil, fmt.Errorf("не удалось сменить обложку: %v", err)
+	}
+	if err := syncCoverPathTx(tx, roomID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+
+	return s.getImage(roomID, id)
+}
+
+// DeleteImage удаляет фотографию комнаты. Если удалена обложка, ею становится самая ранняя из оставшихся фотографий.
+func (s *Service) DeleteImage(roomID, id int) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	var cover bool
+	var original, medium, thumbnail string
+	err = tx.QueryRow(`
+		DELETE FROM room_image WHERE room_id = $1 AND id = $2
+		RETURNING is_cover, original_path, medium_path, thumbnail_path
+	`, roomID, id).Scan(&cover, &original, &medium, &thumbnail)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrImageNotFound
+		}
+		return fmt.Errorf("не удалось удалить фотографию: %v", err)
+	}
+
+	if cover {
+		_, err := tx.Exec(`
+			UPDATE room_image SET is_cover = true
+			WHERE id = (SELECT id FROM room_image WHERE room_id = $1 ORDER BY id LIMIT 1)
+		`, roomID)
+		if err != nil {
+			return fmt.Errorf("не удалось сменить обложку: %v", err)
+		}
+		if err := syncCoverPathTx(tx, roomID); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+
+	removeImageFiles(map[string]string{
+		ImageSizeOriginal:  original,
+		ImageSizeMedium:    medium,
+		ImageSizeThumbnail: thumbnail,
+	})
+	return nil
+}
+
+// syncCoverPathTx записывает путь к обложке в room.image_path, который показывается в списках комнат
+func syncCoverPathTx(tx *sql.Tx, roomID int) error {
+	_, err := tx.Exec(`
+		UPDATE room SET image_path = (SELECT original_path FROM room_image WHERE room_id = $1 AND is_cover)
+		WHERE id = $1
+	`, roomID)
+	if err != nil {
+		return fmt.Errorf("не удалось обновить обложку комнаты: %v", err)
+	}
+	return nil
+}
+
+// removeImageFiles удаляет файлы фотографии; ошибки игнорируются, так как запись о фотографии уже удалена
+func removeImageFiles(paths map[string]string) {
+	for _, path := range paths {
+		os.Remove(path)
+	}
+}
+
+// encodeImage кодирует изображение в исходном формате загруженного файла
+func encodeImage(img image.Image, contentType string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if contentType == "image/png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("не удалось сохранить уменьшенную копию: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// resizeToFit уменьшает изображение так, чтобы его наибольшая сторона не превышала side, сохраняя пропорции.
+// Каждый пиксель результата - среднее покрываемых им пикселей исходного изображения.
+// Изображения, которые уже меньше side, не увеличиваются.
+func resizeToFit(src image.Image, side int) image.Image {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	dw, dh := w, h
+	if w > side || h > side {
+		if w >= h {
+			dw, dh = side, max(1, h*side/w)
+		} else {
+			dw, dh = max(1, w*side/h), side
+		}
+	}
+
+	// Переводим исходное изображение в RGBA, чтобы работать с пикселями напрямую
+	rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+	if dw == w && dh == h {
+		return rgba
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*h/dh, max((y+1)*h/dh, y*h/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*w/dw, max((x+1)*w/dw, x*w/dw+1)
+
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				offset := rgba.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += int(rgba.Pix[offset])
+					g += int(rgba.Pix[offset+1])
+					b += int(rgba.Pix[offset+2])
+					a += int(rgba.Pix[offset+3])
+					offset += 4
+					n++
+				}
+			}
+
+			offset := dst.PixOffset(x, y)
+			dst.Pix[offset] = uint8(r / n)
+			dst.Pix[offset+1] = uint8(g / n)
+			dst.Pix[offset+2] = uint8(b / n)
+			dst.Pix[offset+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,101 @@
+package rooms
+
+import (
+	"book_talk/internal/models"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Ограничения правил бронирования комнаты
+const (
+	maxPolicyMinutes = 7 * 24 * 60 // Длительности и буферы не длиннее недели
+	maxHorizonDays   = 3 * 365     // Бронировать можно не дальше чем на три года вперед
+)
+
+var (
+	ErrInvalidPolicy = fmt.Errorf("некорректные правила бронирования: значения должны быть от 0 до %d минут "+
+		"(горизонт - до %d дней), минимальная длительность не больше максимальной, шаг - делитель суток", maxPolicyMinutes, maxHorizonDays)
+
+	// ErrPolicyViolation - общая ошибка, которую оборачивают все нарушения правил бронирования комнаты
+	ErrPolicyViolation = errors.New("бронирование нарушает правила комнаты")
+	ErrBookingTooShort = fmt.Errorf("%w: бронирование короче минимальной длительности", ErrPolicyViolation)
+	ErrBookingTooLong  = fmt.Errorf("%w: бронирование длиннее максимальной длительности", ErrPolicyViolation)
+	ErrMisalignedTime  = fmt.Errorf("%w: начало и окончание должны попадать на шаг бронирования", ErrPolicyViolation)
+	ErrBeyondHorizon   = fmt.Errorf("%w: бронирование начинается слишком далеко в будущем", ErrPolicyViolation)
+)
+
+// validatePolicy проверяет правила бронирования, которые администратор задает для комнаты
+func validatePolicy(policy models.RoomPolicy) error {
+	for _, minutes := range []int{policy.MinDurationMinutes, policy.MaxDurationMinutes, policy.GranularityMinutes,
+		policy.SetupBufferMinutes, policy.CleanupBufferMinutes} {
+		if minutes < 0 || minutes > maxPolicyMinutes {
+			return ErrInvalidPolicy
+		}
+	}
+	if policy.HorizonDays < 0 || policy.HorizonDays > maxHorizonDays {
+		return ErrInvalidPolicy
+	}
+	if policy.MaxDurationMinutes > 0 && policy.MinDurationMinutes > policy.MaxDurationMinutes {
+		return ErrInvalidPolicy
+	}
+	// Шаг откладывается от полуночи, поэтому сутки должны делиться на него без остатка
+	if policy.GranularityMinutes > 0 && (24*60)%policy.GranularityMinutes != 0 {
+		return ErrInvalidPolicy
+	}
+	return nil
+}
+
+// CheckPolicy проверяет интервал бронирования [start, end) по правилам комнаты.
+// Шаг отсчитывается от полуночи в часовом поясе комнаты loc, как и часы работы комнаты.
+func CheckPolicy(policy models.RoomPolicy, loc *time.Location, start, end, now time.Time) error {
+	duration := end.Sub(start)
+	if policy.MinDurationMinutes > 0 && duration < time.Duration(policy.MinDurationMinutes)*time.Minute {
+		return fmt.Errorf("%w: не меньше %d мин.", ErrBookingTooShort, policy.MinDurationMinutes)
+	}
+	if policy.MaxDurationMinutes > 0 && duration > time.Duration(policy.MaxDurationMinutes)*time.Minute {
+		return fmt.Errorf("%w: не больше %d мин.", ErrBookingTooLong, policy.MaxDurationMinutes)
+	}
+	if policy.GranularityMinutes > 0 {
+		step := time.Duration(policy.GranularityMinutes) * time.Minute
+		if !isAligned(start, step, loc) || !isAligned(end, step, loc) {
+			return fmt.Errorf("%w: шаг %d мин.", ErrMisalignedTime, policy.GranularityMinutes)
+		}
+	}
+	if policy.HorizonDays > 0 && !start.Before(now.AddDate(0, 0, policy.HorizonDays)) {
+		return fmt.Errorf("%w: не дальше %d дн. вперед", ErrBeyondHorizon, policy.HorizonDays)
+	}
+	return nil
+}
+
+// BlockedInterval возвращает интервал, который бронирование занимает вместе с буферами на подготовку и уборку.
+// Два бронирования комнаты не должны пересекаться занятыми интервалами.
+func BlockedInterval(policy models.RoomPolicy, start, end time.Time) (time.Time, time.Time) {
+	return start.Add(-time.Duration(policy.SetupBufferMinutes) * time.Minute),
+		end.Add(time.Duration(policy.CleanupBufferMinutes) * time.Minute)
+}
+
+// isAligned проверяет, что момент отстоит от полуночи в часовом поясе loc на целое число шагов
+func isAligned(t time.Time, step time.Duration, loc *time.Location) bool {
+	t = t.In(loc)
+	return t.Sub(startOfDay(t))%step == 0
+}
+
+// alignUp возвращает ближайший момент не раньше t, попадающий на шаг
+func alignUp(t time.Time, step time.Duration, loc *time.Location) time.Time {
+	t = t.In(loc)
+	day := startOfDay(t)
+	offset := t.Sub(day)
+	if rem := offset % step; rem != 0 {
+		offset += step - rem
+	}
+	return day.Add(offset)
+}
+
+// alignDown возвращает ближайший момент не позже t, попадающий на шаг
+func alignDown(t time.Time, step time.Duration, loc *time.Location) time.Time {
+	t = t.In(loc)
+	day := startOfDay(t)
+	offset := t.Sub(day)
+	return day.Add(offset - offset%step)
+}
@@ -0,0 +1,119 @@
+package rooms
+
+import (
+	"book_talk/internal/models"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckPolicy(t *testing.T) {
+	kolkata := mustLoadLocation(t, "Asia/Kolkata")
+	now := time.Date(2026, time.March, 2, 8, 0, 0, 0, time.UTC)
+	start := time.Date(2026, time.March, 3, 10, 0, 0, 0, time.UTC)
+	minutes := func(n int) time.Duration { return time.Duration(n) * time.Minute }
+
+	tests := []struct {
+		name    string
+		policy  models.RoomPolicy
+		loc     *time.Location
+		start   time.Time
+		end     time.Time
+		wantErr error
+	}{
+		{name: "no rules", start: start, end: start.Add(minutes(1))},
+
+		{name: "min duration exactly", policy: models.RoomPolicy{MinDurationMinutes: 30}, start: start, end: start.Add(minutes(30))},
+		{name: "min duration minute short", policy: models.RoomPolicy{MinDurationMinutes: 30}, start: start, end: start.Add(minutes(29)), wantErr: ErrBookingTooShort},
+		{name: "min duration second short", policy: models.RoomPolicy{MinDurationMinutes: 30}, start: start, end: start.Add(minutes(30) - time.Second), wantErr: ErrBookingTooShort},
+
+		{name: "max duration exactly", policy: models.RoomPolicy{MaxDurationMinutes: 120}, start: start, end: start.Add(minutes(120))},
+		{name: "max duration minute over", policy: models.RoomPolicy{MaxDurationMinutes: 120}, start: start, end: start.Add(minutes(121)), wantErr: ErrBookingTooLong},
+		{name: "max duration second over", policy: models.RoomPolicy{MaxDurationMinutes: 120}, start: start, end: start.Add(minutes(120) + time.Second), wantErr: ErrBookingTooLong},
+
+		{name: "min equals max", policy: models.RoomPolicy{MinDurationMinutes: 60, MaxDurationMinutes: 60}, start: start, end: start.Add(minutes(60))},
+
+		{name: "aligned to step", policy: models.RoomPolicy{GranularityMinutes: 15}, start: start.Add(minutes(15)), end: start.Add(minutes(45))},
+		{name: "start minute past step", policy: models.RoomPolicy{GranularityMinutes: 15}, start: start.Add(minutes(16)), end: start.Add(minutes(45)), wantErr: ErrMisalignedTime},
+		{name: "end minute past step", policy: models.RoomPolicy{GranularityMinutes: 15}, start: start.Add(minutes(15)), end: start.Add(minutes(46)), wantErr: ErrMisalignedTime},
+		{name: "start second past step", policy: models.RoomPolicy{GranularityMinutes: 15}, start: start.Add(time.Second), end: start.Add(minutes(15)), wantErr: ErrMisalignedTime},
+		{
+			// 10:00 в Калькутте - 04:30 UTC, шаг отсчитывается от местной полуночи
+			name:   "step counted from local midnight",
+			policy: models.RoomPolicy{GranularityMinutes: 60},
+			loc:    kolkata,
+			start:  time.Date(2026, time.March, 3, 10, 0, 0, 0, kolkata),
+			end:    time.Date(2026, time.March, 3, 11, 0, 0, 0, kolkata),
+		},
+		{
+			name:    "step from UTC midnight is misaligned locally",
+			policy:  models.RoomPolicy{GranularityMinutes: 60},
+			loc:     kolkata,
+			start:   start,
+			end:     start.Add(minutes(60)),
+			wantErr: ErrMisalignedTime,
+		},
+
+		{name: "horizon minute before", policy: models.RoomPolicy{HorizonDays: 7}, start: now.AddDate(0, 0, 7).Add(-time.Minute), end: now.AddDate(0, 0, 7)},
+		// Горизонт не включается: начать бронирование ровно через HorizonDays дней уже нельзя
+		{name: "horizon exactly", policy: models.RoomPolicy{HorizonDays: 7}, start: now.AddDate(0, 0, 7), end: now.AddDate(0, 0, 7).Add(minutes(30)), wantErr: ErrBeyondHorizon},
+		{name: "horizon minute past", policy: models.RoomPolicy{HorizonDays: 7}, start: now.AddDate(0, 0, 7).Add(time.Minute), end: now.AddDate(0, 0, 7).Add(minutes(30)), wantErr: ErrBeyondHorizon},
+		{name: "horizon does not limit end", policy: models.RoomPolicy{HorizonDays: 1}, start: now, end: now.AddDate(0, 0, 2)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc := tt.loc
+			if loc == nil {
+				loc = time.UTC
+			}
+			err := CheckPolicy(tt.policy, loc, tt.start, tt.end, now)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("CheckPolicy() error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) || !errors.Is(err, ErrPolicyViolation) {
+				t.Fatalf("CheckPolicy() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidatePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  models.RoomPolicy
+		wantErr bool
+	}{
+		{name: "empty", policy: models.RoomPolicy{}},
+		{name: "durations at limit", policy: models.RoomPolicy{MinDurationMinutes: maxPolicyMinutes, MaxDurationMinutes: maxPolicyMinutes}},
+		{name: "min duration over limit", policy: models.RoomPolicy{MinDurationMinutes: maxPolicyMinutes + 1}, wantErr: true},
+		{name: "max duration over limit", policy: models.RoomPolicy{MaxDurationMinutes: maxPolicyMinutes + 1}, wantErr: true},
+		{name: "buffers at limit", policy: models.RoomPolicy{SetupBufferMinutes: maxPolicyMinutes, CleanupBufferMinutes: maxPolicyMinutes}},
+		{name: "setup buffer over limit", policy: models.RoomPolicy{SetupBufferMinutes: maxPolicyMinutes + 1}, wantErr: true},
+		{name: "cleanup buffer over limit", policy: models.RoomPolicy{CleanupBufferMinutes: maxPolicyMinutes + 1}, wantErr: true},
+		{name: "negative value", policy: models.RoomPolicy{SetupBufferMinutes: -1}, wantErr: true},
+		{name: "horizon at limit", policy: models.RoomPolicy{HorizonDays: maxHorizonDays}},
+		{name: "horizon over limit", policy: models.RoomPolicy{HorizonDays: maxHorizonDays + 1}, wantErr: true},
+		{name: "negative horizon", policy: models.RoomPolicy{HorizonDays: -1}, wantErr: true},
+		{name: "min equals max", policy: models.RoomPolicy{MinDurationMinutes: 60, MaxDurationMinutes: 60}},
+		{name: "min minute over max", policy: models.RoomPolicy{MinDurationMinutes: 61, MaxDurationMinutes: 60}, wantErr: true},
+		{name: "min without max", policy: models.RoomPolicy{MinDurationMinutes: 61}},
+		{name: "step dividing a day", policy: models.RoomPolicy{GranularityMinutes: 24 * 60}},
+		{name: "step not dividing a day", policy: models.RoomPolicy{GranularityMinutes: 7}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePolicy(tt.policy)
+			if tt.wantErr && !errors.Is(err, ErrInvalidPolicy) {
+				t.Fatalf("validatePolicy() error = %v, want %v", err, ErrInvalidPolicy)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("validatePolicy() error = %v", err)
+			}
+		})
+	}
+}
@@ -1 +1,568 @@
 package rooms
+
+import (
+	"book_talk/internal/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type Service struct {
+	DB *sql.DB
+}
+
+func NewRoomsService(db *sql.DB) *Service {
+	return &Service{DB: db}
+}
+
+var (
+	ErrRoomNotFound    = errors.New("комната не найдена")
+	ErrAddressNotFound = errors.New("адрес не найден")
+	ErrInvalidRoom     = errors.New("название комнаты не может быть пустым, вместимость должна быть больше нуля")
+	ErrInvalidAddress  = errors.New("регион, город, улица и здание не могут быть пустыми")
+	ErrRoomHasBookings = errors.New("у комнаты есть бронирования, удаление невозможно")
+	ErrInvalidFreeTime = errors.New("некорректный интервал поиска свободных комнат: окончание должно быть позже начала")
+)
+
+// Filter описывает условия отбора комнат в списке
+type Filter struct {
+	Name        string         // Подстрока названия комнаты
+	City        string         // Город адреса
+	Region      string         // Регион адреса
+	Building    string         // Здание адреса
+	MinCapacity int            // Минимальная вместимость
+	Active      *bool          // Только активные или только неактивные комнаты, nil - все
+	Days        []time.Weekday // Дни недели, в каждый из которых комната должна работать
+	Amenities   []string       // Коды оборудования, которое должно быть в комнате
+	FloorID     int            // Этаж
+	SectionID   int            // Секция этажа
+	FreeFrom    time.Time      // Начало интервала, в который комната должна быть свободна
+	FreeTo      time.Time      // Окончание этого интервала; оба поля задаются вместе
+	Page        int            // Номер страницы, начиная с 0
+	Size        int            // Размер страницы
+}
+
+const roomSelect = `
+	SELECT r.id, r.capacity, r.name, r.image_path, COALESCE(r.active, true), r.approval_required,
+		   r.min_duration_minutes, r.max_duration_minutes, r.granularity_minutes,
+		   r.setup_buffer_minutes, r.cleanup_buffer_minutes, r.booking_horizon_days,
+		   a.id, a.region, a.city, a.street, a.building, a.time_zone,
+		   fl.id, fl.level, fl.name, sc.id, sc.name
+	FROM room r
+	LEFT JOIN address a ON a.id = r.address_id
+	LEFT JOIN floor fl ON fl.id = r.floor_id
+	LEFT JOIN section sc ON sc.id = r.section_id
+`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRoom(row rowScanner) (models.Room, error) {
+	var room models.Room
+	var imagePath sql.NullString
+	var addressID sql.NullInt64
+	var region, city, street, building, timeZone sql.NullString
+	var floorID, floorLevel, sectionID sql.NullInt64
+	var floorName, sectionName sql.NullString
+
+	policy := &room.Policy
+	err := row.Scan(&room.ID, &room.Capacity, &room.Name, &imagePath, &room.Active, &room.ApprovalRequired,
+		&policy.MinDurationMinutes, &policy.MaxDurationMinutes, &policy.GranularityMinutes,
+		&policy.SetupBufferMinutes, &policy.CleanupBufferMinutes, &policy.HorizonDays,
+		&addressID, &region, &city, &street, &building, &timeZone,
+		&floorID, &floorLevel, &floorName, &sectionID, &sectionName)
+	if err != nil {
+		return room, err
+	}
+
+	room.ImagePath = imagePath.String
+	if addressID.Valid {
+		room.Address = models.Address{
+			ID:       int(addressID.Int64),
+			Region:   region.String,
+			City:     city.String,
+			Street:   street.String,
+			Building: building.String,
+			TimeZone: timeZone.String,
+		}
+	}
+	if floorID.Valid {
+		room.Floor = &models.Floor{
+			ID:        int(floorID.Int64),
+			AddressID: room.Address.ID,
+			Level:     int(floorLevel.Int64),
+			Name:      floorName.String,
+		}
+	}
+	if sectionID.Valid && floorID.Valid {
+		room.Section = &models.Section{ID: int(sectionID.Int64), FloorID: int(floorID.Int64), Name: sectionName.String}
+	}
+	room.Weekdays = []time.Weekday{}
+	room.Images = []models.RoomImage{}
+	room.Amenities = []models.Amenity{}
+
+	return room, nil
+}
+
+// GetRooms возвращает комнаты, подходящие под фильтр. Если задана минимальная вместимость,
+// комнаты сортируются от наименьшей достаточной вместимости, иначе - по названию.
+// Свободной в интервале считается активная комната, которая работает весь интервал и не имеет пересекающихся бронирований.
+func (s *Service) GetRooms(filter Filter) ([]models.Room, error) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.Name != "" {
+		args = append(args, "%"+filter.Name+"%")
+		conditions = append(conditions, fmt.Sprintf("r.name ILIKE $%d", len(args)))
+	}
+	if filter.City != "" {
+		args = append(args, filter.City)
+		conditions = append(conditions, fmt.Sprintf("a.city ILIKE $%d", len(args)))
+	}
+	if filter.Region != "" {
+		args = append(args, filter.Region)
+		conditions = append(conditions, fmt.Sprintf("a.region ILIKE $%d", len(args)))
+	}
+	if filter.Building != "" {
+		args = append(args, filter.Building)
+		conditions = append(conditions, fmt.Sprintf("a.building ILIKE $%d", len(args)))
+	}
+	if filter.MinCapacity > 0 {
+		args = append(args, filter.MinCapacity)
+		conditions = append(conditions, fmt.Sprintf("r.capacity >= $%d", len(args)))
+	}
+	if filter.Active != nil {
+		args = append(args, *filter.Active)
+		conditions = append(conditions, fmt.Sprintf("COALESCE(r.active, true) = $%d", len(args)))
+	}
+	if len(filter.Days) > 0 {
+		days := map[string]bool{}
+		for _, day := range filter.Days {
+			days[strings.ToUpper(day.String())] = true
+		}
+		names := make([]string, 0, len(days))
+		for name := range days {
+			names = append(names, name)
+		}
+		args = append(args, pq.Array(names), len(names))
+		conditions = append(conditions, fmt.Sprintf(`(
+			SELECT count(DISTINCT upper(trim(w.day))) FROM weekday w
+			WHERE w.room_id = r.id AND COALESCE(w.active, true) AND upper(trim(w.day)) = ANY($%d)
+		) = $%d`, len(args)-1, len(args)))
+	}
+	if filter.FloorID != 0 {
+		args = append(args, filter.FloorID)
+		conditions = append(conditions, fmt.Sprintf("r.floor_id = $%d", len(args)))
+	}
+	if filter.SectionID != 0 {
+		args = append(args, filter.SectionID)
+		conditions = append(conditions, fmt.Sprintf("r.section_id = $%d", len(args)))
+	}
+	if len(filter.Amenities) > 0 {
+		codes := map[string]bool{}
+		for _, code := range filter.Amenities {
+			codes[normalizeAmenityCode(code)] = true
+		}
+		names := make([]string, 0, len(codes))
+		for code := range codes {
+			names = append(names, code)
+		}
+		args = append(args, pq.Array(names), len(names))
+		conditions = append(conditions, fmt.Sprintf(`(
+			SELECT count(*) FROM room_amenity ra JOIN amenity am ON am.id = ra.amenity_id
+			WHERE ra.room_id = r.id AND am.code = ANY($%d)
+		) = $%d`, len(args)-1, len(args)))
+	}
+	if !filter.FreeFrom.IsZero() || !filter.FreeTo.IsZero() {
+		condition, err := s.freeCondition(filter.FreeFrom, filter.FreeTo, &args)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+	}
+
+	query := roomSelect
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	order := "r.name, r.id"
+	if filter.MinCapacity > 0 {
+		order = "r.capacity, r.name, r.id"
+	}
+	args = append(args, filter.Size, filter.Page*filter.Size)
+	query += fmt.Sprintf(" ORDER BY %s LIMIT $%d OFFSET $%d", order, len(args)-1, len(args))
+
+	rows, err := s.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении комнат: %v", err)
+	}
+	defer rows.Close()
+
+	rooms := []models.Room{}
+	for rows.Next() {
+		room, err := scanRoom(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при обработке данных комнаты: %v", err)
+		}
+		rooms = append(rooms, room)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при обработке строк: %v", err)
+	}
+
+	if err := s.loadWeekdays(rooms); err != nil {
+		return nil, err
+	}
+	if err := s.loadImages(rooms); err != nil {
+		return nil, err
+	}
+	if err := s.loadAmenities(rooms); err != nil {
+		return nil, err
+	}
+
+	return rooms, nil
+}
+
+// freeCondition формирует условие "комната свободна в интервале [from, to)": комната активна,
+// одно из окон расписания на день начала покрывает интервал целиком, этот день не закрыт
+// и нет бронирований, пересекающихся с интервалом с учетом буферов комнаты.
+// Часы расписания и дни, как и при расчете доступности, интерпретируются в часовом поясе комнаты,
+// поэтому условие на расписание строится отдельно для каждого часового пояса адресов.
+func (s *Service) freeCondition(from, to time.Time, args *[]interface{}) (string, error) {
+	if from.IsZero() || to.IsZero() || !to.After(from) {
+		return "", ErrInvalidFreeTime
+	}
+
+	zones, err := s.timeZones()
+	if err != nil {
+		return "", err
+	}
+
+	var schedules []string
+	for _, zone := range zones {
+		loc, err := LoadLocation(zone)
+		if err != nil {
+			continue
+		}
+		localFrom, localTo := from.In(loc), to.In(loc)
+		day := startOfDay(localFrom)
+		endMinutes := int(localTo.Sub(day) / time.Minute)
+		if endMinutes > 24*60 {
+			// Окна расписания не переходят через полночь, поэтому такой интервал не покрывает ни одно из них
+			continue
+		}
+
+		*args = append(*args, zone, strings.ToUpper(localFrom.Weekday().String()), localFrom.Format("15:04:05"),
+			fmt.Sprintf("%02d:%02d:00", endMinutes/60, endMinutes%60), localFrom.Format(time.DateOnly))
+		n := len(*args)
+		schedules = append(schedules, fmt.Sprintf(`(COALESCE(a.time_zone, '') = $%d AND EXISTS (
+				SELECT 1 FROM weekday w
+				WHERE w.room_id = r.id AND COALESCE(w.active, true) AND upper(trim(w.day)) = $%d
+				  AND w.start_time <= $%d::time AND (w.end_time = '00:00' OR w.end_time >= $%d::time)
+			) AND NOT EXISTS (
+				SELECT 1 FROM closure c
+				WHERE `+closureAppliesTo+` AND $%d::date BETWEEN c.start_date AND c.end_date
+			))`, n-4, n-3, n-2, n-1, n))
+	}
+	if len(schedules) == 0 {
+		return "false", nil
+	}
+
+	*args = append(*args, from, to, pq.Array(models.ReleasedBookingStatuses))
+	n := len(*args)
+	return fmt.Sprintf(`COALESCE(r.active, true) AND (%s) AND NOT EXISTS (
+			SELECT 1 FROM booking b
+			WHERE b.room_id = r.id AND b.status <> ALL($%d) AND b.blocked_period && tstzrange(
+				$%d - make_interval(mins => r.setup_buffer_minutes), $%d + make_interval(mins => r.cleanup_buffer_minutes), '[)')
+		)`, strings.Join(schedules, " OR "), n, n-2, n-1), nil
+}
+
+// timeZones возвращает часовые пояса всех адресов и пустую строку для комнат без адреса
+func (s *Service) timeZones() ([]string, error) {
+	rows, err := s.DB.Query(`SELECT DISTINCT time_zone FROM address UNION SELECT ''`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении часовых поясов адресов: %v", err)
+	}
+	defer rows.Close()
+
+	var zones []string
+	for rows.Next() {
+		var zone string
+		if err := rows.Scan(&zone); err != nil {
+			return nil, fmt.Errorf("ошибка при обработке часовых поясов адресов: %v", err)
+		}
+		zones = append(zones, zone)
+	}
+
+	return zones, rows.Err()
+}
+
+func (s *Service) GetRoom(id int) (*models.Room, error) {
+	room, err := scanRoom(s.DB.QueryRow(roomSelect+" WHERE r.id = $1", id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRoomNotFound
+		}
+		return nil, fmt.Errorf("ошибка при получении комнаты: %v", err)
+	}
+
+	rooms := []models.Room{room}
+	if err := s.loadWeekdays(rooms); err != nil {
+		return nil, err
+	}
+	if err := s.loadImages(rooms); err != nil {
+		return nil, err
+	}
+	if err := s.loadAmenities(rooms); err != nil {
+		return nil, err
+	}
+
+	return &rooms[0], nil
+}
+
+// loadWeekdays заполняет дни недели, в которые комнаты открыты
+func (s *Service) loadWeekdays(rooms []models.Room) error {
+	if len(rooms) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(rooms))
+	index := make(map[int]int, len(rooms))
+	for i, room := range rooms {
+		ids[i] = int64(room.ID)
+		index[room.ID] = i
+	}
+
+	rows, err := s.DB.Query(`SELECT room_id, day FROM weekday WHERE COALESCE(active, true) AND room_id = ANY($1) ORDER BY id`, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("ошибка при получении расписания комнат: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var roomID int
+		var day string
+		if err := rows.Scan(&roomID, &day); err != nil {
+			return fmt.Errorf("ошибка при обработке расписания комнаты: %v", err)
+		}
+		weekday, ok := parseWeekday(day)
+		if !ok {
+			continue
+		}
+		room := &rooms[index[roomID]]
+		room.Weekdays = append(room.Weekdays, weekday)
+	}
+
+	return rows.Err()
+}
+
+// parseWeekday разбирает название дня недели без учета регистра (MONDAY, Monday, monday)
+func parseWeekday(day string) (time.Weekday, bool) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(strings.TrimSpace(day), d.String()) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+func validateRoom(room models.Room) error {
+	if strings.TrimSpace(room.Name) == "" || room.Capacity <= 0 {
+		return ErrInvalidRoom
+	}
+	if err := validatePolicy(room.Policy); err != nil {
+		return err
+	}
+	if room.Address.ID == 0 {
+		return validateAddress(room.Address)
+	}
+	return nil
+}
+
+func validateAddress(address models.Address) error {
+	if strings.TrimSpace(address.Region) == "" || strings.TrimSpace(address.City) == "" ||
+		strings.TrimSpace(address.Street) == "" || strings.TrimSpace(address.Building) == "" {
+		return ErrInvalidAddress
+	}
+	_, err := LoadLocation(address.TimeZone)
+	return err
+}
+
+// saveAddress создает новый адрес или проверяет существование адреса с указанным идентификатором
+func saveAddress(tx *sql.Tx, address models.Address) (int, error) {
+	if address.ID != 0 {
+		var id int
+		err := tx.QueryRow(`SELECT id FROM address WHERE id = $1`, address.ID).Scan(&id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return 0, ErrAddressNotFound
+			}
+			return 0, fmt.Errorf("ошибка при получении адреса: %v", err)
+		}
+		return id, nil
+	}
+
+	var id int
+	err := tx.QueryRow(`INSERT INTO address (region, city, street, building, time_zone) VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		address.Region, address.City, address.Street, address.Building, address.TimeZone).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("не удалось сохранить адрес: %v", err)
+	}
+	return id, nil
+}
+
+// CreateRoom создает комнату. Если у адреса указан id, комната привязывается к существующему адресу,
+// иначе адрес создается из переданных полей.
+func (s *Service) CreateRoom(room models.Room) (*models.Room, error) {
+	if err := validateRoom(room); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	addressID, err := saveAddress(tx, room.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	var id int
+	policy := room.Policy
+	err = tx.QueryRow(`
+		INSERT INTO room (capacity, name, address_id, active, approval_required,
+			min_duration_minutes, max_duration_minutes, granularity_minutes,
+			setup_buffer_minutes, cleanup_buffer_minutes, booking_horizon_days)
+		VALUES ($1, $2, $3, true, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id
+	`, room.Capacity, room.Name, addressID, room.ApprovalRequired,
+		policy.MinDurationMinutes, policy.MaxDurationMinutes, policy.GranularityMinutes,
+		policy.SetupBufferMinutes, policy.CleanupBufferMinutes, policy.HorizonDays).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось сохранить комнату: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+
+	return s.GetRoom(id)
+}
+
+// UpdateRoom обновляет название, вместимость, адрес комнаты, необходимость согласования и правила бронирования.
+// Новые буферы применяются только к бронированиям, созданным или перенесенным после изменения.
+// Если у адреса указан id, комната привязывается к этому адресу, иначе поля текущего адреса перезаписываются.
+// При переезде в другое здание этаж и секция комнаты сбрасываются.
+func (s *Service) UpdateRoom(id int, room models.Room) (*models.Room, error) {
+	if err := validateRoom(room); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	var currentAddressID sql.NullInt64
+	err = tx.QueryRow(`SELECT address_id FROM room WHERE id = $1 FOR UPDATE`, id).Scan(&currentAddressID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRoomNotFound
+		}
+		return nil, fmt.Errorf("ошибка при получении комнаты: %v", err)
+	}
+
+	var addressID int
+	if room.Address.ID == 0 && currentAddressID.Valid {
+		addressID = int(currentAddressID.Int64)
+		_, err = tx.Exec(`UPDATE address SET region = $1, city = $2, street = $3, building = $4, time_zone = $5 WHERE id = $6`,
+			room.Address.Region, room.Address.City, room.Address.Street, room.Address.Building, room.Address.TimeZone, addressID)
+		if err != nil {
+			return nil, fmt.Errorf("не удалось обновить адрес: %v", err)
+		}
+	} else {
+		addressID, err = saveAddress(tx, room.Address)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	policy := room.Policy
+	_, err = tx.Exec(`
+		UPDATE room SET capacity = $1, name = $2, address_id = $3, approval_required = $4,
+			min_duration_minutes = $5, max_duration_minutes = $6, granularity_minutes = $7,
+			setup_buffer_minutes = $8, cleanup_buffer_minutes = $9, booking_horizon_days = $10,
+			floor_id = CASE WHEN address_id = $3 THEN floor_id END,
+			section_id = CASE WHEN address_id = $3 THEN section_id END
+		WHERE id = $11
+	`, room.Capacity, room.Name, addressID, room.ApprovalRequired,
+		policy.MinDurationMinutes, policy.MaxDurationMinutes, policy.GranularityMinutes,
+		policy.SetupBufferMinutes, policy.CleanupBufferMinutes, policy.HorizonDays, id)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось обновить комнату: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+
+	return s.GetRoom(id)
+}
+
+// ToggleRoomActive переключает признак активности комнаты
+func (s *Service) ToggleRoomActive(id int) (*models.Room, error) {
+	var updatedID int
+	err := s.DB.QueryRow(`UPDATE room SET active = NOT COALESCE(active, true) WHERE id = $1 RETURNING id`, id).Scan(&updatedID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRoomNotFound
+		}
+		return nil, fmt.Errorf("не удалось изменить активность комнаты: %v", err)
+	}
+
+	return s.GetRoom(updatedID)
+}
+
+// DeleteRoom удаляет комнату вместе с ее расписанием. Комнаты с бронированиями не удаляются.
+func (s *Service) DeleteRoom(id int) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM weekday WHERE room_id = $1`, id); err != nil {
+		return fmt.Errorf("не удалось удалить расписание комнаты: %v", err)
+	}
+
+	result, err := tx.Exec(`DELETE FROM room WHERE id = $1`, id)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" { // foreign_key_violation
+			return ErrRoomHasBookings
+		}
+		return fmt.Errorf("не удалось удалить комнату: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrRoomNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+
+	// Фотографии удаляются из базы каскадно, остается убрать их файлы
+	os.RemoveAll(filepath.Join(roomImagesDir, fmt.Sprint(id)))
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package rooms
+
+import (
+	"book_talk/internal/models"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidTimeZone = errors.New("неизвестный часовой пояс, ожидается имя IANA, например Europe/Moscow")
+
+// LoadLocation возвращает часовой пояс по имени IANA. Пустое имя означает часовой пояс сервера.
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidTimeZone, name)
+	}
+	return loc, nil
+}
+
+// Location возвращает часовой пояс комнаты - часовой пояс ее адреса. Некорректное имя,
+// которое могло попасть в базу в обход проверки, заменяется часовым поясом сервера.
+func Location(room models.Room) *time.Location {
+	loc, err := LoadLocation(room.Address.TimeZone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// dateIn возвращает полночь того же календарного дня, что и t, в часовом поясе loc
+func dateIn(t time.Time, loc *time.Location) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, loc)
+}
+
+// Значения параметра timeZone, задающего часовой пояс, в котором показывается время бронирований
+const (
+	DisplayZoneRoom = "room" // Местное время комнаты, по умолчанию
+	DisplayZoneUser = "user" // Часовой пояс из профиля пользователя
+)
+
+// DisplayLocation определяет часовой пояс для показа времени по параметру запроса: room, user или имя IANA.
+// userZone - часовой пояс из профиля пользователя. nil означает местное время каждой комнаты.
+func DisplayLocation(param, userZone string) (*time.Location, error) {
+	switch param {
+	case "", DisplayZoneRoom:
+		return nil, nil
+	case DisplayZoneUser:
+		if userZone == "" {
+			return nil, nil
+		}
+		param = userZone
+	}
+	return LoadLocation(param)
+}
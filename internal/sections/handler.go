@@ -1 +1,290 @@
 package sections
+
+import (
+	"book_talk/internal/models"
+	"book_talk/internal/rooms"
+	mw "book_talk/middleware"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	SectionService *Service
+	RoomService    *rooms.Service
+}
+
+// Новый хэндлер для инициализации с сервисом
+func NewSectionsHandler(db *sql.DB) *Handler {
+	return &Handler{
+		SectionService: NewSectionsService(db),
+		RoomService:    rooms.NewRoomsService(db),
+	}
+}
+
+// sendSectionError отправляет ответ с кодом, соответствующим ошибке сервиса
+func sendSectionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrFloorNotFound), errors.Is(err, ErrSectionNotFound),
+		errors.Is(err, rooms.ErrRoomNotFound), errors.Is(err, rooms.ErrAddressNotFound):
+		mw.SendJSONResponse(w, &models.Response{Message: err.Error()}, http.StatusNotFound) // 404
+	case errors.Is(err, ErrInvalidFloor), errors.Is(err, ErrInvalidSection),
+		errors.Is(err, ErrFloorMismatch), errors.Is(err, ErrSectionMismatch):
+		mw.SendJSONResponse(w, &models.Response{Message: err.Error()}, http.StatusBadRequest) // 400
+	case errors.Is(err, ErrFloorExists), errors.Is(err, ErrSectionExists):
+		mw.SendJSONResponse(w, &models.Response{Message: err.Error()}, http.StatusConflict) // 409
+	default:
+		mw.SendJSONResponse(w, &models.Response{Message: "Внутренняя ошибка сервера: " + err.Error()}, http.StatusInternalServerError) // 500
+	}
+}
+
+// pathID извлекает идентификатор из пути запроса
+func pathID(w http.ResponseWriter, r *http.Request, what string) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id <= 0 {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный идентификатор " + what}, http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// queryID извлекает необязательный идентификатор из параметра запроса, 0 - параметр не задан
+func queryID(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, true
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil || id <= 0 {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректное значение " + name}, http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// GetTree возвращает здания с этажами, секциями и комнатами. Параметр addressId оставляет одно здание.
+func (h *Handler) GetTree(w http.ResponseWriter, r *http.Request) {
+	addressID, ok := queryID(w, r, "addressId")
+	if !ok {
+		return
+	}
+
+	buildings, err := h.SectionService.GetTree(addressID)
+	if err != nil {
+		sendSectionError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Структура зданий успешно получена",
+		Data:    map[string][]BuildingNode{"buildings": buildings},
+	}, http.StatusOK)
+}
+
+// GetFloors возвращает этажи. Параметр addressId оставляет этажи одного здания.
+func (h *Handler) GetFloors(w http.ResponseWriter, r *http.Request) {
+	addressID, ok := queryID(w, r, "addressId")
+	if !ok {
+		return
+	}
+
+	floors, err := h.SectionService.GetFloors(addressID)
+	if err != nil {
+		sendSectionError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Этажи успешно получены",
+		Data:    map[string][]models.Floor{"floors": floors},
+	}, http.StatusOK)
+}
+
+func (h *Handler) GetFloor(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "этажа")
+	if !ok {
+		return
+	}
+
+	floor, err := h.SectionService.GetFloor(id)
+	if err != nil {
+		sendSectionError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Этаж успешно получен",
+		Data:    map[string]models.Floor{"floor": *floor},
+	}, http.StatusOK)
+}
+
+func (h *Handler) CreateFloor(w http.ResponseWriter, r *http.Request) {
+	var floor models.Floor
+	if err := json.NewDecoder(r.Body).Decode(&floor); err != nil {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.SectionService.CreateFloor(floor)
+	if err != nil {
+		sendSectionError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Этаж создан",
+		Data:    map[string]models.Floor{"floor": *created},
+	}, http.StatusCreated)
+}
+
+func (h *Handler) UpdateFloor(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "этажа")
+	if !ok {
+		return
+	}
+
+	var floor models.Floor
+	if err := json.NewDecoder(r.Body).Decode(&floor); err != nil {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	updated, err := h.SectionService.UpdateFloor(id, floor)
+	if err != nil {
+		sendSectionError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Этаж обновлен",
+		Data:    map[string]models.Floor{"floor": *updated},
+	}, http.StatusOK)
+}
+
+func (h *Handler) DeleteFloor(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "этажа")
+	if !ok {
+		return
+	}
+
+	if err := h.SectionService.DeleteFloor(id); err != nil {
+		sendSectionError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{Message: "Этаж удален"}, http.StatusOK)
+}
+
+// GetSections возвращает секции. Параметры floorId и addressId оставляют секции одного этажа или здания.
+func (h *Handler) GetSections(w http.ResponseWriter, r *http.Request) {
+	floorID, ok := queryID(w, r, "floorId")
+	if !ok {
+		return
+	}
+	addressID, ok := queryID(w, r, "addressId")
+	if !ok {
+		return
+	}
+
+	sections, err := h.SectionService.GetSections(floorID, addressID)
+	if err != nil {
+		sendSectionError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Секции успешно получены",
+		Data:    map[string][]models.Section{"sections": sections},
+	}, http.StatusOK)
+}
+
+func (h *Handler) CreateSection(w http.ResponseWriter, r *http.Request) {
+	var section models.Section
+	if err := json.NewDecoder(r.Body).Decode(&section); err != nil {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.SectionService.CreateSection(section)
+	if err != nil {
+		sendSectionError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Секция создана",
+		Data:    map[string]models.Section{"section": *created},
+	}, http.StatusCreated)
+}
+
+func (h *Handler) UpdateSection(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "секции")
+	if !ok {
+		return
+	}
+
+	var section models.Section
+	if err := json.NewDecoder(r.Body).Decode(&section); err != nil {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	updated, err := h.SectionService.UpdateSection(id, section)
+	if err != nil {
+		sendSectionError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Секция обновлена",
+		Data:    map[string]models.Section{"section": *updated},
+	}, http.StatusOK)
+}
+
+func (h *Handler) DeleteSection(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "секции")
+	if !ok {
+		return
+	}
+
+	if err := h.SectionService.DeleteSection(id); err != nil {
+		sendSectionError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{Message: "Секция удалена"}, http.StatusOK)
+}
+
+// SetRoomLocation помещает комнату на этаж и в секцию. Тело запроса - {"floorId": 1, "sectionId": 2}.
+func (h *Handler) SetRoomLocation(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "комнаты")
+	if !ok {
+		return
+	}
+
+	var location RoomLocation
+	if err := json.NewDecoder(r.Body).Decode(&location); err != nil {
+		mw.SendJSONResponse(w, &models.Response{Message: "Некорректный JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.SectionService.SetRoomLocation(id, location); err != nil {
+		sendSectionError(w, err)
+		return
+	}
+
+	room, err := h.RoomService.GetRoom(id)
+	if err != nil {
+		sendSectionError(w, err)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Расположение комнаты обновлено",
+		Data:    map[string]models.Room{"room": *room},
+	}, http.StatusOK)
+}
@@ -1 +1,404 @@
 package sections
+
+import (
+	"book_talk/internal/models"
+	"book_talk/internal/rooms"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+type Service struct {
+	DB *sql.DB
+}
+
+func NewSectionsService(db *sql.DB) *Service {
+	return &Service{DB: db}
+}
+
+var (
+	ErrFloorNotFound   = errors.New("этаж не найден")
+	ErrSectionNotFound = errors.New("секция не найдена")
+	ErrInvalidFloor    = errors.New("у этажа должны быть указаны здание и название")
+	ErrInvalidSection  = errors.New("у секции должны быть указаны этаж и название")
+	ErrFloorExists     = errors.New("этаж с таким номером в здании уже есть")
+	ErrSectionExists   = errors.New("секция с таким названием на этаже уже есть")
+	ErrFloorMismatch   = errors.New("этаж находится в другом здании, чем комната")
+	ErrSectionMismatch = errors.New("секция находится на другом этаже")
+)
+
+// RoomSummary - комната в дереве здания
+type RoomSummary struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Capacity int    `json:"capacity"`
+	Active   bool   `json:"active"`
+}
+
+// SectionNode - секция этажа с ее комнатами
+type SectionNode struct {
+	models.Section
+	Rooms []RoomSummary `json:"rooms"`
+}
+
+// FloorNode - этаж с секциями и комнатами, не отнесенными ни к одной секции
+type FloorNode struct {
+	models.Floor
+	Sections []SectionNode `json:"sections"`
+	Rooms    []RoomSummary `json:"rooms"`
+}
+
+// BuildingNode - здание (адрес) с этажами и комнатами, у которых этаж не указан
+type BuildingNode struct {
+	models.Address
+	Floors []FloorNode   `json:"floors"`
+	Rooms  []RoomSummary `json:"rooms"`
+}
+
+// GetTree возвращает иерархию здание → этаж → секция → комната. addressID ограничивает дерево одним зданием.
+// Здания упорядочены по городу и адресу, этажи - по номеру, секции и комнаты - по названию.
+func (s *Service) GetTree(addressID int) ([]BuildingNode, error) {
+	rows, err := s.DB.Query(`
+		SELECT id, region, city, street, building, time_zone FROM address
+		WHERE $1 = 0 OR id = $1
+		ORDER BY city, street, building, id
+	`, addressID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении зданий: %v", err)
+	}
+	defer rows.Close()
+
+	buildings := []BuildingNode{}
+	buildingIndex := map[int]int{}
+	for rows.Next() {
+		var building BuildingNode
+		address := &building.Address
+		if err := rows.Scan(&address.ID, &address.Region, &address.City, &address.Street, &address.Building, &address.TimeZone); err != nil {
+			return nil, fmt.Errorf("ошибка при обработке зданий: %v", err)
+		}
+		building.Floors, building.Rooms = []FloorNode{}, []RoomSummary{}
+		buildingIndex[address.ID] = len(buildings)
+		buildings = append(buildings, building)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при обработке зданий: %v", err)
+	}
+	if addressID != 0 && len(buildings) == 0 {
+		return nil, rooms.ErrAddressNotFound
+	}
+
+	// Этажи и секции собираются в плоские списки, а в дерево переносятся в конце,
+	// чтобы указатели на элементы не устаревали при росте срезов
+	floors, err := s.GetFloors(addressID)
+	if err != nil {
+		return nil, err
+	}
+	floorIndex := map[int]int{}
+	floorNodes := make([]FloorNode, len(floors))
+	for i, floor := range floors {
+		floorNodes[i] = FloorNode{Floor: floor, Sections: []SectionNode{}, Rooms: []RoomSummary{}}
+		floorIndex[floor.ID] = i
+	}
+
+	sections, err := s.GetSections(0, addressID)
+	if err != nil {
+		return nil, err
+	}
+	sectionIndex := map[int]int{}
+	sectionNodes := make([]SectionNode, len(sections))
+	for i, section := range sections {
+		sectionNodes[i] = SectionNode{Section: section, Rooms: []RoomSummary{}}
+		sectionIndex[section.ID] = i
+	}
+
+	rows, err = s.DB.Query(`
+		SELECT id, name, capacity, COALESCE(active, true), address_id, floor_id, section_id FROM room
+		WHERE address_id IS NOT NULL AND ($1 = 0 OR address_id = $1)
+		ORDER BY name, id
+	`, addressID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении комнат: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var room RoomSummary
+		var roomAddressID int
+		var floorID, sectionID sql.NullInt64
+		if err := rows.Scan(&room.ID, &room.Name, &room.Capacity, &room.Active, &roomAddressID, &floorID, &sectionID); err != nil {
+			return nil, fmt.Errorf("ошибка при обработке комнат: %v", err)
+		}
+		if i, ok := sectionIndex[int(sectionID.Int64)]; sectionID.Valid && ok {
+			sectionNodes[i].Rooms = append(sectionNodes[i].Rooms, room)
+		} else if i, ok := floorIndex[int(floorID.Int64)]; floorID.Valid && ok {
+			floorNodes[i].Rooms = append(floorNodes[i].Rooms, room)
+		} else if i, ok := buildingIndex[roomAddressID]; ok {
+			buildings[i].Rooms = append(buildings[i].Rooms, room)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при обработке комнат: %v", err)
+	}
+
+	for _, section := range sectionNodes {
+		if i, ok := floorIndex[section.FloorID]; ok {
+			floorNodes[i].Sections = append(floorNodes[i].Sections, section)
+		}
+	}
+	for _, floor := range floorNodes {
+		if i, ok := buildingIndex[floor.AddressID]; ok {
+			buildings[i].Floors = append(buildings[i].Floors, floor)
+		}
+	}
+
+	return buildings, nil
+}
+
+// GetFloors возвращает этажи здания addressID или всех зданий, если он равен нулю
+func (s *Service) GetFloors(addressID int) ([]models.Floor, error) {
+	rows, err := s.DB.Query(`
+		SELECT id, address_id, level, name FROM floor
+		WHERE $1 = 0 OR address_id = $1
+		ORDER BY address_id, level
+	`, addressID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении этажей: %v", err)
+	}
+	defer rows.Close()
+
+	floors := []models.Floor{}
+	for rows.Next() {
+		var floor models.Floor
+		if err := rows.Scan(&floor.ID, &floor.AddressID, &floor.Level, &floor.Name); err != nil {
+			return nil, fmt.Errorf("ошибка при обработке этажей: %v", err)
+		}
+		floors = append(floors, floor)
+	}
+
+	return floors, rows.Err()
+}
+
+// GetFloor возвращает этаж
+func (s *Service) GetFloor(id int) (*models.Floor, error) {
+	var floor models.Floor
+	err := s.DB.QueryRow(`SELECT id, address_id, level, name FROM floor WHERE id = $1`, id).
+		Scan(&floor.ID, &floor.AddressID, &floor.Level, &floor.Name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrFloorNotFound
+		}
+		return nil, fmt.Errorf("ошибка при получении этажа: %v", err)
+	}
+	return &floor, nil
+}
+
+// floorError переводит ошибку сохранения этажа в ошибку сервиса
+func floorError(err error, action string) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "23505": // unique_violation
+			return ErrFloorExists
+		case "23503": // foreign_key_violation
+			return rooms.ErrAddressNotFound
+		}
+	}
+	return fmt.Errorf("не удалось %s этаж: %v", action, err)
+}
+
+// CreateFloor добавляет этаж в здание
+func (s *Service) CreateFloor(floor models.Floor) (*models.Floor, error) {
+	floor.Name = strings.TrimSpace(floor.Name)
+	if floor.AddressID <= 0 || floor.Name == "" {
+		return nil, ErrInvalidFloor
+	}
+
+	err := s.DB.QueryRow(`INSERT INTO floor (address_id, level, name) VALUES ($1, $2, $3) RETURNING id`,
+		floor.AddressID, floor.Level, floor.Name).Scan(&floor.ID)
+	if err != nil {
+		return nil, floorError(err, "сохранить")
+	}
+	return &floor, nil
+}
+
+// UpdateFloor изменяет номер и название этажа. Здание этажа не меняется.
+func (s *Service) UpdateFloor(id int, floor models.Floor) (*models.Floor, error) {
+	floor.Name = strings.TrimSpace(floor.Name)
+	if floor.Name == "" {
+		return nil, ErrInvalidFloor
+	}
+
+	err := s.DB.QueryRow(`UPDATE floor SET level = $1, name = $2 WHERE id = $3 RETURNING id, address_id`,
+		floor.Level, floor.Name, id).Scan(&floor.ID, &floor.AddressID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrFloorNotFound
+		}
+		return nil, floorError(err, "обновить")
+	}
+	return &floor, nil
+}
+
+// DeleteFloor удаляет этаж вместе с его секциями. Комнаты этажа остаются в здании без этажа.
+func (s *Service) DeleteFloor(id int) error {
+	result, err := s.DB.Exec(`DELETE FROM floor WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("не удалось удалить этаж: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrFloorNotFound
+	}
+	return nil
+}
+
+// GetSections возвращает секции этажа floorID; если он равен нулю - секции здания addressID или всех зданий
+func (s *Service) GetSections(floorID, addressID int) ([]models.Section, error) {
+	rows, err := s.DB.Query(`
+		SELECT sc.id, sc.floor_id, sc.name FROM section sc
+		JOIN floor fl ON fl.id = sc.floor_id
+		WHERE ($1 = 0 OR sc.floor_id = $1) AND ($2 = 0 OR fl.address_id = $2)
+		ORDER BY fl.address_id, fl.level, sc.name
+	`, floorID, addressID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении секций: %v", err)
+	}
+	defer rows.Close()
+
+	sections := []models.Section{}
+	for rows.Next() {
+		var section models.Section
+		if err := rows.Scan(&section.ID, &section.FloorID, &section.Name); err != nil {
+			return nil, fmt.Errorf("ошибка при обработке секций: %v", err)
+		}
+		sections = append(sections, section)
+	}
+
+	return sections, rows.Err()
+}
+
+// sectionError переводит ошибку сохранения секции в ошибку сервиса
+func sectionError(err error, action string) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "23505": // unique_violation
+			return ErrSectionExists
+		case "23503": // foreign_key_violation
+			return ErrFloorNotFound
+		}
+	}
+	return fmt.Errorf("не удалось %s секцию: %v", action, err)
+}
+
+// CreateSection добавляет секцию на этаж
+func (s *Service) CreateSection(section models.Section) (*models.Section, error) {
+	section.Name = strings.TrimSpace(section.Name)
+	if section.FloorID <= 0 || section.Name == "" {
+		return nil, ErrInvalidSection
+	}
+
+	err := s.DB.QueryRow(`INSERT INTO section (floor_id, name) VALUES ($1, $2) RETURNING id`,
+		section.FloorID, section.Name).Scan(&section.ID)
+	if err != nil {
+		return nil, sectionError(err, "сохранить")
+	}
+	return &section, nil
+}
+
+// UpdateSection переименовывает секцию. Этаж секции не меняется.
+func (s *Service) UpdateSection(id int, section models.Section) (*models.Section, error) {
+	section.Name = strings.TrimSpace(section.Name)
+	if section.Name == "" {
+		return nil, ErrInvalidSection
+	}
+
+	err := s.DB.QueryRow(`UPDATE section SET name = $1 WHERE id = $2 RETURNING id, floor_id`,
+		section.Name, id).Scan(&section.ID, &section.FloorID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSectionNotFound
+		}
+		return nil, sectionError(err, "обновить")
+	}
+	return &section, nil
+}
+
+// DeleteSection удаляет секцию. Комнаты секции остаются на этаже без секции.
+func (s *Service) DeleteSection(id int) error {
+	result, err := s.DB.Exec(`DELETE FROM section WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("не удалось удалить секцию: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrSectionNotFound
+	}
+	return nil
+}
+
+// RoomLocation - этаж и секция, на которые помещается комната. Нулевые значения убирают комнату с этажа или из секции.
+type RoomLocation struct {
+	FloorID   int `json:"floorId"`
+	SectionID int `json:"sectionId"`
+}
+
+// SetRoomLocation помещает комнату на этаж ее здания и, если указана секция, в секцию этого этажа.
+// Если указана только секция, этаж берется из нее.
+func (s *Service) SetRoomLocation(roomID int, location RoomLocation) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("не удалось начать транзакцию: %v", err)
+	}
+	defer tx.Rollback()
+
+	var addressID sql.NullInt64
+	err = tx.QueryRow(`SELECT address_id FROM room WHERE id = $1 FOR UPDATE`, roomID).Scan(&addressID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return rooms.ErrRoomNotFound
+		}
+		return fmt.Errorf("ошибка при получении комнаты: %v", err)
+	}
+
+	if location.SectionID != 0 {
+		var floorID int
+		err := tx.QueryRow(`SELECT floor_id FROM section WHERE id = $1`, location.SectionID).Scan(&floorID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrSectionNotFound
+			}
+			return fmt.Errorf("ошибка при получении секции: %v", err)
+		}
+		if location.FloorID != 0 && location.FloorID != floorID {
+			return ErrSectionMismatch
+		}
+		location.FloorID = floorID
+	}
+
+	if location.FloorID != 0 {
+		var floorAddressID int
+		err := tx.QueryRow(`SELECT address_id FROM floor WHERE id = $1`, location.FloorID).Scan(&floorAddressID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrFloorNotFound
+			}
+			return fmt.Errorf("ошибка при получении этажа: %v", err)
+		}
+		if !addressID.Valid || int(addressID.Int64) != floorAddressID {
+			return ErrFloorMismatch
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE room SET floor_id = NULLIF($1, 0), section_id = NULLIF($2, 0) WHERE id = $3`,
+		location.FloorID, location.SectionID, roomID)
+	if err != nil {
+		return fmt.Errorf("не удалось обновить расположение комнаты: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
+	}
+	return nil
+}
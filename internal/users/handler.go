@@ -2,9 +2,11 @@ package users
 
 import (
 	"book_talk/internal/models"
+	"book_talk/internal/rooms"
 	mw "book_talk/middleware"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"strconv"
@@ -89,8 +91,27 @@ func (h *Handler) GetUserBookings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Часовой пояс для показа времени: room (по умолчанию), user или имя IANA
+	param := r.URL.Query().Get("timeZone")
+	var userZone string
+	if param == rooms.DisplayZoneUser {
+		if userZone, err = h.UserService.GetTimeZone(email); err != nil {
+			mw.SendJSONResponse(w, &models.Response{
+				Message: err.Error(),
+			}, http.StatusInternalServerError)
+			return
+		}
+	}
+	loc, err := rooms.DisplayLocation(param, userZone)
+	if err != nil {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: err.Error(),
+		}, http.StatusBadRequest)
+		return
+	}
+
 	// Получаем данные о пользователе и его бронированиях
-	bookings, err := h.UserService.GetUserBookings(email, page, size)
+	bookings, err := h.UserService.GetUserBookings(email, page, size, loc)
 	if err != nil {
 		// Если произошла ошибка в сервисе, отправляем ошибку 500
 		mw.SendJSONResponse(w, &models.Response{
@@ -108,6 +129,15 @@ func (h *Handler) GetUserBookings(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	email, ok := r.Context().Value("email").(string)
+	if !ok {
+		// Если email отсутствует в контексте, отправляем ошибку 401
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Unauthorized",
+		}, http.StatusUnauthorized)
+		return
+	}
+
 	var updatedUser models.UserDTO
 	if err := json.NewDecoder(r.Body).Decode(&updatedUser); err != nil {
 		mw.SendJSONResponse(w, &models.Response{
@@ -117,7 +147,7 @@ func (h *Handler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Обновляем пользователя
-	user, err := h.UserService.UpdateUser(updatedUser)
+	user, err := h.UserService.UpdateUser(email, updatedUser)
 	if err != nil {
 		// Обработка ошибок с описанием ошибки
 		mw.SendJSONResponse(w, &models.Response{
@@ -135,6 +165,44 @@ func (h *Handler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	mw.SendJSONResponse(w, response, http.StatusOK)
 }
 
+// SetTimeZone сохраняет часовой пояс, в котором пользователю показывается время
+func (h *Handler) SetTimeZone(w http.ResponseWriter, r *http.Request) {
+	email, ok := r.Context().Value("email").(string)
+	if !ok {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Unauthorized",
+		}, http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		TimeZone string `json:"timeZone"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		mw.SendJSONResponse(w, &models.Response{
+			Message: "Invalid request body",
+		}, http.StatusBadRequest)
+		return
+	}
+
+	timeZone, err := h.UserService.SetTimeZone(email, body.TimeZone)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, rooms.ErrInvalidTimeZone) {
+			status = http.StatusBadRequest
+		}
+		mw.SendJSONResponse(w, &models.Response{
+			Message: err.Error(),
+		}, status)
+		return
+	}
+
+	mw.SendJSONResponse(w, &models.Response{
+		Message: "Часовой пояс сохранен",
+		Data:    map[string]string{"timeZone": timeZone},
+	}, http.StatusOK)
+}
+
 func (h *Handler) GetUserImage(w http.ResponseWriter, r *http.Request) {
 	// Извлекаем email пользователя из контекста
 	email, ok := r.Context().Value("email").(string)
@@ -3,6 +3,7 @@ package users
 import (
 	"book_talk/internal/auth"
 	"book_talk/internal/models"
+	"book_talk/internal/rooms"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -11,6 +12,8 @@ import (
 	"mime"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 )
 
 type Service struct {
@@ -109,12 +112,12 @@ func (s *Service) GetUser(email string) (*models.Response, error) {
 	var departmentID sql.NullInt64
 
 	// Запрос для получения данных пользователя
-	query := `SELECT email, first_name, last_name, password, department_id, image, theme, 
+	query := `SELECT email, first_name, last_name, password, department_id, image, theme, time_zone,
                      credentials_non_expired, account_non_expired, account_non_locked, enabled
               FROM users WHERE email = $1`
 	err := s.DB.QueryRow(query, email).Scan(
 		&userDTO.Email, &userDTO.FirstName, &userDTO.LastName, &userDTO.Password, &departmentID,
-		&userDTO.Image, &userDTO.Theme, &userDTO.CredentialsNonExpired, &userDTO.AccountNonExpired,
+		&userDTO.Image, &userDTO.Theme, &userDTO.TimeZone, &userDTO.CredentialsNonExpired, &userDTO.AccountNonExpired,
 		&userDTO.AccountNonLocked, &userDTO.Enabled,
 	)
 	if err != nil {
@@ -137,7 +140,7 @@ func (s *Service) GetUser(email string) (*models.Response, error) {
 	}
 
 	// Получение данных о бронированиях
-	bookingsQuery := `SELECT id, room_id, user_email, time FROM booking WHERE user_email = $1`
+	bookingsQuery := `SELECT id, room_id, user_email, time, start_time, end_time, status FROM booking WHERE user_email = $1`
 	rows, err := s.DB.Query(bookingsQuery, userDTO.Email)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка при получении данных о бронированиях: %v", err)
@@ -146,9 +149,11 @@ func (s *Service) GetUser(email string) (*models.Response, error) {
 
 	for rows.Next() {
 		var booking models.Booking
-		if err := rows.Scan(&booking.ID, &booking.Room.ID, &booking.User.Email, &booking.Time); err != nil {
+		var start, end sql.NullTime
+		if err := rows.Scan(&booking.ID, &booking.Room.ID, &booking.User.Email, &booking.Time, &start, &end, &booking.Status); err != nil {
 			return nil, fmt.Errorf("ошибка при обработке данных о бронированиях: %v", err)
 		}
+		booking.Start, booking.End = start.Time, end.Time
 		booking.User = userDTO
 		userDTO.Bookings = append(userDTO.Bookings, booking)
 	}
@@ -176,12 +181,20 @@ func (s *Service) GetUser(email string) (*models.Response, error) {
 	}, nil
 }
 
-func (s *Service) GetUserBookings(email string, page, size int) ([]models.Booking, error) {
+// GetUserBookings возвращает бронирования пользователя и бронирования, в которые он приглашен участником.
+// Владелец бронирования указывается в поле User. Время показывается в часовом поясе loc,
+// а если он не задан - по местному времени комнаты.
+func (s *Service) GetUserBookings(email string, page, size int, loc *time.Location) ([]models.Booking, error) {
 	var bookings []models.Booking
 
 	// Пагинация для бронирований
 	offset := page * size
-	bookingsQuery := `SELECT id, room_id, user_email, time FROM booking WHERE user_email = $1 LIMIT $2 OFFSET $3`
+	bookingsQuery := `SELECT b.id, b.room_id, b.user_email, b.time, b.start_time, b.end_time, b.status, COALESCE(a.time_zone, '')
+		FROM booking b
+		JOIN room r ON r.id = b.room_id
+		LEFT JOIN address a ON a.id = r.address_id
+		WHERE b.user_email = $1 OR b.id IN (SELECT booking_id FROM booking_attendee WHERE user_email = $1)
+		ORDER BY b.start_time DESC NULLS LAST, b.id DESC LIMIT $2 OFFSET $3`
 	rows, err := s.DB.Query(bookingsQuery, email, size, offset)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка при получении данных о бронированиях: %v", err)
@@ -191,11 +204,17 @@ func (s *Service) GetUserBookings(email string, page, size int) ([]models.Bookin
 	// Обрабатываем бронирования
 	for rows.Next() {
 		var booking models.Booking
-		if err := rows.Scan(&booking.ID, &booking.Room.ID, &booking.User.Email, &booking.Time); err != nil {
+		var start, end sql.NullTime
+		if err := rows.Scan(&booking.ID, &booking.Room.ID, &booking.User.Email, &booking.Time, &start, &end, &booking.Status,
+			&booking.Room.Address.TimeZone); err != nil {
 			return nil, fmt.Errorf("ошибка при чтении данных о бронированиях: %v", err)
 		}
-		// Присваиваем объект пользователя (можно дополнительно извлечь его данные из базы, если нужно)
-		booking.User = models.UserDTO{Email: email} // Простейшее присваивание
+		booking.Start, booking.End = start.Time, end.Time
+		if loc != nil {
+			booking.InLocation(loc)
+		} else {
+			booking.InLocation(rooms.Location(booking.Room))
+		}
 		bookings = append(bookings, booking)
 	}
 
@@ -207,72 +226,58 @@ func (s *Service) GetUserBookings(email string, page, size int) ([]models.Bookin
 	return bookings, nil
 }
 
-func (s *Service) UpdateUser(updatedUser models.UserDTO) (*models.UserDTO, error) {
-	// Начинаем транзакцию для атомарных изменений
-	tx, err := s.DB.Begin()
-	if err != nil {
-		return nil, fmt.Errorf("не удалось начать транзакцию: %v", err)
+// GetTimeZone возвращает часовой пояс из профиля пользователя, пустая строка - не задан
+func (s *Service) GetTimeZone(email string) (string, error) {
+	var timeZone string
+	err := s.DB.QueryRow(`SELECT time_zone FROM users WHERE email = $1`, email).Scan(&timeZone)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("ошибка при получении часового пояса пользователя: %v", err)
+	}
+	return timeZone, nil
+}
+
+// SetTimeZone сохраняет часовой пояс IANA, в котором пользователю показывается время.
+// Пустая строка сбрасывает настройку: время показывается по местному времени комнаты.
+func (s *Service) SetTimeZone(email, timeZone string) (string, error) {
+	timeZone = strings.TrimSpace(timeZone)
+	if timeZone != "" {
+		loc, err := rooms.LoadLocation(timeZone)
+		if err != nil {
+			return "", err
+		}
+		timeZone = loc.String()
 	}
-	defer tx.Rollback() // Откатить изменения в случае ошибки
 
-	// Обновляем информацию о пользователе
+	if _, err := s.DB.Exec(`UPDATE users SET time_zone = $1 WHERE email = $2`, timeZone, email); err != nil {
+		return "", fmt.Errorf("не удалось сохранить часовой пояс: %v", err)
+	}
+	return timeZone, nil
+}
+
+// UpdateUser обновляет профиль пользователя email: имя, департамент, тему и изображение.
+// Email берется из токена, а не из тела запроса. Роли, бронирования и пароль здесь не меняются:
+// для них есть отдельные проверяемые операции, в том числе ChangePassword.
+func (s *Service) UpdateUser(email string, updatedUser models.UserDTO) (*models.UserDTO, error) {
 	query := `
 		UPDATE users
-		SET first_name = $1, last_name = $2, password = $3, department_id = $4, theme = $5, image = $6
-		WHERE email = $7
-		RETURNING email, first_name, last_name, password, department_id, image, theme, credentials_non_expired, account_non_expired, account_non_locked, enabled
+		SET first_name = $1, last_name = $2, department_id = $3, theme = $4, image = $5
+		WHERE email = $6
+		RETURNING email, first_name, last_name, department_id, image, theme, credentials_non_expired, account_non_expired, account_non_locked, enabled
 	`
 	var user models.UserDTO
-	err = tx.QueryRow(query, updatedUser.FirstName, updatedUser.LastName, updatedUser.Password,
-		updatedUser.Department.ID, updatedUser.Theme, updatedUser.Image, updatedUser.Email).Scan(
-		&user.Email, &user.FirstName, &user.LastName, &user.Password, &user.Department.ID,
+	err := s.DB.QueryRow(query, updatedUser.FirstName, updatedUser.LastName,
+		updatedUser.Department.ID, updatedUser.Theme, updatedUser.Image, email).Scan(
+		&user.Email, &user.FirstName, &user.LastName, &user.Department.ID,
 		&user.Image, &user.Theme, &user.CredentialsNonExpired, &user.AccountNonExpired,
 		&user.AccountNonLocked, &user.Enabled,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("не удалось обновить пользователя: %v", err)
-	}
-
-	// Обновляем департамент
-	_, err = tx.Exec(`UPDATE department SET name = $1, short_name = $2, color = $3 WHERE id = $4`,
-		updatedUser.Department.Name, updatedUser.Department.ShortName, updatedUser.Department.Color, updatedUser.Department.ID)
-	if err != nil {
-		return nil, fmt.Errorf("не удалось обновить департамент: %v", err)
-	}
-
-	// Обновляем бронирования
-	_, err = tx.Exec(`DELETE FROM user_booking WHERE user_email = $1`, updatedUser.Email)
-	if err != nil {
-		return nil, fmt.Errorf("не удалось удалить старые бронирования: %v", err)
-	}
-
-	for _, booking := range updatedUser.Bookings {
-		_, err = tx.Exec(`INSERT INTO user_booking (user_email, booking_id) VALUES ($1, $2)`, updatedUser.Email, booking.ID)
-		if err != nil {
-			return nil, fmt.Errorf("не удалось вставить новое бронирование: %v", err)
-		}
-	}
-
-	// Обновляем роли
-	_, err = tx.Exec(`DELETE FROM user_role WHERE user_email = $1`, updatedUser.Email)
-	if err != nil {
-		return nil, fmt.Errorf("не удалось удалить старые роли: %v", err)
-	}
-
-	for _, role := range updatedUser.Roles {
-		_, err = tx.Exec(`INSERT INTO user_role (user_email, role_id) VALUES ($1, $2)`, updatedUser.Email, role.ID)
-		if err != nil {
-			return nil, fmt.Errorf("не удалось вставить новую роль: %v", err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("пользователь не найден")
 		}
+		return nil, fmt.Errorf("не удалось обновить пользователя: %v", err)
 	}
 
-	// Завершаем транзакцию
-	err = tx.Commit()
-	if err != nil {
-		return nil, fmt.Errorf("не удалось подтвердить транзакцию: %v", err)
-	}
-
-	// Возвращаем обновленного пользователя
 	return &user, nil
 }
 
@@ -428,7 +433,18 @@ func (s *Service) ChangePassword(oldPassword, newPassword, email string) (*model
 
 	isValid, errPass := auth.IsValidPassword(newPassword)
 	if !isValid {
-		return nil, fmt.Errorf("invalid password: %v", errPass)
+		return &models.Response{
+			Message: "Invalid new password: " + errPass.Error(),
+			Data:    nil,
+		}, fmt.Errorf("invalid password: %v", errPass)
+	}
+
+	// Истекший пароль нужно заменить другим
+	if bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(newPassword)) == nil {
+		return &models.Response{
+			Message: "New password must differ from the current one",
+			Data:    nil,
+		}, fmt.Errorf("new password must differ from the current one")
 	}
 
 	// Хэшируем новый пароль
@@ -440,8 +456,19 @@ func (s *Service) ChangePassword(oldPassword, newPassword, email string) (*model
 		}, err
 	}
 
-	// Обновляем пароль в базе данных
-	_, err = s.DB.Exec(`UPDATE users SET password = $1 WHERE email = $2`, string(newHashedPassword), email)
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return &models.Response{
+			Message: "Failed to update password",
+			Data:    nil,
+		}, err
+	}
+	defer tx.Rollback()
+
+	// Обновляем пароль в базе данных. Новый пароль снимает пометку об истекших учетных данных.
+	_, err = tx.Exec(`
+		UPDATE users SET password = $1, credentials_non_expired = true, password_changed_at = now() WHERE email = $2
+	`, string(newHashedPassword), email)
 	if err != nil {
 		return &models.Response{
 			Message: "Failed to update password",
@@ -449,9 +476,24 @@ func (s *Service) ChangePassword(oldPassword, newPassword, email string) (*model
 		}, err
 	}
 
+	// Сеансы, открытые со старым паролем, завершаются, как и при сбросе пароля
+	if err := auth.RevokeUserSessions(tx, email); err != nil {
+		return &models.Response{
+			Message: "Failed to update password",
+			Data:    nil,
+		}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return &models.Response{
+			Message: "Failed to update password",
+			Data:    nil,
+		}, err
+	}
+
 	// Возвращаем успешный ответ
 	return &models.Response{
-		Message: "Password changed successfully",
+		Message: "Password changed successfully, please log in again",
 		Data:    nil,
 	}, nil
 }
@@ -2,11 +2,21 @@ package main
 
 import (
 	"book_talk/internal/auth"
+	"book_talk/internal/bookings"
+	"book_talk/internal/calendar"
 	"book_talk/internal/database"
+	"book_talk/internal/mail"
+	"book_talk/internal/roles"
+	"book_talk/internal/rooms"
+	"book_talk/internal/sections"
 	"book_talk/internal/users"
 	"book_talk/middleware"
+	"context"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -18,8 +28,59 @@ func main() {
 	}
 	defer database.Close()
 
+	if err := db.Migrate(database); err != nil {
+		log.Fatal("Ошибка миграции БД:", err)
+	}
+
 	authHandler := auth.NewAuthHandler(database)
+	mailer, err := mail.NewSenderFromEnv()
+	if err != nil {
+		log.Fatal("Ошибка настройки почты:", err)
+	}
+	authHandler.AuthService.Mailer = mailer
+	if baseURL := os.Getenv("APP_BASE_URL"); baseURL != "" {
+		authHandler.AuthService.BaseURL = baseURL
+	}
+	authHandler.AuthService.VerificationTTL = durationEnv("EMAIL_VERIFICATION_TTL", auth.DefaultVerificationTTL)
+	authHandler.AuthService.PasswordResetTTL = durationEnv("PASSWORD_RESET_TTL", auth.DefaultPasswordResetTTL)
+	authHandler.AuthService.Lockout = auth.LockoutPolicy{
+		MaxAttempts:   intEnv("LOGIN_MAX_ATTEMPTS", auth.DefaultLockoutPolicy.MaxAttempts),
+		MaxIPAttempts: intEnv("LOGIN_MAX_IP_ATTEMPTS", auth.DefaultLockoutPolicy.MaxIPAttempts),
+		Window:        durationEnv("LOGIN_ATTEMPT_WINDOW", auth.DefaultLockoutPolicy.Window),
+	}
+	// PASSWORD_MAX_AGE=0 - срок действия пароля не ограничен
+	passwordMaxAge := time.Duration(0)
+	if os.Getenv("PASSWORD_MAX_AGE") != "0" {
+		passwordMaxAge = durationEnv("PASSWORD_MAX_AGE", auth.DefaultPasswordMaxAge)
+	}
+	authHandler.AuthService.PasswordMaxAge = passwordMaxAge
+	// LOGIN_LOCKOUT_DURATION=0 - аккаунт остается заблокированным до разблокировки администратором
+	if os.Getenv("LOGIN_LOCKOUT_DURATION") != "0" {
+		authHandler.AuthService.Lockout.Duration = durationEnv("LOGIN_LOCKOUT_DURATION", auth.DefaultLockoutPolicy.Duration)
+	}
 	usersHandler := users.NewUsersHandler(database)
+	roomsHandler := rooms.NewRoomsHandler(database)
+	sectionsHandler := sections.NewSectionsHandler(database)
+	bookingsHandler := bookings.NewBookingsHandler(database)
+	calendarHandler := calendar.NewCalendarHandler(database)
+	calendarHandler.CalendarService.PasswordMaxAge = passwordMaxAge
+	// Маршруты управления справочниками и пользователями доступны только администраторам
+	requireAdmin := mw.RequireAdmin(roles.NewRolesService(database))
+
+	// Фоновое освобождение бронирований, в которых никто не отметился о приходе
+	noShowGrace := durationEnv("NO_SHOW_GRACE_PERIOD", 15*time.Minute)
+	noShowInterval := durationEnv("NO_SHOW_CHECK_INTERVAL", time.Minute)
+	go bookingsHandler.BookingService.RunNoShowReleaser(context.Background(), noShowInterval, noShowGrace)
+
+	// Освободившиеся интервалы предлагаются листу ожидания на ограниченное время
+	bookingsHandler.BookingService.WaitlistOfferTTL = durationEnv("WAITLIST_OFFER_TTL", bookings.DefaultWaitlistOfferTTL)
+	waitlistInterval := durationEnv("WAITLIST_CHECK_INTERVAL", time.Minute)
+	go bookingsHandler.BookingService.RunWaitlistExpirer(context.Background(), waitlistInterval)
+
+	// Бронирования комнат с согласованием, по которым не приняли решение в срок, освобождают комнату
+	bookingsHandler.BookingService.ApprovalTTL = durationEnv("APPROVAL_TTL", bookings.DefaultApprovalTTL)
+	approvalInterval := durationEnv("APPROVAL_CHECK_INTERVAL", time.Minute)
+	go bookingsHandler.BookingService.RunApprovalExpirer(context.Background(), approvalInterval)
 
 	// Создаем основной роутер
 	r := mux.NewRouter()
@@ -28,7 +89,13 @@ func main() {
 	authRouter := r.PathPrefix("/api/v1/auth").Subrouter()
 	authRouter.HandleFunc("/signup", authHandler.Register).Methods("POST")
 	authRouter.HandleFunc("/login", authHandler.Login).Methods("POST")
-	authRouter.HandleFunc("/refresh", authHandler.Refresh).Methods("GET")
+	authRouter.HandleFunc("/verify-email", authHandler.VerifyEmail).Methods("GET", "POST")
+	authRouter.HandleFunc("/verify-email/resend", authHandler.ResendVerification).Methods("POST")
+	authRouter.HandleFunc("/password-reset/request", authHandler.RequestPasswordReset).Methods("POST")
+	authRouter.HandleFunc("/password-reset/confirm", authHandler.ConfirmPasswordReset).Methods("POST")
+	authRouter.HandleFunc("/refresh", authHandler.Refresh).Methods("GET", "POST")
+	authRouter.HandleFunc("/logout", mw.Protect(authHandler.Logout)).Methods("POST")
+	authRouter.HandleFunc("/logout-all", mw.Protect(authHandler.LogoutAll)).Methods("POST")
 
 	// Группа маршрутов для пользователей
 	usersRouter := r.PathPrefix("/api/v1").Subrouter()
@@ -36,13 +103,131 @@ func main() {
 	usersRouter.HandleFunc("/me", mw.Protect(usersHandler.UpdateUser)).Methods("PUT")
 	usersRouter.HandleFunc("/me", mw.Protect(usersHandler.DeleteUser)).Methods("DELETE")
 	usersRouter.HandleFunc("/me/bookings", mw.Protect(usersHandler.GetUserBookings)).Methods("GET")
+	usersRouter.HandleFunc("/me/quota", mw.Protect(bookingsHandler.GetQuotaUsage)).Methods("GET")
+	usersRouter.HandleFunc("/me/delegates", mw.Protect(bookingsHandler.GetDelegations)).Methods("GET")
+	usersRouter.HandleFunc("/me/delegates", mw.Protect(bookingsHandler.GrantDelegation)).Methods("POST")
+	usersRouter.HandleFunc("/me/delegates/{email}", mw.Protect(bookingsHandler.RevokeDelegation)).Methods("DELETE")
+	usersRouter.HandleFunc("/me/time-zone", mw.Protect(usersHandler.SetTimeZone)).Methods("PUT")
 	usersRouter.HandleFunc("/me/image", mw.Protect(usersHandler.GetUserImage)).Methods("GET")
 	usersRouter.HandleFunc("/me/image", mw.Protect(usersHandler.UpdateUserImage)).Methods("PUT")
-	usersRouter.HandleFunc("/me/change-password", mw.Protect(usersHandler.ChangePassword)).Methods("PUT")
+	// Смена пароля доступна и с ограниченным токеном, который выдается при входе с истекшим паролем
+	usersRouter.HandleFunc("/me/change-password", mw.ProtectPasswordChange(usersHandler.ChangePassword)).Methods("PUT")
+	usersRouter.HandleFunc("/me/calendar-tokens", mw.Protect(calendarHandler.CreateFeedToken)).Methods("POST")
+	usersRouter.HandleFunc("/me/calendar-tokens", mw.Protect(calendarHandler.GetFeedTokens)).Methods("GET")
+	usersRouter.HandleFunc("/me/calendar-tokens/{id:[0-9]+}", mw.Protect(calendarHandler.RevokeFeedToken)).Methods("DELETE")
 	usersRouter.HandleFunc("/users", mw.Protect(usersHandler.GetAllUsers)).Methods("GET")
+	usersRouter.HandleFunc("/users/{email}/lock", mw.Protect(requireAdmin(authHandler.GetLockStatus))).Methods("GET")
+	usersRouter.HandleFunc("/users/{email}/lock", mw.Protect(requireAdmin(authHandler.UnlockAccount))).Methods("DELETE")
+
+	// Ленты календаря авторизуются токеном из параметра token, а не заголовком Authorization
+	usersRouter.HandleFunc("/me/bookings.ics", calendarHandler.ProtectFeed(calendarHandler.GetUserCalendar)).Methods("GET")
+
+	// Группа маршрутов для комнат
+	roomsRouter := r.PathPrefix("/api/v1/rooms").Subrouter()
+	roomsRouter.HandleFunc("", mw.Protect(roomsHandler.GetRooms)).Methods("GET")
+	roomsRouter.HandleFunc("", mw.Protect(requireAdmin(roomsHandler.CreateRoom))).Methods("POST")
+	roomsRouter.HandleFunc("/{id:[0-9]+}", mw.Protect(roomsHandler.GetRoom)).Methods("GET")
+	roomsRouter.HandleFunc("/{id:[0-9]+}", mw.Protect(requireAdmin(roomsHandler.UpdateRoom))).Methods("PUT")
+	roomsRouter.HandleFunc("/{id:[0-9]+}", mw.Protect(requireAdmin(roomsHandler.DeleteRoom))).Methods("DELETE")
+	roomsRouter.HandleFunc("/{id:[0-9]+}/active", mw.Protect(requireAdmin(roomsHandler.ToggleRoomActive))).Methods("PATCH")
+	roomsRouter.HandleFunc("/{id:[0-9]+}/images", mw.Protect(roomsHandler.GetImages)).Methods("GET")
+	roomsRouter.HandleFunc("/{id:[0-9]+}/images", mw.Protect(requireAdmin(roomsHandler.AddImage))).Methods("POST")
+	roomsRouter.HandleFunc("/{id:[0-9]+}/images/{imageId:[0-9]+}", mw.Protect(roomsHandler.GetImage)).Methods("GET")
+	roomsRouter.HandleFunc("/{id:[0-9]+}/images/{imageId:[0-9]+}", mw.Protect(requireAdmin(roomsHandler.DeleteImage))).Methods("DELETE")
+	roomsRouter.HandleFunc("/{id:[0-9]+}/images/{imageId:[0-9]+}/cover", mw.Protect(requireAdmin(roomsHandler.SetCoverImage))).Methods("PUT")
+	roomsRouter.HandleFunc("/{id:[0-9]+}/approvers", mw.Protect(requireAdmin(roomsHandler.GetApprovers))).Methods("GET")
+	roomsRouter.HandleFunc("/{id:[0-9]+}/approvers", mw.Protect(requireAdmin(roomsHandler.SetApprovers))).Methods("PUT")
+	roomsRouter.HandleFunc("/{id:[0-9]+}/amenities", mw.Protect(requireAdmin(roomsHandler.SetRoomAmenities))).Methods("PUT")
+	roomsRouter.HandleFunc("/{id:[0-9]+}/location", mw.Protect(requireAdmin(sectionsHandler.SetRoomLocation))).Methods("PUT")
+	roomsRouter.HandleFunc("/{id:[0-9]+}/availability", mw.Protect(roomsHandler.GetAvailability)).Methods("GET")
+	roomsRouter.HandleFunc("/{id:[0-9]+}/import", mw.Protect(bookingsHandler.ImportBookings)).Methods("POST")
+	roomsRouter.HandleFunc("/{id:[0-9]+}/calendar.ics", calendarHandler.ProtectFeed(calendarHandler.GetRoomCalendar)).Methods("GET")
+
+	// Группа маршрутов для праздников и закрытий
+	closuresRouter := r.PathPrefix("/api/v1/closures").Subrouter()
+	closuresRouter.HandleFunc("", mw.Protect(roomsHandler.GetClosures)).Methods("GET")
+	closuresRouter.HandleFunc("", mw.Protect(requireAdmin(roomsHandler.CreateClosure))).Methods("POST")
+	closuresRouter.HandleFunc("/import", mw.Protect(requireAdmin(roomsHandler.ImportClosures))).Methods("POST")
+	closuresRouter.HandleFunc("/{id:[0-9]+}", mw.Protect(requireAdmin(roomsHandler.DeleteClosure))).Methods("DELETE")
+
+	// Группы маршрутов для этажей и секций зданий
+	floorsRouter := r.PathPrefix("/api/v1/floors").Subrouter()
+	floorsRouter.HandleFunc("", mw.Protect(sectionsHandler.GetFloors)).Methods("GET")
+	floorsRouter.HandleFunc("", mw.Protect(requireAdmin(sectionsHandler.CreateFloor))).Methods("POST")
+	floorsRouter.HandleFunc("/{id:[0-9]+}", mw.Protect(sectionsHandler.GetFloor)).Methods("GET")
+	floorsRouter.HandleFunc("/{id:[0-9]+}", mw.Protect(requireAdmin(sectionsHandler.UpdateFloor))).Methods("PUT")
+	floorsRouter.HandleFunc("/{id:[0-9]+}", mw.Protect(requireAdmin(sectionsHandler.DeleteFloor))).Methods("DELETE")
+
+	sectionsRouter := r.PathPrefix("/api/v1/sections").Subrouter()
+	sectionsRouter.HandleFunc("", mw.Protect(sectionsHandler.GetSections)).Methods("GET")
+	sectionsRouter.HandleFunc("", mw.Protect(requireAdmin(sectionsHandler.CreateSection))).Methods("POST")
+	sectionsRouter.HandleFunc("/tree", mw.Protect(sectionsHandler.GetTree)).Methods("GET")
+	sectionsRouter.HandleFunc("/{id:[0-9]+}", mw.Protect(requireAdmin(sectionsHandler.UpdateSection))).Methods("PUT")
+	sectionsRouter.HandleFunc("/{id:[0-9]+}", mw.Protect(requireAdmin(sectionsHandler.DeleteSection))).Methods("DELETE")
+
+	// Группа маршрутов для справочника оборудования комнат
+	amenitiesRouter := r.PathPrefix("/api/v1/amenities").Subrouter()
+	amenitiesRouter.HandleFunc("", mw.Protect(roomsHandler.GetAmenities)).Methods("GET")
+	amenitiesRouter.HandleFunc("", mw.Protect(requireAdmin(roomsHandler.CreateAmenity))).Methods("POST")
+	amenitiesRouter.HandleFunc("/{id:[0-9]+}", mw.Protect(requireAdmin(roomsHandler.UpdateAmenity))).Methods("PUT")
+	amenitiesRouter.HandleFunc("/{id:[0-9]+}", mw.Protect(requireAdmin(roomsHandler.DeleteAmenity))).Methods("DELETE")
+
+	// Группа маршрутов для бронирований
+	bookingsRouter := r.PathPrefix("/api/v1/bookings").Subrouter()
+	bookingsRouter.HandleFunc("", mw.Protect(bookingsHandler.CreateBooking)).Methods("POST")
+	bookingsRouter.HandleFunc("/{id:[0-9]+}", mw.Protect(bookingsHandler.GetBooking)).Methods("GET")
+	bookingsRouter.HandleFunc("/{id:[0-9]+}", mw.Protect(bookingsHandler.UpdateBooking)).Methods("PATCH")
+	bookingsRouter.HandleFunc("/{id:[0-9]+}", mw.Protect(bookingsHandler.CancelBooking)).Methods("DELETE")
+	bookingsRouter.HandleFunc("/{id:[0-9]+}/history", mw.Protect(bookingsHandler.GetBookingHistory)).Methods("GET")
+	bookingsRouter.HandleFunc("/{id:[0-9]+}/check-in", mw.Protect(bookingsHandler.CheckIn)).Methods("POST")
+	bookingsRouter.HandleFunc("/{id:[0-9]+}/approve", mw.Protect(bookingsHandler.ApproveBooking)).Methods("POST")
+	bookingsRouter.HandleFunc("/{id:[0-9]+}/reject", mw.Protect(bookingsHandler.RejectBooking)).Methods("POST")
+	bookingsRouter.HandleFunc("/approvals", mw.Protect(bookingsHandler.GetPendingApprovals)).Methods("GET")
+	bookingsRouter.HandleFunc("/no-shows", mw.Protect(bookingsHandler.GetNoShowStats)).Methods("GET")
+	bookingsRouter.HandleFunc("/quotas", mw.Protect(requireAdmin(bookingsHandler.GetQuotas))).Methods("GET")
+	bookingsRouter.HandleFunc("/quotas", mw.Protect(requireAdmin(bookingsHandler.CreateQuota))).Methods("POST")
+	bookingsRouter.HandleFunc("/quotas/{id:[0-9]+}", mw.Protect(requireAdmin(bookingsHandler.DeleteQuota))).Methods("DELETE")
+	bookingsRouter.HandleFunc("/waitlist", mw.Protect(bookingsHandler.JoinWaitlist)).Methods("POST")
+	bookingsRouter.HandleFunc("/waitlist", mw.Protect(bookingsHandler.GetWaitlist)).Methods("GET")
+	bookingsRouter.HandleFunc("/waitlist/{id:[0-9]+}", mw.Protect(bookingsHandler.LeaveWaitlist)).Methods("DELETE")
+	bookingsRouter.HandleFunc("/waitlist/{id:[0-9]+}/accept", mw.Protect(bookingsHandler.AcceptWaitlistOffer)).Methods("POST")
+	bookingsRouter.HandleFunc("/series", mw.Protect(bookingsHandler.CreateSeries)).Methods("POST")
+	bookingsRouter.HandleFunc("/series/{id:[0-9]+}", mw.Protect(bookingsHandler.GetSeries)).Methods("GET")
+	bookingsRouter.HandleFunc("/series/{id:[0-9]+}", mw.Protect(bookingsHandler.UpdateSeries)).Methods("PATCH")
+	bookingsRouter.HandleFunc("/series/{id:[0-9]+}", mw.Protect(bookingsHandler.CancelSeries)).Methods("DELETE")
 
 	// Запуск сервера
 	log.Println("Сервер запущен на порту 8080...")
 	log.Fatal(http.ListenAndServe(":8080", r))
 
 }
+
+// durationEnv читает длительность из переменной окружения в формате time.ParseDuration ("15m", "1h30m").
+// Если переменная не задана или некорректна, возвращается значение по умолчанию.
+func durationEnv(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Некорректное значение %s=%q, используется %v", name, value, def)
+		return def
+	}
+	return d
+}
+
+// intEnv читает неотрицательное целое из переменной окружения.
+// Если переменная не задана или некорректна, возвращается значение по умолчанию.
+func intEnv(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Printf("Некорректное значение %s=%q, используется %v", name, value, def)
+		return def
+	}
+	return n
+}
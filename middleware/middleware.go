@@ -15,10 +15,22 @@ var secretKey = []byte(os.Getenv("SECRET_KEY"))
 
 type Claims struct {
 	Email     string `json:"email"`
-	TokenType string `json:"tokenType"` // Это поле будет указывать на тип токена
+	TokenType string `json:"tokenType"`        // Это поле будет указывать на тип токена
+	Family    string `json:"family,omitempty"` // Семейство refresh токенов одного входа, ID - идентификатор токена (jti)
 	jwt.RegisteredClaims
 }
 
+// Время жизни токенов
+const (
+	AccessTokenTTL         = 2 * time.Hour    // Access токен живет 2 часа
+	RefreshTokenTTL        = 24 * time.Hour   // Refresh токен живет 24 часа
+	PasswordChangeTokenTTL = 15 * time.Minute // Токен для смены истекшего пароля живет 15 минут
+)
+
+// PasswordChangeTokenType - тип ограниченного токена, который выдается при входе с истекшим паролем
+// и позволяет только сменить пароль
+const PasswordChangeTokenType = "password_change"
+
 // Protect is a middleware that ensures the user is authenticated by checking the access token
 func Protect(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -36,6 +48,14 @@ func Protect(next http.HandlerFunc) http.HandlerFunc {
 		// Validate the token
 		email, err := ValidateAccessToken(accessToken)
 		if err != nil {
+			// Токен для смены истекшего пароля подходит только для смены пароля
+			if _, errChange := ValidateToken(accessToken, PasswordChangeTokenType); errChange == nil {
+				SendJSONResponse(w, &models.Response{
+					Message: "Срок действия пароля истек, смените пароль",
+				}, http.StatusForbidden)
+				return
+			}
+
 			// If the token is invalid, send an error response with Response
 			response := models.Response{
 				Message: "Невалидный токен",
@@ -53,34 +73,89 @@ func Protect(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-func GenerateTokens(email string) (string, string, error) {
-	accessExpiration := time.Now().Add(2 * time.Hour)   // Access токен живет 1 час
-	refreshExpiration := time.Now().Add(24 * time.Hour) // Refresh токен живет 24 часа
+// ProtectPasswordChange работает как Protect, но кроме access токена принимает токен для смены истекшего пароля
+func ProtectPasswordChange(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, err := ExtractAccessToken(r)
+		if err != nil {
+			SendJSONResponse(w, &models.Response{Message: "Неверный или отсутствующий токен"}, http.StatusUnauthorized)
+			return
+		}
 
-	// Генерация access токена
-	accessToken, err := generateToken(email, accessExpiration, "access")
-	if err != nil {
-		return "", "", err
-	}
+		email, err := ValidateAccessToken(token)
+		if err != nil {
+			if email, err = ValidateToken(token, PasswordChangeTokenType); err != nil {
+				SendJSONResponse(w, &models.Response{Message: "Невалидный токен"}, http.StatusUnauthorized)
+				return
+			}
+		}
 
-	// Генерация refresh токена
-	refreshToken, err := generateToken(email, refreshExpiration, "refresh")
-	if err != nil {
-		return "", "", err
+		next(w, r.WithContext(context.WithValue(r.Context(), "email", email)))
 	}
+}
 
-	return accessToken, refreshToken, nil
+// AdminChecker проверяет, является ли пользователь администратором
+type AdminChecker interface {
+	IsAdmin(email string) (bool, error)
 }
 
-func generateToken(email string, expirationTime time.Time, tokenType string) (string, error) {
-	claims := &Claims{
-		Email:     email,
-		TokenType: tokenType, // Устанавливаем тип токена
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			Issuer:    "book_talk",
-		},
+// RequireAdmin пропускает запрос дальше, только если его выполняет администратор.
+// Используется после Protect, который кладет email пользователя в контекст запроса.
+func RequireAdmin(roles AdminChecker) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			email, ok := r.Context().Value("email").(string)
+			if !ok {
+				SendJSONResponse(w, &models.Response{
+					Message: "Unauthorized",
+				}, http.StatusUnauthorized)
+				return
+			}
+
+			isAdmin, err := roles.IsAdmin(email)
+			if err != nil {
+				SendJSONResponse(w, &models.Response{Message: "Внутренняя ошибка сервера: " + err.Error()}, http.StatusInternalServerError)
+				return
+			}
+			if !isAdmin {
+				SendJSONResponse(w, &models.Response{Message: "Недостаточно прав"}, http.StatusForbidden)
+				return
+			}
+
+			next(w, r)
+		}
 	}
+}
+
+// GenerateAccessToken выпускает access токен пользователя
+func GenerateAccessToken(email string) (string, error) {
+	return generateToken(&Claims{Email: email, TokenType: "access"}, time.Now().Add(AccessTokenTTL))
+}
+
+// GeneratePasswordChangeToken выпускает ограниченный токен, с которым можно только сменить пароль
+func GeneratePasswordChangeToken(email string) (string, error) {
+	return generateToken(&Claims{Email: email, TokenType: PasswordChangeTokenType}, time.Now().Add(PasswordChangeTokenTTL))
+}
+
+// GenerateRefreshToken выпускает refresh токен с идентификатором id из семейства family.
+// Токены отслеживаются на сервере, поэтому идентификатор и семейство задает вызывающий.
+func GenerateRefreshToken(email, id, family string, expirationTime time.Time) (string, error) {
+	claims := &Claims{Email: email, TokenType: "refresh", Family: family}
+	claims.ID = id
+	return generateToken(claims, expirationTime)
+}
+
+// GenerateActionToken выпускает подписанный токен одноразового действия tokenType, например подтверждения email.
+// Однократность использования обеспечивает вызывающий по идентификатору id.
+func GenerateActionToken(email, tokenType, id string, expirationTime time.Time) (string, error) {
+	claims := &Claims{Email: email, TokenType: tokenType}
+	claims.ID = id
+	return generateToken(claims, expirationTime)
+}
+
+func generateToken(claims *Claims, expirationTime time.Time) (string, error) {
+	claims.ExpiresAt = jwt.NewNumericDate(expirationTime)
+	claims.Issuer = "book_talk"
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString(secretKey)
@@ -118,27 +193,36 @@ func ValidateAccessToken(tokenString string) (string, error) {
 	return email, nil
 }
 
-// ValidateToken проверяет валидность токена и возвращает claims
+// ValidateToken проверяет валидность токена и возвращает email пользователя
 func ValidateToken(tokenString string, tokenType string) (string, error) {
+	claims, err := ParseToken(tokenString, tokenType)
+	if err != nil {
+		return "", err
+	}
+	return claims.Email, nil
+}
+
+// ParseToken проверяет подпись, срок действия и тип токена и возвращает claims
+func ParseToken(tokenString string, tokenType string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		return secretKey, nil
 	})
 
 	if err != nil {
-		return "", fmt.Errorf("невалидный токен: %v", err)
+		return nil, fmt.Errorf("невалидный токен: %w", err)
 	}
 
 	claims, ok := token.Claims.(*Claims)
 	if !ok || !token.Valid {
-		return "", fmt.Errorf("невалидные данные в токене")
+		return nil, fmt.Errorf("невалидные данные в токене")
 	}
 
 	// Проверяем тип токена
 	if claims.TokenType != tokenType {
-		return "", fmt.Errorf("неправильный тип токена")
+		return nil, fmt.Errorf("неправильный тип токена")
 	}
 
-	return claims.Email, nil
+	return claims, nil
 }
 
 // SendJSONResponse sends a JSON response with the given response data and status code